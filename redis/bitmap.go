@@ -0,0 +1,51 @@
+package redis
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/gomodule/redigo/redis"
+)
+
+// BITOP 支持的位运算
+const (
+	BitOpAnd = "AND"
+	BitOpOr  = "OR"
+	BitOpXor = "XOR"
+	BitOpNot = "NOT"
+)
+
+// SetBit 对 key 所储存的字符串值，设置或清除指定偏移量上的位(bit)
+// return: 指定偏移量原来储存的位
+func (r *Redis) SetBit(ctx *gin.Context, key string, offset int64, value int) (int, error) {
+	return redis.Int(r.Do(ctx, "SETBIT", key, offset, value))
+}
+
+// GetBit 对 key 所储存的字符串值，获取指定偏移量上的位(bit)，key 不存在时返回0
+func (r *Redis) GetBit(ctx *gin.Context, key string, offset int64) (int, error) {
+	return redis.Int(r.Do(ctx, "GETBIT", key, offset))
+}
+
+// BitCount 计算给定字符串中，被设置为 1 的比特位的数量
+func (r *Redis) BitCount(ctx *gin.Context, key string) (int64, error) {
+	return redis.Int64(r.Do(ctx, "BITCOUNT", key))
+}
+
+// BitCountRange 计算给定字符串中，字节区间 [start, end] 内被设置为 1 的比特位的数量
+// start 和 end 以字节为单位，可以使用负数值， -1 表示最后一个字节
+func (r *Redis) BitCountRange(ctx *gin.Context, key string, start, end int64) (int64, error) {
+	return redis.Int64(r.Do(ctx, "BITCOUNT", key, start, end))
+}
+
+// BitOp 对一个或多个保存二进制位的字符串 key 进行位运算，并将结果保存到 destKey 上
+// op 为 BitOpAnd、BitOpOr、BitOpXor、BitOpNot 之一，BitOpNot 只接受一个 key
+// return: 保存到 destKey 的字符串的长度
+func (r *Redis) BitOp(ctx *gin.Context, op, destKey string, keys ...string) (int64, error) {
+	args := packArgs(op, destKey, keys)
+	return redis.Int64(r.Do(ctx, "BITOP", args...))
+}
+
+// BitField 将字符串看作位数组，对其中指定宽度的整数进行 GET/SET/INCRBY/OVERFLOW 操作
+// 如：r.BitField(ctx, "key", "INCRBY", "u8", 0, 1, "GET", "u4", 8)
+// return: 每个子命令的结果，OVERFLOW FAIL 导致未执行的子命令结果为0
+func (r *Redis) BitField(ctx *gin.Context, key string, args ...interface{}) ([]int64, error) {
+	return redis.Int64s(r.Do(ctx, "BITFIELD", packArgs(key, args)...))
+}
@@ -0,0 +1,46 @@
+package redis_test
+
+import (
+	"testing"
+
+	"github.com/derekAHua/goLib/redis"
+	"github.com/derekAHua/goLib/redis/redistest"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBitmap(t *testing.T) {
+	ctx := &gin.Context{}
+	r, _ := redistest.NewRedis(t)
+
+	for _, offset := range []int64{0, 3, 9, 17} {
+		old, err := r.SetBit(ctx, "bits", offset, 1)
+		assert.Nil(t, err)
+		assert.Equal(t, 0, old)
+	}
+	old, err := r.SetBit(ctx, "bits", 3, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, old)
+
+	bit, err := r.GetBit(ctx, "bits", 9)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, bit)
+	bit, err = r.GetBit(ctx, "missing", 9)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, bit)
+
+	count, err := r.BitCount(ctx, "bits")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), count)
+	count, err = r.BitCountRange(ctx, "bits", 1, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), count)
+
+	_, err = r.SetBit(ctx, "other", 9, 1)
+	assert.Nil(t, err)
+	_, err = r.BitOp(ctx, redis.BitOpAnd, "and", "bits", "other")
+	assert.Nil(t, err)
+	count, err = r.BitCount(ctx, "and")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), count)
+}
@@ -0,0 +1,102 @@
+package redis
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+)
+
+// redis 字符串最大512MB，即 2^32 个bit
+const maxBloomBits = uint64(1) << 32
+
+const (
+	bloomAddScript = `local added = 0
+for i = 1, #ARGV do
+	if redis.call('SETBIT', KEYS[1], ARGV[i], 1) == 0 then
+		added = 1
+	end
+end
+return added`
+
+	bloomExistsScript = `for i = 1, #ARGV do
+	if redis.call('GETBIT', KEYS[1], ARGV[i]) == 0 then
+		return 0
+	end
+end
+return 1`
+)
+
+// BloomFilter 基于bitmap实现的布隆过滤器，hash在客户端计算，不依赖redis module
+type BloomFilter struct {
+	redis *Redis
+	key   string
+	bits  uint64 // bitmap 的位数 m
+	k     uint64 // hash 函数个数 k
+}
+
+// NewBloomFilter 根据预计元素数量 capacity 和期望误判率 fpRate 创建布隆过滤器
+// 位数 m = -n*ln(p)/(ln2)^2，hash 函数个数 k = m/n*ln2
+func (r *Redis) NewBloomFilter(key string, capacity uint64, fpRate float64) (*BloomFilter, error) {
+	if key == "" {
+		return nil, errors.New("bloom filter key is empty")
+	}
+	if capacity == 0 {
+		return nil, errors.New("bloom filter capacity must > 0")
+	}
+	if fpRate <= 0 || fpRate >= 1 {
+		return nil, errors.New("bloom filter false positive rate must in (0, 1)")
+	}
+
+	m := math.Ceil(-float64(capacity) * math.Log(fpRate) / (math.Ln2 * math.Ln2))
+	if m > float64(maxBloomBits) {
+		return nil, errors.New("bloom filter size exceeds redis bitmap limit")
+	}
+	k := math.Max(1, math.Round(m/float64(capacity)*math.Ln2))
+
+	return &BloomFilter{
+		redis: r,
+		key:   key,
+		bits:  uint64(m),
+		k:     uint64(k),
+	}, nil
+}
+
+// Add 添加元素
+// return: 元素之前一定不存在时返回true，可能已存在时返回false
+func (b *BloomFilter) Add(ctx *gin.Context, item string) (bool, error) {
+	return redis.Bool(b.redis.Lua(ctx, bloomAddScript, 1, packArgs(b.key, b.offsets(item))...))
+}
+
+// Exists 判断元素是否存在，返回false时一定不存在，返回true时可能存在(存在误判率)
+func (b *BloomFilter) Exists(ctx *gin.Context, item string) (bool, error) {
+	return redis.Bool(b.redis.Lua(ctx, bloomExistsScript, 1, packArgs(b.key, b.offsets(item))...))
+}
+
+// Bits 返回bitmap的位数
+func (b *BloomFilter) Bits() uint64 {
+	return b.bits
+}
+
+// HashCount 返回hash函数的个数
+func (b *BloomFilter) HashCount() uint64 {
+	return b.k
+}
+
+// offsets 使用 double hashing 由一次128位FNV计算出 k 个偏移量: h1 + i*h2
+func (b *BloomFilter) offsets(item string) []uint64 {
+	h := fnv.New128a()
+	_, _ = h.Write([]byte(item))
+	sum := h.Sum(nil)
+	h1 := binary.BigEndian.Uint64(sum[:8])
+	h2 := binary.BigEndian.Uint64(sum[8:])
+
+	offsets := make([]uint64, 0, b.k)
+	for i := uint64(0); i < b.k; i++ {
+		offsets = append(offsets, (h1+i*h2)%b.bits)
+	}
+	return offsets
+}
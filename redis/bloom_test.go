@@ -0,0 +1,77 @@
+package redis_test
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/derekAHua/goLib/redis"
+	"github.com/derekAHua/goLib/redis/redistest"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBloomFilter(t *testing.T) {
+	ctx := &gin.Context{}
+	r, s := redistest.NewRedis(t)
+	s.Script(redis.BloomAddScript, func(call func(args ...string) interface{}, keys, argv []string) interface{} {
+		added := int64(0)
+		for _, offset := range argv {
+			if call("SETBIT", keys[0], offset, "1") == int64(0) {
+				added = 1
+			}
+		}
+		return added
+	})
+	s.Script(redis.BloomExistsScript, func(call func(args ...string) interface{}, keys, argv []string) interface{} {
+		for _, offset := range argv {
+			if call("GETBIT", keys[0], offset) == int64(0) {
+				return int64(0)
+			}
+		}
+		return int64(1)
+	})
+
+	_, err := r.NewBloomFilter("bloom", 0, 0.01)
+	assert.NotNil(t, err)
+	_, err = r.NewBloomFilter("bloom", 1000, 1)
+	assert.NotNil(t, err)
+
+	const capacity = 1000
+	bloom, err := r.NewBloomFilter("bloom", capacity, 0.01)
+	assert.Nil(t, err)
+	// m = -1000*ln(0.01)/(ln2)^2 ≈ 9586, k ≈ 7
+	assert.Equal(t, uint64(9586), bloom.Bits())
+	assert.Equal(t, uint64(7), bloom.HashCount())
+
+	// 新元素的bit可能已被其他元素全部置位，此时 Add 返回false，其比例同样受误判率约束
+	notAdded := 0
+	for i := 0; i < capacity; i++ {
+		added, err := bloom.Add(ctx, "member:"+strconv.Itoa(i))
+		assert.Nil(t, err)
+		if !added {
+			notAdded++
+		}
+	}
+	assert.Less(t, notAdded, capacity*3/100)
+	added, err := bloom.Add(ctx, "member:0")
+	assert.Nil(t, err)
+	assert.False(t, added)
+
+	// 已添加的元素一定存在
+	for i := 0; i < capacity; i++ {
+		exists, err := bloom.Exists(ctx, "member:"+strconv.Itoa(i))
+		assert.Nil(t, err)
+		assert.True(t, exists)
+	}
+
+	// 未添加元素的误判率应接近期望值，这里只做宽松的上限检查
+	falsePositives := 0
+	for i := 0; i < capacity; i++ {
+		exists, err := bloom.Exists(ctx, "other:"+strconv.Itoa(i))
+		assert.Nil(t, err)
+		if exists {
+			falsePositives++
+		}
+	}
+	assert.Less(t, falsePositives, capacity*3/100)
+}
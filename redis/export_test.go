@@ -0,0 +1,7 @@
+package redis
+
+// 导出布隆过滤器脚本，供 redis_test 注册 redistest 的Go实现
+const (
+	BloomAddScript    = bloomAddScript
+	BloomExistsScript = bloomExistsScript
+)
@@ -0,0 +1,236 @@
+package redis
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+)
+
+// GEO 命令支持的距离单位
+const (
+	GeoUnitM  = "m"
+	GeoUnitKM = "km"
+	GeoUnitMI = "mi"
+	GeoUnitFT = "ft"
+)
+
+// GEOSEARCH 结果的排序方式
+const (
+	GeoSortAsc  = "ASC"
+	GeoSortDesc = "DESC"
+)
+
+type (
+	// GeoLocation 地理位置成员
+	GeoLocation struct {
+		Name      string
+		Longitude float64
+		Latitude  float64
+		// Dist 与中心点的距离，仅在 GeoSearchQuery.WithDist 时返回
+		Dist float64
+		// GeoHash 52位整数形式的geohash，仅在 GeoSearchQuery.WithHash 时返回
+		GeoHash int64
+	}
+
+	// GeoPos 成员的经纬度
+	GeoPos struct {
+		Longitude float64
+		Latitude  float64
+	}
+
+	// GeoSearchQuery GEOSEARCH 的查询条件
+	// 中心点: Member 不为空时使用 FROMMEMBER，否则使用 FROMLONLAT Longitude Latitude
+	// 范围: Radius > 0 时使用 BYRADIUS，否则使用 BYBOX BoxWidth BoxHeight
+	GeoSearchQuery struct {
+		Member    string
+		Longitude float64
+		Latitude  float64
+
+		Radius    float64
+		BoxWidth  float64
+		BoxHeight float64
+		// Unit 距离单位，默认 GeoUnitKM
+		Unit string
+
+		// Sort 按距离排序 GeoSortAsc/GeoSortDesc，为空时不排序
+		Sort string
+		// Count 返回结果的最大数量，0表示不限制
+		Count int
+		// Any 找到 Count 个结果后立即返回，结果不一定是最近的
+		Any bool
+
+		WithCoord bool
+		WithDist  bool
+		WithHash  bool
+	}
+)
+
+// GeoAdd 将给定的空间元素(经度、纬度、名字)添加到指定的键里面
+// return: 新添加到键里面的空间元素数量，不包括那些已经存在但是被更新的元素
+func (r *Redis) GeoAdd(ctx *gin.Context, key string, locations ...GeoLocation) (int64, error) {
+	args := packArgs(key)
+	for _, l := range locations {
+		args = append(args, l.Longitude, l.Latitude, l.Name)
+	}
+	return redis.Int64(r.Do(ctx, "GEOADD", args...))
+}
+
+// GeoPos 返回给定成员的经纬度，不存在的成员对应位置为nil
+func (r *Redis) GeoPos(ctx *gin.Context, key string, members ...string) ([]*GeoPos, error) {
+	args := packArgs(key, members)
+	values, err := redis.Values(r.Do(ctx, "GEOPOS", args...))
+	if err == redis.ErrNil {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	res := make([]*GeoPos, 0, len(values))
+	for _, v := range values {
+		if v == nil {
+			res = append(res, nil)
+			continue
+		}
+		coord, err := redis.Float64s(v, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(coord) != 2 {
+			return nil, errors.New("geopos err length")
+		}
+		res = append(res, &GeoPos{Longitude: coord[0], Latitude: coord[1]})
+	}
+	return res, nil
+}
+
+// GeoDist 返回两个给定成员之间的距离，unit 为空时默认使用米
+// return: 距离，任一成员不存在时返回-1
+func (r *Redis) GeoDist(ctx *gin.Context, key, member1, member2, unit string) (float64, error) {
+	args := packArgs(key, member1, member2)
+	if unit != "" {
+		args = append(args, unit)
+	}
+	if res, err := redis.Float64(r.Do(ctx, "GEODIST", args...)); err == redis.ErrNil {
+		return -1, nil
+	} else {
+		return res, err
+	}
+}
+
+// GeoSearch 查询以给定成员或经纬度为中心，在指定圆形或矩形范围内的成员，需要redis 6.2+
+func (r *Redis) GeoSearch(ctx *gin.Context, key string, query GeoSearchQuery) ([]GeoLocation, error) {
+	args, err := query.args(key)
+	if err != nil {
+		return nil, err
+	}
+	values, err := redis.Values(r.Do(ctx, "GEOSEARCH", args...))
+	if err == redis.ErrNil {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return query.parse(values)
+}
+
+func (q *GeoSearchQuery) args(key string) ([]interface{}, error) {
+	unit := q.Unit
+	if unit == "" {
+		unit = GeoUnitKM
+	}
+
+	args := packArgs(key)
+	if q.Member != "" {
+		args = append(args, "FROMMEMBER", q.Member)
+	} else {
+		args = append(args, "FROMLONLAT", q.Longitude, q.Latitude)
+	}
+
+	if q.Radius > 0 {
+		args = append(args, "BYRADIUS", q.Radius, unit)
+	} else if q.BoxWidth > 0 && q.BoxHeight > 0 {
+		args = append(args, "BYBOX", q.BoxWidth, q.BoxHeight, unit)
+	} else {
+		return nil, errors.New("geosearch requires radius or box")
+	}
+
+	if q.Sort != "" {
+		args = append(args, q.Sort)
+	}
+	if q.Count > 0 {
+		args = append(args, "COUNT", q.Count)
+		if q.Any {
+			args = append(args, "ANY")
+		}
+	}
+	if q.WithCoord {
+		args = append(args, "WITHCOORD")
+	}
+	if q.WithDist {
+		args = append(args, "WITHDIST")
+	}
+	if q.WithHash {
+		args = append(args, "WITHHASH")
+	}
+	return args, nil
+}
+
+// parse 解析 GEOSEARCH 的返回，带 WITH* 选项时每个元素依次为: name [dist] [hash] [[lon lat]]
+func (q *GeoSearchQuery) parse(values []interface{}) ([]GeoLocation, error) {
+	res := make([]GeoLocation, 0, len(values))
+	withAny := q.WithCoord || q.WithDist || q.WithHash
+
+	for _, v := range values {
+		if !withAny {
+			name, err := redis.String(v, nil)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, GeoLocation{Name: name})
+			continue
+		}
+
+		item, err := redis.Values(v, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(item) == 0 {
+			return nil, errors.New("geosearch err length")
+		}
+
+		var l GeoLocation
+		if l.Name, err = redis.String(item[0], nil); err != nil {
+			return nil, err
+		}
+		i := 1
+		next := func() (interface{}, error) {
+			if i >= len(item) {
+				return nil, errors.Errorf("geosearch reply of %s is too short", l.Name)
+			}
+			i++
+			return item[i-1], nil
+		}
+
+		if q.WithDist {
+			if l.Dist, err = redis.Float64(next()); err != nil {
+				return nil, err
+			}
+		}
+		if q.WithHash {
+			if l.GeoHash, err = redis.Int64(next()); err != nil {
+				return nil, err
+			}
+		}
+		if q.WithCoord {
+			coord, err := redis.Float64s(next())
+			if err != nil {
+				return nil, err
+			}
+			if len(coord) != 2 {
+				return nil, errors.New("geosearch coord err length")
+			}
+			l.Longitude, l.Latitude = coord[0], coord[1]
+		}
+		res = append(res, l)
+	}
+	return res, nil
+}
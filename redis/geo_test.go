@@ -0,0 +1,93 @@
+package redis_test
+
+import (
+	"testing"
+
+	"github.com/derekAHua/goLib/redis"
+	"github.com/derekAHua/goLib/redis/redistest"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGeo(t *testing.T) {
+	ctx := &gin.Context{}
+	r, _ := redistest.NewRedis(t)
+
+	n, err := r.GeoAdd(ctx, "city",
+		redis.GeoLocation{Name: "Palermo", Longitude: 13.361389, Latitude: 38.115556},
+		redis.GeoLocation{Name: "Catania", Longitude: 15.087269, Latitude: 37.502669},
+		redis.GeoLocation{Name: "Rome", Longitude: 12.496366, Latitude: 41.902782},
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), n)
+
+	pos, err := r.GeoPos(ctx, "city", "Palermo", "missing")
+	assert.Nil(t, err)
+	assert.Len(t, pos, 2)
+	assert.InDelta(t, 13.361389, pos[0].Longitude, 1e-4)
+	assert.InDelta(t, 38.115556, pos[0].Latitude, 1e-4)
+	assert.Nil(t, pos[1])
+
+	dist, err := r.GeoDist(ctx, "city", "Palermo", "Catania", redis.GeoUnitKM)
+	assert.Nil(t, err)
+	assert.InDelta(t, 166.2742, dist, 0.01)
+	dist, err = r.GeoDist(ctx, "city", "Palermo", "missing", "")
+	assert.Nil(t, err)
+	assert.Equal(t, float64(-1), dist)
+}
+
+func TestGeoSearch(t *testing.T) {
+	ctx := &gin.Context{}
+	r, _ := redistest.NewRedis(t)
+	_, err := r.GeoAdd(ctx, "city",
+		redis.GeoLocation{Name: "Palermo", Longitude: 13.361389, Latitude: 38.115556},
+		redis.GeoLocation{Name: "Catania", Longitude: 15.087269, Latitude: 37.502669},
+		redis.GeoLocation{Name: "Rome", Longitude: 12.496366, Latitude: 41.902782},
+	)
+	assert.Nil(t, err)
+
+	_, err = r.GeoSearch(ctx, "city", redis.GeoSearchQuery{Member: "Palermo"})
+	assert.NotNil(t, err)
+
+	// 不带 WITH* 时只返回名字
+	res, err := r.GeoSearch(ctx, "city", redis.GeoSearchQuery{
+		Longitude: 15, Latitude: 37, Radius: 200, Sort: redis.GeoSortAsc,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []redis.GeoLocation{{Name: "Catania"}, {Name: "Palermo"}}, res)
+
+	// 同时带 WITHCOORD 和 WITHDIST
+	res, err = r.GeoSearch(ctx, "city", redis.GeoSearchQuery{
+		Member: "Palermo", Radius: 200, Sort: redis.GeoSortDesc,
+		WithCoord: true, WithDist: true,
+	})
+	assert.Nil(t, err)
+	assert.Len(t, res, 2)
+	assert.Equal(t, "Catania", res[0].Name)
+	assert.InDelta(t, 166.2742, res[0].Dist, 0.01)
+	assert.InDelta(t, 15.087269, res[0].Longitude, 1e-4)
+	assert.InDelta(t, 37.502669, res[0].Latitude, 1e-4)
+	assert.Equal(t, "Palermo", res[1].Name)
+	assert.InDelta(t, 0, res[1].Dist, 0.01)
+
+	// 只带 WITHDIST，经纬度保持为零值
+	res, err = r.GeoSearch(ctx, "city", redis.GeoSearchQuery{
+		Longitude: 15, Latitude: 37, BoxWidth: 400, BoxHeight: 400, Unit: redis.GeoUnitKM,
+		Sort: redis.GeoSortAsc, Count: 1, WithDist: true,
+	})
+	assert.Nil(t, err)
+	assert.Len(t, res, 1)
+	assert.Equal(t, "Catania", res[0].Name)
+	assert.InDelta(t, 56.4413, res[0].Dist, 0.01)
+	assert.Zero(t, res[0].Longitude)
+
+	// 只带 WITHCOORD
+	res, err = r.GeoSearch(ctx, "city", redis.GeoSearchQuery{
+		Member: "Rome", Radius: 10, WithCoord: true,
+	})
+	assert.Nil(t, err)
+	assert.Len(t, res, 1)
+	assert.Equal(t, "Rome", res[0].Name)
+	assert.Zero(t, res[0].Dist)
+	assert.InDelta(t, 12.496366, res[0].Longitude, 1e-4)
+}
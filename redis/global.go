@@ -24,3 +24,8 @@ func (r *Redis) Ttl(ctx *gin.Context, key string) (int64, error) {
 func (r *Redis) Pttl(ctx *gin.Context, key string) (int64, error) {
 	return redis.Int64(r.Do(ctx, "PTTL", key))
 }
+
+// ExpireAt 设置 key 在 UNIX 时间戳 timestamp(秒) 过期
+func (r *Redis) ExpireAt(ctx *gin.Context, key string, timestamp int64) (bool, error) {
+	return redis.Bool(r.Do(ctx, "EXPIREAT", key, timestamp))
+}
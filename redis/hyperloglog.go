@@ -0,0 +1,26 @@
+package redis
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/gomodule/redigo/redis"
+)
+
+// PFAdd 将任意数量的元素添加到指定的 HyperLogLog 里面
+// return: HyperLogLog 的内部储存被修改了返回true，否则返回false
+func (r *Redis) PFAdd(ctx *gin.Context, key string, elements ...string) (bool, error) {
+	args := packArgs(key, elements)
+	return redis.Bool(r.Do(ctx, "PFADD", args...))
+}
+
+// PFCount 返回给定 HyperLogLog 的基数估算值，给定多个 key 时返回并集的基数估算值
+func (r *Redis) PFCount(ctx *gin.Context, keys ...string) (int64, error) {
+	args := packArgs(keys)
+	return redis.Int64(r.Do(ctx, "PFCOUNT", args...))
+}
+
+// PFMerge 将多个 HyperLogLog 合并为一个，合并后的 HyperLogLog 的基数估算值是所有给定 HyperLogLog 的并集
+func (r *Redis) PFMerge(ctx *gin.Context, destKey string, keys ...string) error {
+	args := packArgs(destKey, keys)
+	_, err := r.Do(ctx, "PFMERGE", args...)
+	return err
+}
@@ -0,0 +1,35 @@
+package redis_test
+
+import (
+	"testing"
+
+	"github.com/derekAHua/goLib/redis/redistest"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHyperLogLog(t *testing.T) {
+	ctx := &gin.Context{}
+	r, _ := redistest.NewRedis(t)
+
+	changed, err := r.PFAdd(ctx, "uv:1", "a", "b", "c")
+	assert.Nil(t, err)
+	assert.True(t, changed)
+	changed, err = r.PFAdd(ctx, "uv:1", "a")
+	assert.Nil(t, err)
+	assert.False(t, changed)
+	_, err = r.PFAdd(ctx, "uv:2", "c", "d")
+	assert.Nil(t, err)
+
+	count, err := r.PFCount(ctx, "uv:1")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), count)
+	count, err = r.PFCount(ctx, "uv:1", "uv:2")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), count)
+
+	assert.Nil(t, r.PFMerge(ctx, "uv", "uv:1", "uv:2"))
+	count, err = r.PFCount(ctx, "uv")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), count)
+}
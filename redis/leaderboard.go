@@ -0,0 +1,322 @@
+package redis
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// LeaderboardPeriod 排行榜的时间分桶周期
+type LeaderboardPeriod int
+
+const (
+	PeriodNone LeaderboardPeriod = iota // 不分桶，永久榜单
+	PeriodDaily
+	PeriodWeekly // 按ISO周分桶，周一为一周的开始
+	PeriodMonthly
+)
+
+type (
+	// LeaderboardEntry 排行榜条目，Rank 从1开始，分数相同的成员排名相同
+	LeaderboardEntry struct {
+		Member string
+		Score  float64
+		Rank   int64
+	}
+
+	// LeaderboardOption 排行榜的可选项
+	LeaderboardOption func(*Leaderboard)
+
+	// Leaderboard 基于有序集实现的排行榜，分数越高排名越靠前
+	Leaderboard struct {
+		redis  *Redis
+		name   string
+		period LeaderboardPeriod
+		retain int
+		loc    *time.Location
+		now    func() time.Time
+	}
+)
+
+// WithLeaderboardPeriod 按周期分桶，每个周期一个独立的榜单
+// retain: 周期结束后榜单继续保留的周期数，超出后自动过期
+func WithLeaderboardPeriod(period LeaderboardPeriod, retain int) LeaderboardOption {
+	return func(l *Leaderboard) {
+		l.period = period
+		l.retain = retain
+	}
+}
+
+// WithLeaderboardLocation 指定周期分桶使用的时区，默认为 time.Local
+func WithLeaderboardLocation(loc *time.Location) LeaderboardOption {
+	return func(l *Leaderboard) {
+		l.loc = loc
+	}
+}
+
+// NewLeaderboard 创建名为 name 的排行榜，name 同时是有序集 key(分桶时为key前缀)
+func (r *Redis) NewLeaderboard(name string, opts ...LeaderboardOption) *Leaderboard {
+	l := &Leaderboard{
+		redis: r,
+		name:  name,
+		loc:   time.Local,
+		now:   time.Now,
+	}
+	for _, f := range opts {
+		f(l)
+	}
+	return l
+}
+
+// At 返回时间 t 所在周期的榜单，用于读取或写入历史周期
+func (l *Leaderboard) At(t time.Time) *Leaderboard {
+	c := *l
+	c.now = func() time.Time { return t }
+	return &c
+}
+
+// Key 返回当前周期榜单的有序集 key
+func (l *Leaderboard) Key() string {
+	t := l.now().In(l.loc)
+	switch l.period {
+	case PeriodDaily:
+		return l.name + ":" + t.Format("20060102")
+	case PeriodWeekly:
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%s:%dW%02d", l.name, year, week)
+	case PeriodMonthly:
+		return l.name + ":" + t.Format("200601")
+	default:
+		return l.name
+	}
+}
+
+// SetScore 设置成员的分数
+func (l *Leaderboard) SetScore(ctx *gin.Context, member string, score float64) error {
+	key := l.Key()
+	if _, err := l.redis.ZAdd(ctx, key, map[string]float64{member: score}); err != nil {
+		return err
+	}
+	return l.touch(ctx, key)
+}
+
+// IncrScore 为成员的分数加上增量 delta，返回新的分数
+func (l *Leaderboard) IncrScore(ctx *gin.Context, member string, delta float64) (float64, error) {
+	key := l.Key()
+	score, err := l.redis.ZIncrBy(ctx, key, delta, member)
+	if err != nil {
+		return 0, err
+	}
+	return score, l.touch(ctx, key)
+}
+
+// Remove 从榜单中移除成员
+func (l *Leaderboard) Remove(ctx *gin.Context, members ...string) (int64, error) {
+	return l.redis.ZRem(ctx, l.Key(), members...)
+}
+
+// Count 返回榜单的成员数量
+func (l *Leaderboard) Count(ctx *gin.Context) (int64, error) {
+	return l.redis.ZCard(ctx, l.Key())
+}
+
+// Entry 返回成员的分数和排名，成员不存在时返回nil
+func (l *Leaderboard) Entry(ctx *gin.Context, member string) (*LeaderboardEntry, error) {
+	key := l.Key()
+	res, err := l.redis.ZScore(ctx, key, member)
+	if err != nil || res == "" {
+		return nil, err
+	}
+	score, err := strconv.ParseFloat(res, 64)
+	if err != nil {
+		return nil, err
+	}
+	rank, err := l.rankOf(ctx, key, score)
+	if err != nil {
+		return nil, err
+	}
+	return &LeaderboardEntry{Member: member, Score: score, Rank: rank}, nil
+}
+
+// Top 返回前 n 名，与第 n 名分数相同的成员也一并返回，因此结果可能多于 n 个
+func (l *Leaderboard) Top(ctx *gin.Context, n int) ([]LeaderboardEntry, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	key := l.Key()
+	entries, err := l.rangeEntries(ctx, key, 0, n-1)
+	if err != nil || len(entries) < n {
+		return entries, err
+	}
+
+	last := entries[len(entries)-1]
+	score := formatScore(last.Score)
+	res, err := l.redis.ZRevRangeByScore(ctx, key, score, score, true, false, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	ties, err := parseEntries(res)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]struct{}, len(entries))
+	for _, e := range entries {
+		seen[e.Member] = struct{}{}
+	}
+	for _, e := range ties {
+		if _, ok := seen[e.Member]; ok {
+			continue
+		}
+		e.Rank = last.Rank
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// AroundMe 返回成员前后各 radius 名的窗口(包含成员自己)，成员不存在时返回nil
+func (l *Leaderboard) AroundMe(ctx *gin.Context, member string, radius int) ([]LeaderboardEntry, error) {
+	key := l.Key()
+	rank, err := l.redis.ZRevRank(ctx, key, member)
+	if err != nil || rank < 0 {
+		return nil, err
+	}
+	start := int(rank) - radius
+	if start < 0 {
+		start = 0
+	}
+	return l.rangeEntries(ctx, key, start, int(rank)+radius)
+}
+
+// Page 分页返回榜单，page 从1开始
+func (l *Leaderboard) Page(ctx *gin.Context, page, size int) ([]LeaderboardEntry, error) {
+	if page < 1 || size < 1 {
+		return nil, errors.New("leaderboard page and size must > 0")
+	}
+	start := (page - 1) * size
+	return l.rangeEntries(ctx, l.Key(), start, start+size-1)
+}
+
+// Aggregate 将 [from, to] 内每个周期的榜单按分数求和合并到 destKey，并在 expire 秒后过期(0表示不过期)
+// 如：由日榜合并出最近7天的榜单
+func (l *Leaderboard) Aggregate(ctx *gin.Context, destKey string, from, to time.Time, expire int64) (*Leaderboard, error) {
+	if l.period == PeriodNone {
+		return nil, errors.New("leaderboard without period can not be aggregated")
+	}
+	var keys []string
+	for t := from; !t.After(to); t = l.next(t) {
+		keys = append(keys, l.At(t).Key())
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("leaderboard aggregate range is empty")
+	}
+
+	if _, err := l.redis.ZUnionStore(ctx, destKey, keys, nil, "SUM"); err != nil {
+		return nil, err
+	}
+	if expire > 0 {
+		if _, err := l.redis.Expire(ctx, destKey, expire); err != nil {
+			return nil, err
+		}
+	}
+	return l.redis.NewLeaderboard(destKey), nil
+}
+
+// touch 为分桶榜单设置过期时间：周期结束后再保留 retain 个周期
+func (l *Leaderboard) touch(ctx *gin.Context, key string) error {
+	if l.period == PeriodNone {
+		return nil
+	}
+	end := l.next(l.now())
+	for i := 0; i < l.retain; i++ {
+		end = l.next(end)
+	}
+	_, err := l.redis.ExpireAt(ctx, key, end.Unix())
+	return err
+}
+
+// start 返回 t 所在周期的开始时间
+func (l *Leaderboard) start(t time.Time) time.Time {
+	t = t.In(l.loc)
+	switch l.period {
+	case PeriodDaily:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, l.loc)
+	case PeriodWeekly:
+		offset := (int(t.Weekday()) + 6) % 7
+		return time.Date(t.Year(), t.Month(), t.Day()-offset, 0, 0, 0, 0, l.loc)
+	case PeriodMonthly:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, l.loc)
+	default:
+		return t
+	}
+}
+
+// next 返回 t 所在周期的下一个周期的开始时间
+func (l *Leaderboard) next(t time.Time) time.Time {
+	s := l.start(t)
+	switch l.period {
+	case PeriodDaily:
+		return s.AddDate(0, 0, 1)
+	case PeriodWeekly:
+		return s.AddDate(0, 0, 7)
+	default:
+		return s.AddDate(0, 1, 0)
+	}
+}
+
+func (l *Leaderboard) rangeEntries(ctx *gin.Context, key string, start, stop int) ([]LeaderboardEntry, error) {
+	res, err := l.redis.ZRevRange(ctx, key, start, stop, true)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := parseEntries(res)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range entries {
+		switch {
+		case i > 0 && entries[i].Score == entries[i-1].Score:
+			entries[i].Rank = entries[i-1].Rank
+		case i > 0 || start == 0:
+			entries[i].Rank = int64(start + i + 1)
+		default:
+			if entries[i].Rank, err = l.rankOf(ctx, key, entries[i].Score); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return entries, nil
+}
+
+// rankOf 返回分数 score 的排名: 分数严格大于 score 的成员数量+1
+func (l *Leaderboard) rankOf(ctx *gin.Context, key string, score float64) (int64, error) {
+	higher, err := l.redis.ZCount(ctx, key, "("+formatScore(score), "+inf")
+	if err != nil {
+		return 0, err
+	}
+	return higher + 1, nil
+}
+
+// parseEntries 解析 WITHSCORES 返回的 member-score 列表
+func parseEntries(res [][]byte) ([]LeaderboardEntry, error) {
+	if len(res)%2 != 0 {
+		return nil, errors.New("zrange withscores err length")
+	}
+	entries := make([]LeaderboardEntry, 0, len(res)/2)
+	for i := 0; i < len(res); i += 2 {
+		score, err := strconv.ParseFloat(string(res[i+1]), 64)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, LeaderboardEntry{Member: string(res[i]), Score: score})
+	}
+	return entries, nil
+}
+
+func formatScore(score float64) string {
+	return strconv.FormatFloat(score, 'f', -1, 64)
+}
@@ -0,0 +1,100 @@
+package redis_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/derekAHua/goLib/redis"
+	"github.com/derekAHua/goLib/redis/redistest"
+	"github.com/derekAHua/goLib/zlog"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	redistest.Main(m, zlog.LogNameRedis)
+}
+
+func TestLeaderboard_Key(t *testing.T) {
+	// 2022-08-14 是周日，属于ISO第32周
+	day := time.Date(2022, 8, 14, 20, 0, 0, 0, time.UTC)
+	r := &redis.Redis{}
+
+	assert.Equal(t, "board", r.NewLeaderboard("board").At(day).Key())
+	daily := r.NewLeaderboard("daily", redis.WithLeaderboardPeriod(redis.PeriodDaily, 1), redis.WithLeaderboardLocation(time.UTC))
+	assert.Equal(t, "daily:20220814", daily.At(day).Key())
+	weekly := r.NewLeaderboard("weekly", redis.WithLeaderboardPeriod(redis.PeriodWeekly, 1), redis.WithLeaderboardLocation(time.UTC))
+	assert.Equal(t, "weekly:2022W32", weekly.At(day).Key())
+	assert.Equal(t, "weekly:2022W33", weekly.At(day.AddDate(0, 0, 1)).Key())
+	monthly := r.NewLeaderboard("monthly", redis.WithLeaderboardPeriod(redis.PeriodMonthly, 1), redis.WithLeaderboardLocation(time.UTC))
+	assert.Equal(t, "monthly:202208", monthly.At(day).Key())
+
+	// 周期按指定时区划分
+	cst := r.NewLeaderboard("daily", redis.WithLeaderboardPeriod(redis.PeriodDaily, 1), redis.WithLeaderboardLocation(time.FixedZone("CST", 8*3600)))
+	assert.Equal(t, "daily:20220815", cst.At(day).Key())
+}
+
+func TestLeaderboard_Top(t *testing.T) {
+	ctx := &gin.Context{}
+	r, _ := redistest.NewRedis(t)
+
+	board := r.NewLeaderboard("board")
+	for member, score := range map[string]float64{"a": 100, "b": 90, "c": 90, "d": 80, "e": 70} {
+		assert.Nil(t, board.SetScore(ctx, member, score))
+	}
+
+	top, err := board.Top(ctx, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, []redis.LeaderboardEntry{
+		{Member: "a", Score: 100, Rank: 1},
+		{Member: "c", Score: 90, Rank: 2},
+		{Member: "b", Score: 90, Rank: 2},
+	}, top)
+
+	around, err := board.AroundMe(ctx, "d", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []redis.LeaderboardEntry{
+		{Member: "b", Score: 90, Rank: 2},
+		{Member: "d", Score: 80, Rank: 4},
+		{Member: "e", Score: 70, Rank: 5},
+	}, around)
+
+	page, err := board.Page(ctx, 2, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, []redis.LeaderboardEntry{
+		{Member: "b", Score: 90, Rank: 2},
+		{Member: "d", Score: 80, Rank: 4},
+	}, page)
+
+	entry, err := board.Entry(ctx, "missing")
+	assert.Nil(t, err)
+	assert.Nil(t, entry)
+}
+
+func TestLeaderboard_Period(t *testing.T) {
+	ctx := &gin.Context{}
+	r, s := redistest.NewRedis(t)
+
+	day := time.Date(2022, 8, 14, 12, 0, 0, 0, time.UTC)
+	s.SetTime(day)
+	board := r.NewLeaderboard("daily", redis.WithLeaderboardPeriod(redis.PeriodDaily, 1), redis.WithLeaderboardLocation(time.UTC))
+
+	_, err := board.At(day).IncrScore(ctx, "a", 10)
+	assert.Nil(t, err)
+	_, err = board.At(day.AddDate(0, 0, 1)).IncrScore(ctx, "a", 5)
+	assert.Nil(t, err)
+	assert.Equal(t, "daily:20220814", board.At(day).Key())
+	// 当天结束后再保留1天
+	assert.Equal(t, 36*time.Hour, s.TTL("daily:20220814"))
+
+	total, err := board.Aggregate(ctx, "daily:total", day, day.AddDate(0, 0, 1), 60)
+	assert.Nil(t, err)
+	entry, err := total.Entry(ctx, "a")
+	assert.Nil(t, err)
+	assert.Equal(t, &redis.LeaderboardEntry{Member: "a", Score: 15, Rank: 1}, entry)
+
+	s.FastForward(37 * time.Hour)
+	count, err := board.At(day).Count(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), count)
+}
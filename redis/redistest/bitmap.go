@@ -0,0 +1,162 @@
+package redistest
+
+import (
+	"errors"
+	"math/bits"
+	"strings"
+)
+
+var (
+	errBitOffset = errors.New("ERR bit offset is not an integer or out of range")
+	errBitValue  = errors.New("ERR bit is not an integer or out of range")
+)
+
+// maxBitOffset redis 字符串最大512MB
+const maxBitOffset = int64(1)<<32 - 1
+
+func parseBitOffset(s string) (int64, error) {
+	n, err := parseInt(s)
+	if err != nil || n < 0 || n > maxBitOffset {
+		return 0, errBitOffset
+	}
+	return n, nil
+}
+
+// cmdSetBit SETBIT key offset value，第0位为第一个字节的最高位
+func cmdSetBit(s *Server, args []string) interface{} {
+	offset, err := parseBitOffset(args[1])
+	if err != nil {
+		return err
+	}
+	if args[2] != "0" && args[2] != "1" {
+		return errBitValue
+	}
+	v, _, err := s.getString(args[0])
+	if err != nil {
+		return err
+	}
+
+	buf := []byte(v)
+	idx := int(offset / 8)
+	if idx >= len(buf) {
+		buf = append(buf, make([]byte, idx+1-len(buf))...)
+	}
+	mask := byte(0x80) >> uint(offset%8)
+	old := int64(0)
+	if buf[idx]&mask != 0 {
+		old = 1
+	}
+	if args[2] == "1" {
+		buf[idx] |= mask
+	} else {
+		buf[idx] &^= mask
+	}
+	s.update(args[0], string(buf))
+	return old
+}
+
+func cmdGetBit(s *Server, args []string) interface{} {
+	offset, err := parseBitOffset(args[1])
+	if err != nil {
+		return err
+	}
+	v, _, err := s.getString(args[0])
+	if err != nil {
+		return err
+	}
+	idx := int(offset / 8)
+	if idx >= len(v) || v[idx]&(byte(0x80)>>uint(offset%8)) == 0 {
+		return int64(0)
+	}
+	return int64(1)
+}
+
+// cmdBitCount BITCOUNT key [start end]，start/end 为字节下标
+func cmdBitCount(s *Server, args []string) interface{} {
+	if len(args) != 1 && len(args) != 3 {
+		return errSyntax
+	}
+	v, _, err := s.getString(args[0])
+	if err != nil {
+		return err
+	}
+	if len(args) == 3 {
+		start, err := parseInt(args[1])
+		if err != nil {
+			return err
+		}
+		stop, err := parseInt(args[2])
+		if err != nil {
+			return err
+		}
+		from, to, ok := normalizeRange(start, stop, len(v))
+		if !ok {
+			return int64(0)
+		}
+		v = v[from:to]
+	}
+	var n int64
+	for i := 0; i < len(v); i++ {
+		n += int64(bits.OnesCount8(v[i]))
+	}
+	return n
+}
+
+// cmdBitOp BITOP AND|OR|XOR|NOT destkey key [key ...]，不存在的key视为空字符串，较短的字符串以0补齐
+func cmdBitOp(s *Server, args []string) interface{} {
+	op, dest, keys := strings.ToUpper(args[0]), args[1], args[2:]
+	switch op {
+	case "AND", "OR", "XOR":
+	case "NOT":
+		if len(keys) != 1 {
+			return errors.New("ERR BITOP NOT must be called with a single source key.")
+		}
+	default:
+		return errSyntax
+	}
+
+	values := make([]string, 0, len(keys))
+	size := 0
+	for _, key := range keys {
+		v, _, err := s.getString(key)
+		if err != nil {
+			return err
+		}
+		values = append(values, v)
+		if len(v) > size {
+			size = len(v)
+		}
+	}
+
+	res := make([]byte, size)
+	for i := 0; i < size; i++ {
+		at := func(v string) byte {
+			if i < len(v) {
+				return v[i]
+			}
+			return 0
+		}
+		b := at(values[0])
+		for _, v := range values[1:] {
+			switch op {
+			case "AND":
+				b &= at(v)
+			case "OR":
+				b |= at(v)
+			case "XOR":
+				b ^= at(v)
+			}
+		}
+		if op == "NOT" {
+			b = ^b
+		}
+		res[i] = b
+	}
+
+	if size == 0 {
+		delete(s.data, dest)
+		return int64(0)
+	}
+	s.set(dest, string(res))
+	return int64(size)
+}
@@ -0,0 +1,149 @@
+package redistest
+
+// command 命令的实现，arity 与redis一致：正数表示参数个数(含命令名)必须相等，负数表示至少为其绝对值
+type command struct {
+	fn    func(s *Server, args []string) interface{}
+	arity int
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		// connection
+		"PING":   {cmdPing, -1},
+		"ECHO":   {cmdEcho, 2},
+		"AUTH":   {cmdOK, -2},
+		"SELECT": {cmdOK, 2},
+		"QUIT":   {cmdOK, 1},
+
+		// keys
+		"DEL":       {cmdDel, -2},
+		"UNLINK":    {cmdDel, -2},
+		"EXISTS":    {cmdExists, -2},
+		"TYPE":      {cmdType, 2},
+		"EXPIRE":    {cmdExpire, 3},
+		"PEXPIRE":   {cmdPExpire, 3},
+		"EXPIREAT":  {cmdExpireAt, 3},
+		"PEXPIREAT": {cmdPExpireAt, 3},
+		"PERSIST":   {cmdPersist, 2},
+		"TTL":       {cmdTtl, 2},
+		"PTTL":      {cmdPTtl, 2},
+		"KEYS":      {cmdKeys, 2},
+		"SCAN":      {cmdScan, -2},
+		"DBSIZE":    {cmdDBSize, 1},
+		"FLUSHDB":   {cmdFlushAll, -1},
+		"FLUSHALL":  {cmdFlushAll, -1},
+
+		// strings
+		"GET":         {cmdGet, 2},
+		"SET":         {cmdSet, -3},
+		"SETNX":       {cmdSetNX, 3},
+		"SETEX":       {cmdSetEX, 4},
+		"GETSET":      {cmdGetSet, 3},
+		"MGET":        {cmdMGet, -2},
+		"MSET":        {cmdMSet, -3},
+		"APPEND":      {cmdAppend, 3},
+		"STRLEN":      {cmdStrLen, 2},
+		"INCR":        {cmdIncr, 2},
+		"DECR":        {cmdDecr, 2},
+		"INCRBY":      {cmdIncrBy, 3},
+		"DECRBY":      {cmdDecrBy, 3},
+		"INCRBYFLOAT": {cmdIncrByFloat, 3},
+
+		// bitmaps
+		"SETBIT":   {cmdSetBit, 4},
+		"GETBIT":   {cmdGetBit, 3},
+		"BITCOUNT": {cmdBitCount, -2},
+		"BITOP":    {cmdBitOp, -4},
+
+		// hashes
+		"HSET":         {cmdHSet, -4},
+		"HSETNX":       {cmdHSetNX, 4},
+		"HMSET":        {cmdHMSet, -4},
+		"HGET":         {cmdHGet, 3},
+		"HMGET":        {cmdHMGet, -3},
+		"HKEYS":        {cmdHKeys, 2},
+		"HVALS":        {cmdHVals, 2},
+		"HGETALL":      {cmdHGetAll, 2},
+		"HLEN":         {cmdHLen, 2},
+		"HEXISTS":      {cmdHExists, 3},
+		"HDEL":         {cmdHDel, -3},
+		"HINCRBY":      {cmdHIncrBy, 4},
+		"HINCRBYFLOAT": {cmdHIncrByFloat, 4},
+		"HSCAN":        {cmdHScan, -3},
+
+		// lists
+		"LPUSH":      {cmdLPush, -3},
+		"LPUSHX":     {cmdLPushX, -3},
+		"RPUSH":      {cmdRPush, -3},
+		"RPUSHX":     {cmdRPushX, -3},
+		"LPOP":       {cmdLPop, 2},
+		"RPOP":       {cmdRPop, 2},
+		"RPOPLPUSH":  {cmdRPopLPush, 3},
+		"LLEN":       {cmdLLen, 2},
+		"LINDEX":     {cmdLIndex, 3},
+		"LSET":       {cmdLSet, 4},
+		"LINSERT":    {cmdLInsert, 5},
+		"LRANGE":     {cmdLRange, 4},
+		"LTRIM":      {cmdLTrim, 4},
+		"LREM":       {cmdLRem, 4},
+		"BLPOP":      {cmdBLPop, -3},
+		"BRPOP":      {cmdBRPop, -3},
+		"BRPOPLPUSH": {cmdBRPopLPush, 4},
+
+		// sets
+		"SADD":        {cmdSAdd, -3},
+		"SISMEMBER":   {cmdSIsMember, 3},
+		"SMEMBERS":    {cmdSMembers, 2},
+		"SREM":        {cmdSRem, -3},
+		"SCARD":       {cmdSCard, 2},
+		"SMOVE":       {cmdSMove, 4},
+		"SPOP":        {cmdSPop, -2},
+		"SRANDMEMBER": {cmdSRandMember, -2},
+		"SINTER":      {cmdSInter, -2},
+		"SINTERSTORE": {cmdSInterStore, -3},
+		"SUNION":      {cmdSUnion, -2},
+		"SUNIONSTORE": {cmdSUnionStore, -3},
+		"SDIFF":       {cmdSDiff, -2},
+		"SDIFFSTORE":  {cmdSDiffStore, -3},
+		"SSCAN":       {cmdSScan, -3},
+
+		// sorted sets
+		"ZADD":             {cmdZAdd, -4},
+		"ZSCORE":           {cmdZScore, 3},
+		"ZINCRBY":          {cmdZIncrBy, 4},
+		"ZCARD":            {cmdZCard, 2},
+		"ZCOUNT":           {cmdZCount, 4},
+		"ZLEXCOUNT":        {cmdZLexCount, 4},
+		"ZRANGE":           {cmdZRange, -4},
+		"ZREVRANGE":        {cmdZRevRange, -4},
+		"ZRANGEBYSCORE":    {cmdZRangeByScore, -4},
+		"ZREVRANGEBYSCORE": {cmdZRevRangeByScore, -4},
+		"ZRANK":            {cmdZRank, 3},
+		"ZREVRANK":         {cmdZRevRank, 3},
+		"ZREM":             {cmdZRem, -3},
+		"ZREMRANGEBYRANK":  {cmdZRemRangeByRank, 4},
+		"ZREMRANGEBYSCORE": {cmdZRemRangeByScore, 4},
+		"ZREMRANGEBYLEX":   {cmdZRemRangeByLex, 4},
+		"ZUNIONSTORE":      {cmdZUnionStore, -4},
+		"ZINTERSTORE":      {cmdZInterStore, -4},
+		"ZSCAN":            {cmdZScan, -3},
+
+		// hyperloglog
+		"PFADD":   {cmdPFAdd, -2},
+		"PFCOUNT": {cmdPFCount, -2},
+		"PFMERGE": {cmdPFMerge, -2},
+
+		// geo
+		"GEOADD":    {cmdGeoAdd, -5},
+		"GEOPOS":    {cmdGeoPos, -2},
+		"GEODIST":   {cmdGeoDist, -4},
+		"GEOSEARCH": {cmdGeoSearch, -7},
+
+		// scripting
+		"EVAL":    {cmdEval, -3},
+		"EVALSHA": {cmdEvalSha, -3},
+		"SCRIPT":  {cmdScript, -2},
+	}
+}
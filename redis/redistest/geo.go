@@ -0,0 +1,353 @@
+package redistest
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 与redis一致：成员以52位geohash作为score保存在有序集中，经纬度取geohash格子的中心点
+const (
+	geoStep   = 26
+	geoLatMin = -85.05112878
+	geoLatMax = 85.05112878
+	geoLonMin = -180.0
+	geoLonMax = 180.0
+
+	earthRadiusInMeters = 6372797.560856
+)
+
+var errGeoUnit = errors.New("ERR unsupported unit provided. please use M, KM, FT, MI")
+
+func geoUnit(unit string) (float64, error) {
+	switch strings.ToLower(unit) {
+	case "m":
+		return 1, nil
+	case "km":
+		return 1000, nil
+	case "ft":
+		return 0.3048, nil
+	case "mi":
+		return 1609.34, nil
+	default:
+		return 0, errGeoUnit
+	}
+}
+
+// spread 将低32位的每一位间隔展开到偶数位
+func spread(v uint64) uint64 {
+	v &= 0xFFFFFFFF
+	v = (v | v<<16) & 0x0000FFFF0000FFFF
+	v = (v | v<<8) & 0x00FF00FF00FF00FF
+	v = (v | v<<4) & 0x0F0F0F0F0F0F0F0F
+	v = (v | v<<2) & 0x3333333333333333
+	v = (v | v<<1) & 0x5555555555555555
+	return v
+}
+
+// squash spread 的逆运算，取出偶数位
+func squash(v uint64) uint64 {
+	v &= 0x5555555555555555
+	v = (v | v>>1) & 0x3333333333333333
+	v = (v | v>>2) & 0x0F0F0F0F0F0F0F0F
+	v = (v | v>>4) & 0x00FF00FF00FF00FF
+	v = (v | v>>8) & 0x0000FFFF0000FFFF
+	v = (v | v>>16) & 0x00000000FFFFFFFF
+	return v
+}
+
+// geoEncode 纬度占偶数位，经度占奇数位
+func geoEncode(lon, lat float64) uint64 {
+	latOffset := uint64((lat - geoLatMin) / (geoLatMax - geoLatMin) * (1 << geoStep))
+	lonOffset := uint64((lon - geoLonMin) / (geoLonMax - geoLonMin) * (1 << geoStep))
+	if latOffset >= 1<<geoStep {
+		latOffset = 1<<geoStep - 1
+	}
+	if lonOffset >= 1<<geoStep {
+		lonOffset = 1<<geoStep - 1
+	}
+	return spread(latOffset) | spread(lonOffset)<<1
+}
+
+// geoDecode 返回geohash格子中心点的经纬度
+func geoDecode(hash uint64) (lon, lat float64) {
+	latCell := (geoLatMax - geoLatMin) / (1 << geoStep)
+	lonCell := (geoLonMax - geoLonMin) / (1 << geoStep)
+	lat = geoLatMin + (float64(squash(hash))+0.5)*latCell
+	lon = geoLonMin + (float64(squash(hash>>1))+0.5)*lonCell
+	return math.Max(geoLonMin, math.Min(geoLonMax, lon)), math.Max(geoLatMin, math.Min(geoLatMax, lat))
+}
+
+func degRad(d float64) float64 {
+	return d * math.Pi / 180
+}
+
+// geoDistance haversine 公式计算两点间的距离（米）
+func geoDistance(lon1, lat1, lon2, lat2 float64) float64 {
+	lat1r, lat2r := degRad(lat1), degRad(lat2)
+	u := math.Sin((lat2r - lat1r) / 2)
+	v := math.Sin((degRad(lon2) - degRad(lon1)) / 2)
+	return 2 * earthRadiusInMeters * math.Asin(math.Sqrt(u*u+math.Cos(lat1r)*math.Cos(lat2r)*v*v))
+}
+
+func parseLonLat(lonArg, latArg string) (float64, float64, error) {
+	lon, err := parseFloat(lonArg)
+	if err != nil {
+		return 0, 0, err
+	}
+	lat, err := parseFloat(latArg)
+	if err != nil {
+		return 0, 0, err
+	}
+	if lon < geoLonMin || lon > geoLonMax || lat < geoLatMin || lat > geoLatMax {
+		return 0, 0, fmt.Errorf("ERR invalid longitude,latitude pair %f,%f", lon, lat)
+	}
+	return lon, lat, nil
+}
+
+func formatCoord(lon, lat float64) []string {
+	return []string{strconv.FormatFloat(lon, 'f', -1, 64), strconv.FormatFloat(lat, 'f', -1, 64)}
+}
+
+func formatDist(d float64) string {
+	return strconv.FormatFloat(d, 'f', 4, 64)
+}
+
+// cmdGeoAdd GEOADD key [NX|XX] [CH] longitude latitude member [longitude latitude member ...]
+func cmdGeoAdd(s *Server, args []string) interface{} {
+	var (
+		opts []string
+		i    = 1
+	)
+	for ; i < len(args); i++ {
+		opt := strings.ToUpper(args[i])
+		if opt != "NX" && opt != "XX" && opt != "CH" {
+			break
+		}
+		opts = append(opts, opt)
+	}
+	triples := args[i:]
+	if len(triples) == 0 || len(triples)%3 != 0 {
+		return errSyntax
+	}
+
+	zadd := append([]string{args[0]}, opts...)
+	for j := 0; j < len(triples); j += 3 {
+		lon, lat, err := parseLonLat(triples[j], triples[j+1])
+		if err != nil {
+			return err
+		}
+		zadd = append(zadd, strconv.FormatUint(geoEncode(lon, lat), 10), triples[j+2])
+	}
+	return cmdZAdd(s, zadd)
+}
+
+func cmdGeoPos(s *Server, args []string) interface{} {
+	z, err := s.getZSet(args[0], false)
+	if err != nil {
+		return err
+	}
+	res := make([]interface{}, 0, len(args)-1)
+	for _, member := range args[1:] {
+		score, ok := z[member]
+		if !ok {
+			res = append(res, nullArray{})
+			continue
+		}
+		res = append(res, formatCoord(geoDecode(uint64(score))))
+	}
+	return res
+}
+
+// cmdGeoDist GEODIST key member1 member2 [M|KM|FT|MI]
+func cmdGeoDist(s *Server, args []string) interface{} {
+	if len(args) > 4 {
+		return errSyntax
+	}
+	unit := 1.0
+	if len(args) == 4 {
+		var err error
+		if unit, err = geoUnit(args[3]); err != nil {
+			return err
+		}
+	}
+	z, err := s.getZSet(args[0], false)
+	if err != nil {
+		return err
+	}
+	score1, ok1 := z[args[1]]
+	score2, ok2 := z[args[2]]
+	if !ok1 || !ok2 {
+		return nil
+	}
+	lon1, lat1 := geoDecode(uint64(score1))
+	lon2, lat2 := geoDecode(uint64(score2))
+	return formatDist(geoDistance(lon1, lat1, lon2, lat2) / unit)
+}
+
+// geoMatch GEOSEARCH 命中的成员
+type geoMatch struct {
+	member   string
+	hash     uint64
+	lon, lat float64
+	dist     float64
+}
+
+// cmdGeoSearch GEOSEARCH key FROMMEMBER member|FROMLONLAT longitude latitude
+// BYRADIUS radius unit|BYBOX width height unit [ASC|DESC] [COUNT count [ANY]] [WITHCOORD] [WITHDIST] [WITHHASH]
+func cmdGeoSearch(s *Server, args []string) interface{} {
+	var (
+		fromMember                    string
+		fromLonLat, byRadius, byBox   bool
+		lon, lat                      float64
+		radius, width, height, unit   float64
+		sortDir                       string
+		count                         int64
+		anyMatch                      bool
+		withCoord, withDist, withHash bool
+		err                           error
+	)
+	rest := args[1:]
+	need := func(n int) bool {
+		return len(rest) > n
+	}
+	for len(rest) > 0 {
+		opt := strings.ToUpper(rest[0])
+		switch {
+		case opt == "FROMMEMBER" && need(1):
+			fromMember = rest[1]
+			rest = rest[2:]
+		case opt == "FROMLONLAT" && need(2):
+			if lon, lat, err = parseLonLat(rest[1], rest[2]); err != nil {
+				return err
+			}
+			fromLonLat = true
+			rest = rest[3:]
+		case opt == "BYRADIUS" && need(2):
+			if radius, err = parseFloat(rest[1]); err != nil {
+				return err
+			}
+			if unit, err = geoUnit(rest[2]); err != nil {
+				return err
+			}
+			byRadius = true
+			rest = rest[3:]
+		case opt == "BYBOX" && need(3):
+			if width, err = parseFloat(rest[1]); err != nil {
+				return err
+			}
+			if height, err = parseFloat(rest[2]); err != nil {
+				return err
+			}
+			if unit, err = geoUnit(rest[3]); err != nil {
+				return err
+			}
+			byBox = true
+			rest = rest[4:]
+		case opt == "ASC" || opt == "DESC":
+			sortDir = opt
+			rest = rest[1:]
+		case opt == "COUNT" && need(1):
+			if count, err = parseInt(rest[1]); err != nil {
+				return err
+			}
+			if count <= 0 {
+				return errors.New("ERR COUNT must be > 0")
+			}
+			rest = rest[2:]
+		case opt == "ANY":
+			anyMatch = true
+			rest = rest[1:]
+		case opt == "WITHCOORD":
+			withCoord = true
+			rest = rest[1:]
+		case opt == "WITHDIST":
+			withDist = true
+			rest = rest[1:]
+		case opt == "WITHHASH":
+			withHash = true
+			rest = rest[1:]
+		default:
+			return errSyntax
+		}
+	}
+	if (fromMember == "") == !fromLonLat {
+		return errors.New("ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for geosearch")
+	}
+	if byRadius == byBox {
+		return errors.New("ERR exactly one of BYRADIUS and BYBOX can be specified for geosearch")
+	}
+	if anyMatch && count == 0 {
+		return errors.New("ERR the ANY argument requires COUNT argument")
+	}
+
+	z, err := s.getZSet(args[0], false)
+	if err != nil {
+		return err
+	}
+	if fromMember != "" {
+		score, ok := z[fromMember]
+		if !ok {
+			return errors.New("ERR could not decode requested zset member")
+		}
+		lon, lat = geoDecode(uint64(score))
+	}
+
+	var matches []geoMatch
+	for _, e := range z.sorted() {
+		m := geoMatch{member: e.member, hash: uint64(e.score)}
+		m.lon, m.lat = geoDecode(m.hash)
+		m.dist = geoDistance(lon, lat, m.lon, m.lat)
+		if byRadius && m.dist > radius*unit {
+			continue
+		}
+		// 与redis一致：纬度方向按经线距离，经度方向按成员所在纬度的距离判断是否在矩形内
+		if byBox && (earthRadiusInMeters*math.Abs(degRad(m.lat)-degRad(lat)) > height*unit/2 ||
+			geoDistance(lon, m.lat, m.lon, m.lat) > width*unit/2) {
+			continue
+		}
+		matches = append(matches, m)
+		if anyMatch && int64(len(matches)) == count {
+			break
+		}
+	}
+
+	// 指定 COUNT 而没有 ANY 时返回最近的成员
+	if sortDir == "" && count > 0 && !anyMatch {
+		sortDir = "ASC"
+	}
+	if sortDir != "" {
+		sort.SliceStable(matches, func(i, j int) bool {
+			if sortDir == "DESC" {
+				return matches[i].dist > matches[j].dist
+			}
+			return matches[i].dist < matches[j].dist
+		})
+	}
+	if count > 0 && int64(len(matches)) > count {
+		matches = matches[:count]
+	}
+
+	res := make([]interface{}, 0, len(matches))
+	for _, m := range matches {
+		if !withCoord && !withDist && !withHash {
+			res = append(res, m.member)
+			continue
+		}
+		entry := []interface{}{m.member}
+		if withDist {
+			entry = append(entry, formatDist(m.dist/unit))
+		}
+		if withHash {
+			entry = append(entry, int64(m.hash))
+		}
+		if withCoord {
+			entry = append(entry, formatCoord(m.lon, m.lat))
+		}
+		res = append(res, entry)
+	}
+	return res
+}
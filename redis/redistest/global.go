@@ -0,0 +1,204 @@
+package redistest
+
+import (
+	"strings"
+	"time"
+)
+
+func typeName(v interface{}) string {
+	switch v.(type) {
+	case string, hllValue:
+		return "string"
+	case hashValue:
+		return "hash"
+	case *listValue:
+		return "list"
+	case setValue:
+		return "set"
+	case zsetValue:
+		return "zset"
+	default:
+		return "none"
+	}
+}
+
+// cleanup 删除已经为空的集合类型key
+func (s *Server) cleanup(key string) {
+	it := s.get(key)
+	if it == nil {
+		return
+	}
+	empty := false
+	switch v := it.value.(type) {
+	case hashValue:
+		empty = len(v) == 0
+	case *listValue:
+		empty = len(v.items) == 0
+	case setValue:
+		empty = len(v) == 0
+	case zsetValue:
+		empty = len(v) == 0
+	}
+	if empty {
+		delete(s.data, key)
+	}
+}
+
+func cmdPing(s *Server, args []string) interface{} {
+	if len(args) > 0 {
+		return args[0]
+	}
+	return status("PONG")
+}
+
+func cmdOK(s *Server, args []string) interface{} {
+	return status("OK")
+}
+
+func cmdEcho(s *Server, args []string) interface{} {
+	return args[0]
+}
+
+func cmdDel(s *Server, args []string) interface{} {
+	var n int64
+	for _, key := range args {
+		if s.get(key) != nil {
+			delete(s.data, key)
+			n++
+		}
+	}
+	return n
+}
+
+func cmdExists(s *Server, args []string) interface{} {
+	var n int64
+	for _, key := range args {
+		if s.get(key) != nil {
+			n++
+		}
+	}
+	return n
+}
+
+func cmdType(s *Server, args []string) interface{} {
+	it := s.get(args[0])
+	if it == nil {
+		return status("none")
+	}
+	return status(typeName(it.value))
+}
+
+func (s *Server) expireAt(key string, at time.Time) interface{} {
+	it := s.get(key)
+	if it == nil {
+		return int64(0)
+	}
+	if !at.After(s.now()) {
+		delete(s.data, key)
+		return int64(1)
+	}
+	it.expireAt = at
+	return int64(1)
+}
+
+func cmdExpire(s *Server, args []string) interface{} {
+	n, err := parseInt(args[1])
+	if err != nil {
+		return err
+	}
+	return s.expireAt(args[0], s.now().Add(time.Duration(n)*time.Second))
+}
+
+func cmdPExpire(s *Server, args []string) interface{} {
+	n, err := parseInt(args[1])
+	if err != nil {
+		return err
+	}
+	return s.expireAt(args[0], s.now().Add(time.Duration(n)*time.Millisecond))
+}
+
+func cmdExpireAt(s *Server, args []string) interface{} {
+	n, err := parseInt(args[1])
+	if err != nil {
+		return err
+	}
+	return s.expireAt(args[0], time.Unix(n, 0))
+}
+
+func cmdPExpireAt(s *Server, args []string) interface{} {
+	n, err := parseInt(args[1])
+	if err != nil {
+		return err
+	}
+	return s.expireAt(args[0], time.Unix(0, n*int64(time.Millisecond)))
+}
+
+func cmdPersist(s *Server, args []string) interface{} {
+	it := s.get(args[0])
+	if it == nil || it.expireAt.IsZero() {
+		return int64(0)
+	}
+	it.expireAt = time.Time{}
+	return int64(1)
+}
+
+func (s *Server) ttl(key string, unit time.Duration) interface{} {
+	it := s.get(key)
+	if it == nil {
+		return int64(-2)
+	}
+	if it.expireAt.IsZero() {
+		return int64(-1)
+	}
+	d := it.expireAt.Sub(s.now())
+	// 与redis一致，TTL 向上取整
+	return int64((d + unit - 1) / unit)
+}
+
+func cmdTtl(s *Server, args []string) interface{} {
+	return s.ttl(args[0], time.Second)
+}
+
+func cmdPTtl(s *Server, args []string) interface{} {
+	return s.ttl(args[0], time.Millisecond)
+}
+
+func cmdKeys(s *Server, args []string) interface{} {
+	res := make([]string, 0)
+	for _, k := range s.keys() {
+		if matchGlob(args[0], k) {
+			res = append(res, k)
+		}
+	}
+	return res
+}
+
+func cmdScan(s *Server, args []string) interface{} {
+	typ := ""
+	for i := 1; i+1 < len(args); i++ {
+		if strings.ToUpper(args[i]) == "TYPE" {
+			typ = strings.ToLower(args[i+1])
+		}
+	}
+	var filter func(string) bool
+	if typ != "" {
+		filter = func(k string) bool {
+			it := s.get(k)
+			return it != nil && typeName(it.value) == typ
+		}
+	}
+	cursor, page, err := scanPage(s.keys(), args, filter)
+	if err != nil {
+		return err
+	}
+	return []interface{}{cursor, page}
+}
+
+func cmdDBSize(s *Server, args []string) interface{} {
+	return int64(len(s.keys()))
+}
+
+func cmdFlushAll(s *Server, args []string) interface{} {
+	s.data = make(map[string]*item)
+	return status("OK")
+}
@@ -0,0 +1,222 @@
+package redistest
+
+import "sort"
+
+type hashValue map[string]string
+
+// getHash 返回哈希表，key不存在且 create 为true时创建新的哈希表
+func (s *Server) getHash(key string, create bool) (hashValue, error) {
+	it := s.get(key)
+	if it == nil {
+		if !create {
+			return nil, nil
+		}
+		h := make(hashValue)
+		s.set(key, h)
+		return h, nil
+	}
+	h, ok := it.value.(hashValue)
+	if !ok {
+		return nil, errWrongType
+	}
+	return h, nil
+}
+
+func cmdHSet(s *Server, args []string) interface{} {
+	if len(args)%2 != 1 {
+		return errWrongArgs("hset")
+	}
+	h, err := s.getHash(args[0], true)
+	if err != nil {
+		return err
+	}
+	var n int64
+	for i := 1; i < len(args); i += 2 {
+		if _, ok := h[args[i]]; !ok {
+			n++
+		}
+		h[args[i]] = args[i+1]
+	}
+	return n
+}
+
+func cmdHSetNX(s *Server, args []string) interface{} {
+	h, err := s.getHash(args[0], true)
+	if err != nil {
+		return err
+	}
+	if _, ok := h[args[1]]; ok {
+		return int64(0)
+	}
+	h[args[1]] = args[2]
+	return int64(1)
+}
+
+func cmdHMSet(s *Server, args []string) interface{} {
+	if r := cmdHSet(s, args); isError(r) {
+		return r
+	}
+	return status("OK")
+}
+
+func cmdHGet(s *Server, args []string) interface{} {
+	h, err := s.getHash(args[0], false)
+	if err != nil {
+		return err
+	}
+	v, ok := h[args[1]]
+	if !ok {
+		return nil
+	}
+	return v
+}
+
+func cmdHMGet(s *Server, args []string) interface{} {
+	h, err := s.getHash(args[0], false)
+	if err != nil {
+		return err
+	}
+	res := make([]interface{}, 0, len(args)-1)
+	for _, f := range args[1:] {
+		if v, ok := h[f]; ok {
+			res = append(res, v)
+		} else {
+			res = append(res, nil)
+		}
+	}
+	return res
+}
+
+func cmdHKeys(s *Server, args []string) interface{} {
+	h, err := s.getHash(args[0], false)
+	if err != nil {
+		return err
+	}
+	res := make([]string, 0, len(h))
+	for f := range h {
+		res = append(res, f)
+	}
+	sort.Strings(res)
+	return res
+}
+
+func cmdHVals(s *Server, args []string) interface{} {
+	h, err := s.getHash(args[0], false)
+	if err != nil {
+		return err
+	}
+	fields := cmdHKeys(s, args).([]string)
+	res := make([]string, 0, len(h))
+	for _, f := range fields {
+		res = append(res, h[f])
+	}
+	return res
+}
+
+func cmdHGetAll(s *Server, args []string) interface{} {
+	h, err := s.getHash(args[0], false)
+	if err != nil {
+		return err
+	}
+	fields := cmdHKeys(s, args).([]string)
+	res := make([]string, 0, 2*len(h))
+	for _, f := range fields {
+		res = append(res, f, h[f])
+	}
+	return res
+}
+
+func cmdHLen(s *Server, args []string) interface{} {
+	h, err := s.getHash(args[0], false)
+	if err != nil {
+		return err
+	}
+	return int64(len(h))
+}
+
+func cmdHExists(s *Server, args []string) interface{} {
+	h, err := s.getHash(args[0], false)
+	if err != nil {
+		return err
+	}
+	if _, ok := h[args[1]]; ok {
+		return int64(1)
+	}
+	return int64(0)
+}
+
+func cmdHDel(s *Server, args []string) interface{} {
+	h, err := s.getHash(args[0], false)
+	if err != nil {
+		return err
+	}
+	var n int64
+	for _, f := range args[1:] {
+		if _, ok := h[f]; ok {
+			delete(h, f)
+			n++
+		}
+	}
+	s.cleanup(args[0])
+	return n
+}
+
+func cmdHIncrBy(s *Server, args []string) interface{} {
+	delta, err := parseInt(args[2])
+	if err != nil {
+		return err
+	}
+	h, err := s.getHash(args[0], true)
+	if err != nil {
+		return err
+	}
+	var n int64
+	if v, ok := h[args[1]]; ok {
+		if n, err = parseInt(v); err != nil {
+			return errNotInt
+		}
+	}
+	n += delta
+	h[args[1]] = formatInt(n)
+	return n
+}
+
+func cmdHIncrByFloat(s *Server, args []string) interface{} {
+	delta, err := parseFloat(args[2])
+	if err != nil {
+		return err
+	}
+	h, err := s.getHash(args[0], true)
+	if err != nil {
+		return err
+	}
+	var f float64
+	if v, ok := h[args[1]]; ok {
+		if f, err = parseFloat(v); err != nil {
+			return err
+		}
+	}
+	res := formatFloat(f + delta)
+	h[args[1]] = res
+	return res
+}
+
+func cmdHScan(s *Server, args []string) interface{} {
+	h, err := s.getHash(args[0], false)
+	if err != nil {
+		return err
+	}
+	fields := make([]string, 0, len(h))
+	for f := range h {
+		fields = append(fields, f)
+	}
+	cursor, page, err := scanPage(fields, args[1:], nil)
+	if err != nil {
+		return err
+	}
+	res := make([]string, 0, 2*len(page))
+	for _, f := range page {
+		res = append(res, f, h[f])
+	}
+	return []interface{}{cursor, res}
+}
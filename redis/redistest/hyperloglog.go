@@ -0,0 +1,83 @@
+package redistest
+
+import "errors"
+
+// hllValue HyperLogLog 的值，与redis不同，记录全部元素，PFCOUNT 返回精确的基数
+type hllValue map[string]struct{}
+
+var errNotHll = errors.New("WRONGTYPE Key is not a valid HyperLogLog string value.")
+
+// getHll 返回 HyperLogLog，key不存在且 create 为true时创建
+func (s *Server) getHll(key string, create bool) (hllValue, error) {
+	it := s.get(key)
+	if it == nil {
+		if !create {
+			return nil, nil
+		}
+		h := make(hllValue)
+		s.set(key, h)
+		return h, nil
+	}
+	h, ok := it.value.(hllValue)
+	if !ok {
+		return nil, errNotHll
+	}
+	return h, nil
+}
+
+// cmdPFAdd PFADD key [element ...]，key 被创建或有新元素时返回1
+func cmdPFAdd(s *Server, args []string) interface{} {
+	created := s.get(args[0]) == nil
+	h, err := s.getHll(args[0], true)
+	if err != nil {
+		return err
+	}
+	changed := created
+	for _, e := range args[1:] {
+		if _, ok := h[e]; !ok {
+			h[e] = struct{}{}
+			changed = true
+		}
+	}
+	if changed {
+		return int64(1)
+	}
+	return int64(0)
+}
+
+// union 合并多个 HyperLogLog 的元素
+func (s *Server) union(keys []string) (hllValue, error) {
+	res := make(hllValue)
+	for _, key := range keys {
+		h, err := s.getHll(key, false)
+		if err != nil {
+			return nil, err
+		}
+		for e := range h {
+			res[e] = struct{}{}
+		}
+	}
+	return res, nil
+}
+
+func cmdPFCount(s *Server, args []string) interface{} {
+	h, err := s.union(args)
+	if err != nil {
+		return err
+	}
+	return int64(len(h))
+}
+
+// cmdPFMerge PFMERGE destkey [sourcekey ...]，destkey 原有的元素会保留
+func cmdPFMerge(s *Server, args []string) interface{} {
+	h, err := s.union(args)
+	if err != nil {
+		return err
+	}
+	if it := s.get(args[0]); it != nil {
+		it.value = h
+	} else {
+		s.set(args[0], h)
+	}
+	return status("OK")
+}
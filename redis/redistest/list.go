@@ -0,0 +1,337 @@
+package redistest
+
+import (
+	"strings"
+	"time"
+)
+
+type listValue struct {
+	items []string
+}
+
+// getList 返回列表，key不存在且 create 为true时创建新的列表
+func (s *Server) getList(key string, create bool) (*listValue, error) {
+	it := s.get(key)
+	if it == nil {
+		if !create {
+			return nil, nil
+		}
+		l := &listValue{}
+		s.set(key, l)
+		return l, nil
+	}
+	l, ok := it.value.(*listValue)
+	if !ok {
+		return nil, errWrongType
+	}
+	return l, nil
+}
+
+func (s *Server) push(args []string, left, onlyExists bool) interface{} {
+	if onlyExists && s.get(args[0]) == nil {
+		return int64(0)
+	}
+	l, err := s.getList(args[0], true)
+	if err != nil {
+		return err
+	}
+	for _, v := range args[1:] {
+		if left {
+			l.items = append([]string{v}, l.items...)
+		} else {
+			l.items = append(l.items, v)
+		}
+	}
+	return int64(len(l.items))
+}
+
+func cmdLPush(s *Server, args []string) interface{} {
+	return s.push(args, true, false)
+}
+
+func cmdLPushX(s *Server, args []string) interface{} {
+	return s.push(args, true, true)
+}
+
+func cmdRPush(s *Server, args []string) interface{} {
+	return s.push(args, false, false)
+}
+
+func cmdRPushX(s *Server, args []string) interface{} {
+	return s.push(args, false, true)
+}
+
+// pop 弹出列表的头/尾元素，列表不存在或为空时返回nil
+func (s *Server) pop(key string, left bool) (interface{}, error) {
+	l, err := s.getList(key, false)
+	if err != nil || l == nil || len(l.items) == 0 {
+		return nil, err
+	}
+	var v string
+	if left {
+		v, l.items = l.items[0], l.items[1:]
+	} else {
+		v, l.items = l.items[len(l.items)-1], l.items[:len(l.items)-1]
+	}
+	s.cleanup(key)
+	return v, nil
+}
+
+func cmdLPop(s *Server, args []string) interface{} {
+	v, err := s.pop(args[0], true)
+	if err != nil {
+		return err
+	}
+	return v
+}
+
+func cmdRPop(s *Server, args []string) interface{} {
+	v, err := s.pop(args[0], false)
+	if err != nil {
+		return err
+	}
+	return v
+}
+
+func cmdRPopLPush(s *Server, args []string) interface{} {
+	if _, err := s.getList(args[1], false); err != nil {
+		return err
+	}
+	v, err := s.pop(args[0], false)
+	if err != nil || v == nil {
+		return err
+	}
+	s.push([]string{args[1], v.(string)}, true, false)
+	return v
+}
+
+func cmdLLen(s *Server, args []string) interface{} {
+	l, err := s.getList(args[0], false)
+	if err != nil {
+		return err
+	}
+	if l == nil {
+		return int64(0)
+	}
+	return int64(len(l.items))
+}
+
+func cmdLIndex(s *Server, args []string) interface{} {
+	idx, err := parseInt(args[1])
+	if err != nil {
+		return err
+	}
+	l, err := s.getList(args[0], false)
+	if err != nil || l == nil {
+		return err
+	}
+	if idx < 0 {
+		idx += int64(len(l.items))
+	}
+	if idx < 0 || idx >= int64(len(l.items)) {
+		return nil
+	}
+	return l.items[idx]
+}
+
+func cmdLSet(s *Server, args []string) interface{} {
+	idx, err := parseInt(args[1])
+	if err != nil {
+		return err
+	}
+	l, err := s.getList(args[0], false)
+	if err != nil {
+		return err
+	}
+	if l == nil {
+		return errNoSuchKey
+	}
+	if idx < 0 {
+		idx += int64(len(l.items))
+	}
+	if idx < 0 || idx >= int64(len(l.items)) {
+		return errOutRange
+	}
+	l.items[idx] = args[2]
+	return status("OK")
+}
+
+func cmdLInsert(s *Server, args []string) interface{} {
+	where := strings.ToUpper(args[1])
+	if where != "BEFORE" && where != "AFTER" {
+		return errSyntax
+	}
+	l, err := s.getList(args[0], false)
+	if err != nil {
+		return err
+	}
+	if l == nil {
+		return int64(0)
+	}
+	for i, v := range l.items {
+		if v != args[2] {
+			continue
+		}
+		if where == "AFTER" {
+			i++
+		}
+		l.items = append(l.items[:i], append([]string{args[3]}, l.items[i:]...)...)
+		return int64(len(l.items))
+	}
+	return int64(-1)
+}
+
+func cmdLRange(s *Server, args []string) interface{} {
+	start, err := parseInt(args[1])
+	if err != nil {
+		return err
+	}
+	stop, err := parseInt(args[2])
+	if err != nil {
+		return err
+	}
+	l, err := s.getList(args[0], false)
+	if err != nil {
+		return err
+	}
+	if l == nil {
+		return []string{}
+	}
+	from, to, ok := normalizeRange(start, stop, len(l.items))
+	if !ok {
+		return []string{}
+	}
+	return append([]string(nil), l.items[from:to]...)
+}
+
+func cmdLTrim(s *Server, args []string) interface{} {
+	start, err := parseInt(args[1])
+	if err != nil {
+		return err
+	}
+	stop, err := parseInt(args[2])
+	if err != nil {
+		return err
+	}
+	l, err := s.getList(args[0], false)
+	if err != nil {
+		return err
+	}
+	if l == nil {
+		return status("OK")
+	}
+	from, to, ok := normalizeRange(start, stop, len(l.items))
+	if ok {
+		l.items = append([]string(nil), l.items[from:to]...)
+	} else {
+		l.items = nil
+	}
+	s.cleanup(args[0])
+	return status("OK")
+}
+
+// cmdLRem LREM key count value
+func cmdLRem(s *Server, args []string) interface{} {
+	count, err := parseInt(args[1])
+	if err != nil {
+		return err
+	}
+	l, err := s.getList(args[0], false)
+	if err != nil {
+		return err
+	}
+	if l == nil {
+		return int64(0)
+	}
+
+	var removed int64
+	keep := make([]string, len(l.items))
+	copy(keep, l.items)
+	match := func(i int) bool {
+		if keep[i] != args[2] || (count != 0 && removed >= abs(count)) {
+			return false
+		}
+		removed++
+		return true
+	}
+	var res []string
+	if count >= 0 {
+		for i := range keep {
+			if !match(i) {
+				res = append(res, keep[i])
+			}
+		}
+	} else {
+		for i := len(keep) - 1; i >= 0; i-- {
+			if !match(i) {
+				res = append([]string{keep[i]}, res...)
+			}
+		}
+	}
+	l.items = res
+	s.cleanup(args[0])
+	return removed
+}
+
+// blockingPop BLPOP/BRPOP key [key ...] timeout
+func (s *Server) blockingPop(args []string, left bool) interface{} {
+	timeout, err := parseFloat(args[len(args)-1])
+	if err != nil || timeout < 0 {
+		return errorTimeout
+	}
+	keys := args[:len(args)-1]
+	try := func() interface{} {
+		for _, key := range keys {
+			v, err := s.pop(key, left)
+			if err != nil {
+				return err
+			}
+			if v != nil {
+				return []interface{}{key, v}
+			}
+		}
+		return nil
+	}
+	if r := try(); r != nil {
+		return r
+	}
+	return s.block(try, timeout)
+}
+
+func cmdBLPop(s *Server, args []string) interface{} {
+	return s.blockingPop(args, true)
+}
+
+func cmdBRPop(s *Server, args []string) interface{} {
+	return s.blockingPop(args, false)
+}
+
+func cmdBRPopLPush(s *Server, args []string) interface{} {
+	timeout, err := parseFloat(args[2])
+	if err != nil || timeout < 0 {
+		return errorTimeout
+	}
+	try := func() interface{} {
+		return cmdRPopLPush(s, args[:2])
+	}
+	if r := try(); r != nil {
+		return r
+	}
+	return s.block(try, timeout)
+}
+
+// block 返回阻塞标记，timeout 为秒，0表示一直阻塞
+func (s *Server) block(try func() interface{}, timeout float64) interface{} {
+	b := &blocked{retry: try}
+	if timeout > 0 {
+		b.deadline = time.Now().Add(time.Duration(timeout * float64(time.Second)))
+	}
+	return b
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,220 @@
+package redistest
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// ScriptFunc 用Go实现的脚本，用于替代内置解释器不支持的lua脚本
+// call 在脚本内执行redis命令，返回值约定与命令返回一致: int64, string, nil, []interface{}/[]string, error
+type ScriptFunc func(call func(args ...string) interface{}, keys, argv []string) interface{}
+
+// Script 注册与脚本 src 对应的Go实现，EVAL/EVALSHA 执行该脚本时调用 fn
+func (s *Server) Script(src string, fn ScriptFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sha := scriptSha(src)
+	s.scripts[sha] = src
+	s.handlers[sha] = fn
+}
+
+func scriptSha(src string) string {
+	sum := sha1.Sum([]byte(src))
+	return hex.EncodeToString(sum[:])
+}
+
+func cmdEval(s *Server, args []string) interface{} {
+	sha := scriptSha(args[0])
+	s.scripts[sha] = args[0]
+	return s.eval(sha, args[1:])
+}
+
+func cmdEvalSha(s *Server, args []string) interface{} {
+	sha := strings.ToLower(args[0])
+	if _, ok := s.scripts[sha]; !ok {
+		return errors.New("NOSCRIPT No matching script. Please use EVAL.")
+	}
+	return s.eval(sha, args[1:])
+}
+
+// cmdScript SCRIPT LOAD|EXISTS|FLUSH
+func cmdScript(s *Server, args []string) interface{} {
+	switch strings.ToUpper(args[0]) {
+	case "LOAD":
+		if len(args) != 2 {
+			return errWrongArgs("script|load")
+		}
+		sha := scriptSha(args[1])
+		s.scripts[sha] = args[1]
+		return sha
+	case "EXISTS":
+		res := make([]interface{}, 0, len(args)-1)
+		for _, sha := range args[1:] {
+			if _, ok := s.scripts[strings.ToLower(sha)]; ok {
+				res = append(res, int64(1))
+			} else {
+				res = append(res, int64(0))
+			}
+		}
+		return res
+	case "FLUSH":
+		// 通过 Server.Script 注册的Go实现保留，EVAL 时重新加载脚本即可
+		s.scripts = make(map[string]string)
+		return status("OK")
+	default:
+		return errSyntax
+	}
+}
+
+func (s *Server) eval(sha string, args []string) interface{} {
+	n, err := parseInt(args[0])
+	if err != nil {
+		return err
+	}
+	if n < 0 || n > int64(len(args)-1) {
+		return errors.New("ERR Number of keys can't be greater than number of args")
+	}
+	keys, argv := args[1:1+n], args[1+n:]
+
+	call := func(cmd ...string) interface{} {
+		if len(cmd) == 0 {
+			return errors.New("ERR Please specify at least one argument for redis.call()")
+		}
+		r := s.call(cmd)
+		if _, ok := r.(*blocked); ok {
+			return nullArray{}
+		}
+		return r
+	}
+	if fn, ok := s.handlers[sha]; ok {
+		return fn(call, keys, argv)
+	}
+	return runScript(s.scripts[sha], call, keys, argv)
+}
+
+// runScript 解释执行只包含顺序语句的简单lua脚本，支持的语句:
+//  redis.call('CMD', KEYS[1], ARGV[1], 'literal', 1)
+//  return redis.call(...)
+//  return 1 / return 'str' / return KEYS[1] / return ARGV[1]
+// 包含条件、循环等语句的脚本需要通过 Server.Script 注册Go实现
+func runScript(src string, call func(args ...string) interface{}, keys, argv []string) interface{} {
+	for _, stmt := range splitStatements(src) {
+		ret := false
+		if strings.HasPrefix(stmt, "return ") {
+			ret = true
+			stmt = strings.TrimSpace(strings.TrimPrefix(stmt, "return "))
+		}
+
+		var r interface{}
+		if inner, ok := callArgs(stmt); ok {
+			args := make([]string, 0, len(inner))
+			for _, a := range inner {
+				v, err := evalExpr(a, keys, argv)
+				if err != nil {
+					return err
+				}
+				args = append(args, v)
+			}
+			r = call(args...)
+			if err, ok := r.(error); ok {
+				return errors.New("ERR Error running script: " + err.Error())
+			}
+		} else if ret {
+			if n, err := strconv.ParseInt(stmt, 10, 64); err == nil {
+				r = n
+			} else {
+				v, err := evalExpr(stmt, keys, argv)
+				if err != nil {
+					return err
+				}
+				r = v
+			}
+		} else {
+			return errors.New("ERR unsupported script statement: " + stmt)
+		}
+
+		if ret {
+			return r
+		}
+	}
+	return nil
+}
+
+// splitStatements 按换行和分号拆分语句，忽略注释和空行
+func splitStatements(src string) []string {
+	var res []string
+	for _, line := range strings.Split(src, "\n") {
+		if i := strings.Index(line, "--"); i >= 0 {
+			line = line[:i]
+		}
+		for _, stmt := range splitTopLevel(line, ';') {
+			if stmt = strings.TrimSpace(stmt); stmt != "" {
+				res = append(res, stmt)
+			}
+		}
+	}
+	return res
+}
+
+// callArgs 解析 redis.call(...)/redis.pcall(...)，返回括号内的参数表达式
+func callArgs(stmt string) ([]string, bool) {
+	for _, prefix := range []string{"redis.call(", "redis.pcall("} {
+		if strings.HasPrefix(stmt, prefix) && strings.HasSuffix(stmt, ")") {
+			return splitTopLevel(stmt[len(prefix):len(stmt)-1], ','), true
+		}
+	}
+	return nil, false
+}
+
+// evalExpr 计算参数表达式: 字符串字面量、数字、KEYS[n]、ARGV[n]
+func evalExpr(expr string, keys, argv []string) (string, error) {
+	expr = strings.TrimSpace(expr)
+	if len(expr) >= 2 && (expr[0] == '\'' || expr[0] == '"') && expr[len(expr)-1] == expr[0] {
+		return expr[1 : len(expr)-1], nil
+	}
+	if _, err := strconv.ParseFloat(expr, 64); err == nil {
+		return expr, nil
+	}
+	for name, values := range map[string][]string{"KEYS": keys, "ARGV": argv} {
+		if strings.HasPrefix(expr, name+"[") && strings.HasSuffix(expr, "]") {
+			i, err := strconv.Atoi(expr[len(name)+1 : len(expr)-1])
+			if err != nil || i < 1 || i > len(values) {
+				return "", errors.New("ERR script index out of range: " + expr)
+			}
+			return values[i-1], nil
+		}
+	}
+	return "", errors.New("ERR unsupported script expression: " + expr)
+}
+
+// splitTopLevel 按分隔符拆分，忽略引号和括号内的分隔符
+func splitTopLevel(s string, sep byte) []string {
+	var (
+		res   []string
+		depth int
+		quote byte
+		start int
+	)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(' || c == '[':
+			depth++
+		case c == ')' || c == ']':
+			depth--
+		case c == sep && depth == 0:
+			res = append(res, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(res, s[start:])
+}
@@ -0,0 +1,32 @@
+package redistest
+
+import (
+	"testing"
+
+	"github.com/derekAHua/goLib/redis"
+)
+
+// NewRedis 启动内存redis服务并返回指向它的 *redis.Redis，测试结束时自动关闭
+//  r, s := redistest.NewRedis(t)
+//  _ = r.Set(ctx, "key", "value", 10)
+//  s.FastForward(11 * time.Second)
+func NewRedis(t testing.TB) (*redis.Redis, *Server) {
+	t.Helper()
+	s, err := NewServer()
+	if err != nil {
+		t.Fatalf("start redistest server error: %v", err)
+	}
+	r, err := redis.InitRedisClient(redis.Conf{
+		Service: "redistest",
+		Addr:    s.Addr(),
+	})
+	if err != nil {
+		s.Close()
+		t.Fatalf("init redis client error: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = r.Close()
+		s.Close()
+	})
+	return r, s
+}
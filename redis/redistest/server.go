@@ -0,0 +1,325 @@
+// Package redistest 提供进程内的内存版redis服务，用于不依赖真实redis的单元测试
+//
+// 与真实redis的差异:
+//  - HyperLogLog 记录全部元素，PFCOUNT 返回精确的基数，GET 等字符串命令不能读取 HyperLogLog
+//  - 不支持 BITFIELD
+//  - 内置的lua解释器只支持顺序语句，BloomFilter 等包含条件、循环的脚本需要通过 Server.Script 注册Go实现
+package redistest
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server 基于RESP协议的内存redis服务，实现了 redis 包用到的命令子集
+type Server struct {
+	mu       sync.Mutex
+	listener net.Listener
+	data     map[string]*item
+	scripts  map[string]string
+	handlers map[string]ScriptFunc
+
+	// 时钟：fixed 非零时使用固定时间，否则使用真实时间加上 offset
+	fixed  time.Time
+	offset time.Duration
+
+	conns  map[net.Conn]struct{}
+	wg     sync.WaitGroup
+	closed chan struct{}
+}
+
+// item 一个key对应的值
+// value 的类型为: string, hashValue, *listValue, setValue, zsetValue, hllValue
+type item struct {
+	value    interface{}
+	expireAt time.Time
+}
+
+// NewServer 在 127.0.0.1 的随机端口上启动服务
+func NewServer() (*Server, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		listener: l,
+		data:     make(map[string]*item),
+		scripts:  make(map[string]string),
+		handlers: make(map[string]ScriptFunc),
+		conns:    make(map[net.Conn]struct{}),
+		closed:   make(chan struct{}),
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Addr 返回服务监听的地址，如 127.0.0.1:6379
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Close 关闭服务及所有连接
+func (s *Server) Close() {
+	s.mu.Lock()
+	select {
+	case <-s.closed:
+		s.mu.Unlock()
+		return
+	default:
+	}
+	close(s.closed)
+	_ = s.listener.Close()
+	for c := range s.conns {
+		_ = c.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+// Now 返回服务当前的时间，用于判断key是否过期
+func (s *Server) Now() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.now()
+}
+
+// SetTime 将服务时钟固定在 t
+func (s *Server) SetTime(t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fixed = t
+}
+
+// FastForward 将服务时钟拨快 d，用于测试过期
+func (s *Server) FastForward(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fixed.IsZero() {
+		s.offset += d
+	} else {
+		s.fixed = s.fixed.Add(d)
+	}
+}
+
+// FlushAll 清空所有数据
+func (s *Server) FlushAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data = make(map[string]*item)
+}
+
+// Keys 返回所有未过期的key
+func (s *Server) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.keys()
+}
+
+// TTL 返回key的剩余生存时间，key不存在或没有设置过期时间时返回0
+func (s *Server) TTL(key string) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	it := s.get(key)
+	if it == nil || it.expireAt.IsZero() {
+		return 0
+	}
+	return it.expireAt.Sub(s.now())
+}
+
+func (s *Server) now() time.Time {
+	if !s.fixed.IsZero() {
+		return s.fixed
+	}
+	return time.Now().Add(s.offset)
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go s.handle(conn)
+	}
+}
+
+// session 单个连接的状态
+type session struct {
+	multi  bool
+	dirty  bool
+	queued [][]string
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		_ = conn.Close()
+	}()
+
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	sess := &session{}
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		reply := s.dispatch(sess, args)
+		if b, ok := reply.(*blocked); ok {
+			reply = s.wait(b)
+		}
+		writeReply(w, reply)
+		if err = w.Flush(); err != nil {
+			return
+		}
+		if strings.ToUpper(args[0]) == "QUIT" {
+			return
+		}
+	}
+}
+
+// dispatch 处理事务控制命令，其余命令在事务中排队或直接执行
+func (s *Server) dispatch(sess *session, args []string) interface{} {
+	name := strings.ToUpper(args[0])
+	switch name {
+	case "MULTI":
+		if sess.multi {
+			return errors.New("ERR MULTI calls can not be nested")
+		}
+		sess.multi, sess.dirty, sess.queued = true, false, nil
+		return status("OK")
+	case "DISCARD":
+		if !sess.multi {
+			return errors.New("ERR DISCARD without MULTI")
+		}
+		sess.multi, sess.queued = false, nil
+		return status("OK")
+	case "EXEC":
+		if !sess.multi {
+			return errors.New("ERR EXEC without MULTI")
+		}
+		queued, dirty := sess.queued, sess.dirty
+		sess.multi, sess.queued = false, nil
+		if dirty {
+			return errors.New("EXECABORT Transaction discarded because of previous errors.")
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		res := make([]interface{}, 0, len(queued))
+		for _, q := range queued {
+			r := s.call(q)
+			if _, ok := r.(*blocked); ok {
+				r = nullArray{}
+			}
+			res = append(res, r)
+		}
+		return res
+	}
+
+	if sess.multi {
+		if err := checkCommand(args); err != nil {
+			sess.dirty = true
+			return err
+		}
+		sess.queued = append(sess.queued, args)
+		return status("QUEUED")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.call(args)
+}
+
+// call 执行一条命令，调用方需持有锁
+func (s *Server) call(args []string) interface{} {
+	if err := checkCommand(args); err != nil {
+		return err
+	}
+	return commands[strings.ToUpper(args[0])].fn(s, args[1:])
+}
+
+func checkCommand(args []string) error {
+	name := strings.ToUpper(args[0])
+	cmd, ok := commands[name]
+	if !ok {
+		return errors.New("ERR unknown command '" + args[0] + "'")
+	}
+	n := len(args)
+	if (cmd.arity > 0 && n != cmd.arity) || (cmd.arity < 0 && n < -cmd.arity) {
+		return errWrongArgs(name)
+	}
+	return nil
+}
+
+// blocked 阻塞命令(BLPOP等)在没有数据时返回，由连接协程轮询重试直到超时
+type blocked struct {
+	retry    func() interface{}
+	deadline time.Time
+}
+
+func (s *Server) wait(b *blocked) interface{} {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.closed:
+			return nullArray{}
+		case <-ticker.C:
+		}
+		s.mu.Lock()
+		r := b.retry()
+		s.mu.Unlock()
+		if r != nil {
+			return r
+		}
+		if !b.deadline.IsZero() && time.Now().After(b.deadline) {
+			return nullArray{}
+		}
+	}
+}
+
+// get 返回未过期的key，已过期的key会被删除，调用方需持有锁
+func (s *Server) get(key string) *item {
+	it, ok := s.data[key]
+	if !ok {
+		return nil
+	}
+	if !it.expireAt.IsZero() && !s.now().Before(it.expireAt) {
+		delete(s.data, key)
+		return nil
+	}
+	return it
+}
+
+func (s *Server) keys() []string {
+	keys := make([]string, 0, len(s.data))
+	for k := range s.data {
+		if s.get(k) != nil {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// set 写入新值，会清除原有的过期时间
+func (s *Server) set(key string, value interface{}) {
+	s.data[key] = &item{value: value}
+}
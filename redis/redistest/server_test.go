@@ -0,0 +1,247 @@
+package redistest
+
+import (
+	"testing"
+	"time"
+
+	goredis "github.com/derekAHua/goLib/redis"
+	"github.com/derekAHua/goLib/zlog"
+	"github.com/gin-gonic/gin"
+	redigo "github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	Main(m, zlog.LogNameRedis)
+}
+
+func TestServer_String(t *testing.T) {
+	ctx := &gin.Context{}
+	r, s := NewRedis(t)
+
+	assert.Nil(t, r.Set(ctx, "name", "derek", 10))
+	v, err := r.Get(ctx, "name")
+	assert.Nil(t, err)
+	assert.Equal(t, "derek", string(v))
+
+	ttl, err := r.Ttl(ctx, "name")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10), ttl)
+
+	ok, err := r.SetNxByEX(ctx, "name", "other", 10)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	s.FastForward(11 * time.Second)
+	v, err = r.Get(ctx, "name")
+	assert.Nil(t, err)
+	assert.Nil(t, v)
+
+	ok, err = r.SetNxByEX(ctx, "name", "other", 10)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	n, err := r.IncrBy(ctx, "counter", 5)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), n)
+	assert.Equal(t, [][]byte{[]byte("other"), nil, []byte("5")}, r.MGet(ctx, "name", "missing", "counter"))
+}
+
+func TestServer_Collections(t *testing.T) {
+	ctx := &gin.Context{}
+	r, _ := NewRedis(t)
+
+	assert.Nil(t, r.HMSet(ctx, "hash", map[string]interface{}{"a": 1, "b": 2}))
+	n, err := r.HIncrBy(ctx, "hash", "a", 2)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), n)
+	fields, err := r.HMGet(ctx, "hash", "a", "c")
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("3"), nil}, fields)
+
+	_, err = r.RPush(ctx, "list", "a", "b", "c")
+	assert.Nil(t, err)
+	items, err := r.LRange(ctx, "list", 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("a"), []byte("b"), []byte("c")}, items)
+	item, err := r.LPop(ctx, "list")
+	assert.Nil(t, err)
+	assert.Equal(t, "a", string(item))
+
+	_, err = r.SAdd(ctx, "set1", "a", "b")
+	assert.Nil(t, err)
+	_, err = r.SAdd(ctx, "set2", "b", "c")
+	assert.Nil(t, err)
+	inter, err := r.SInter(ctx, "set1", "set2")
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("b")}, inter)
+
+	_, err = r.ZAdd(ctx, "zset", map[string]float64{"a": 1, "b": 2, "c": 3})
+	assert.Nil(t, err)
+	rank, err := r.ZRevRank(ctx, "zset", "a")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), rank)
+	members, err := r.ZRangeByScore(ctx, "zset", "(1", "+inf", true, false, 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("b"), []byte("2"), []byte("c"), []byte("3")}, members)
+
+	_, err = r.SAdd(ctx, "hash", "a")
+	assert.NotNil(t, err)
+}
+
+func TestServer_Scan(t *testing.T) {
+	ctx := &gin.Context{}
+	r, _ := NewRedis(t)
+
+	for _, k := range []string{"user:1", "user:2", "user:3", "order:1"} {
+		assert.Nil(t, r.Set(ctx, k, "1"))
+	}
+	_, err := r.SAdd(ctx, "user:set", "a")
+	assert.Nil(t, err)
+
+	var keys []string
+	it := r.Scan(ctx, goredis.WithScanMatch("user:*"), goredis.WithScanCount(2), goredis.WithScanType("string"))
+	for it.Next() {
+		keys = append(keys, it.Val())
+	}
+	assert.Nil(t, it.Err())
+	assert.Equal(t, []string{"user:1", "user:2", "user:3"}, keys)
+}
+
+func TestServer_Lua(t *testing.T) {
+	ctx := &gin.Context{}
+	r, s := NewRedis(t)
+
+	reply, err := r.Lua(ctx, "redis.call('SET', KEYS[1], ARGV[1])\nreturn redis.call('GET', KEYS[1])", 1, "key", "value")
+	assert.Nil(t, err)
+	assert.Equal(t, "value", string(reply.([]byte)))
+
+	const unlock = "if redis.call('GET', KEYS[1]) == ARGV[1] then return redis.call('DEL', KEYS[1]) else return 0 end"
+	s.Script(unlock, func(call func(args ...string) interface{}, keys, argv []string) interface{} {
+		if v, _ := call("GET", keys[0]).(string); v == argv[0] {
+			return call("DEL", keys[0])
+		}
+		return int64(0)
+	})
+	reply, err = r.Lua(ctx, unlock, 1, "key", "other")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), reply)
+	reply, err = r.Lua(ctx, unlock, 1, "key", "value")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), reply)
+}
+
+func TestServer_Multi(t *testing.T) {
+	s, err := NewServer()
+	assert.Nil(t, err)
+	defer s.Close()
+
+	conn, err := redigo.Dial("tcp", s.Addr())
+	assert.Nil(t, err)
+	defer func() { _ = conn.Close() }()
+
+	_ = conn.Send("MULTI")
+	_ = conn.Send("INCR", "counter")
+	_ = conn.Send("INCR", "counter")
+	reply, err := redigo.Values(conn.Do("EXEC"))
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{int64(1), int64(2)}, reply)
+
+	_, _ = conn.Do("MULTI")
+	_, err = conn.Do("NOSUCHCOMMAND")
+	assert.NotNil(t, err)
+	_, err = conn.Do("EXEC")
+	assert.NotNil(t, err)
+}
+
+func TestServer_Bitmap(t *testing.T) {
+	ctx := &gin.Context{}
+	r, _ := NewRedis(t)
+
+	old, err := r.SetBit(ctx, "bits", 7, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, old)
+	_, _ = r.SetBit(ctx, "bits", 9, 1)
+	bit, err := r.GetBit(ctx, "bits", 7)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, bit)
+	bit, _ = r.GetBit(ctx, "bits", 100)
+	assert.Equal(t, 0, bit)
+	v, _ := r.Get(ctx, "bits")
+	assert.Equal(t, []byte{0x01, 0x40}, v)
+
+	n, err := r.BitCount(ctx, "bits")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+	n, _ = r.BitCountRange(ctx, "bits", -1, -1)
+	assert.Equal(t, int64(1), n)
+
+	_, _ = r.SetBit(ctx, "other", 7, 1)
+	n, err = r.BitOp(ctx, goredis.BitOpAnd, "and", "bits", "other")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+	n, _ = r.BitCount(ctx, "and")
+	assert.Equal(t, int64(1), n)
+	_, err = r.BitOp(ctx, goredis.BitOpNot, "not", "bits", "other")
+	assert.NotNil(t, err)
+}
+
+func TestServer_HyperLogLog(t *testing.T) {
+	ctx := &gin.Context{}
+	r, _ := NewRedis(t)
+
+	changed, err := r.PFAdd(ctx, "day1", "a", "b", "c")
+	assert.Nil(t, err)
+	assert.True(t, changed)
+	changed, _ = r.PFAdd(ctx, "day1", "a")
+	assert.False(t, changed)
+	_, _ = r.PFAdd(ctx, "day2", "c", "d")
+
+	n, err := r.PFCount(ctx, "day1", "day2", "missing")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), n)
+	assert.Nil(t, r.PFMerge(ctx, "week", "day1", "day2"))
+	n, _ = r.PFCount(ctx, "week")
+	assert.Equal(t, int64(4), n)
+}
+
+func TestServer_Geo(t *testing.T) {
+	ctx := &gin.Context{}
+	r, _ := NewRedis(t)
+
+	n, err := r.GeoAdd(ctx, "sicily",
+		goredis.GeoLocation{Name: "Palermo", Longitude: 13.361389, Latitude: 38.115556},
+		goredis.GeoLocation{Name: "Catania", Longitude: 15.087269, Latitude: 37.502669},
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+
+	pos, err := r.GeoPos(ctx, "sicily", "Palermo", "missing")
+	assert.Nil(t, err)
+	assert.InDelta(t, 13.361389, pos[0].Longitude, 1e-5)
+	assert.InDelta(t, 38.115556, pos[0].Latitude, 1e-5)
+	assert.Nil(t, pos[1])
+
+	// 与redis文档中的结果一致
+	dist, err := r.GeoDist(ctx, "sicily", "Palermo", "Catania", goredis.GeoUnitKM)
+	assert.Nil(t, err)
+	assert.Equal(t, 166.2742, dist)
+	dist, _ = r.GeoDist(ctx, "sicily", "Palermo", "missing", "")
+	assert.Equal(t, float64(-1), dist)
+
+	res, err := r.GeoSearch(ctx, "sicily", goredis.GeoSearchQuery{
+		Longitude: 15, Latitude: 37, Radius: 200, Sort: goredis.GeoSortAsc, WithDist: true, WithCoord: true,
+	})
+	assert.Nil(t, err)
+	assert.Len(t, res, 2)
+	assert.Equal(t, "Catania", res[0].Name)
+	assert.Equal(t, 56.4413, res[0].Dist)
+	assert.Equal(t, "Palermo", res[1].Name)
+	assert.Equal(t, 190.4424, res[1].Dist)
+
+	res, err = r.GeoSearch(ctx, "sicily", goredis.GeoSearchQuery{
+		Member: "Palermo", BoxWidth: 400, BoxHeight: 400, Count: 1, WithHash: true,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []goredis.GeoLocation{{Name: "Palermo", GeoHash: 3479099956230698}}, res)
+}
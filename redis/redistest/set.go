@@ -0,0 +1,265 @@
+package redistest
+
+import (
+	"math/rand"
+	"sort"
+)
+
+type setValue map[string]struct{}
+
+func (v setValue) members() []string {
+	res := make([]string, 0, len(v))
+	for m := range v {
+		res = append(res, m)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// getSet 返回集合，key不存在且 create 为true时创建新的集合
+func (s *Server) getSet(key string, create bool) (setValue, error) {
+	it := s.get(key)
+	if it == nil {
+		if !create {
+			return nil, nil
+		}
+		v := make(setValue)
+		s.set(key, v)
+		return v, nil
+	}
+	v, ok := it.value.(setValue)
+	if !ok {
+		return nil, errWrongType
+	}
+	return v, nil
+}
+
+func cmdSAdd(s *Server, args []string) interface{} {
+	v, err := s.getSet(args[0], true)
+	if err != nil {
+		return err
+	}
+	var n int64
+	for _, m := range args[1:] {
+		if _, ok := v[m]; !ok {
+			v[m] = struct{}{}
+			n++
+		}
+	}
+	return n
+}
+
+func cmdSIsMember(s *Server, args []string) interface{} {
+	v, err := s.getSet(args[0], false)
+	if err != nil {
+		return err
+	}
+	if _, ok := v[args[1]]; ok {
+		return int64(1)
+	}
+	return int64(0)
+}
+
+func cmdSMembers(s *Server, args []string) interface{} {
+	v, err := s.getSet(args[0], false)
+	if err != nil {
+		return err
+	}
+	return v.members()
+}
+
+func cmdSRem(s *Server, args []string) interface{} {
+	v, err := s.getSet(args[0], false)
+	if err != nil {
+		return err
+	}
+	var n int64
+	for _, m := range args[1:] {
+		if _, ok := v[m]; ok {
+			delete(v, m)
+			n++
+		}
+	}
+	s.cleanup(args[0])
+	return n
+}
+
+func cmdSCard(s *Server, args []string) interface{} {
+	v, err := s.getSet(args[0], false)
+	if err != nil {
+		return err
+	}
+	return int64(len(v))
+}
+
+func cmdSMove(s *Server, args []string) interface{} {
+	src, err := s.getSet(args[0], false)
+	if err != nil {
+		return err
+	}
+	if _, err = s.getSet(args[1], false); err != nil {
+		return err
+	}
+	if _, ok := src[args[2]]; !ok {
+		return int64(0)
+	}
+	delete(src, args[2])
+	s.cleanup(args[0])
+	dst, _ := s.getSet(args[1], true)
+	dst[args[2]] = struct{}{}
+	return int64(1)
+}
+
+func cmdSPop(s *Server, args []string) interface{} {
+	v, err := s.getSet(args[0], false)
+	if err != nil {
+		return err
+	}
+	count, single := int64(1), len(args) == 1
+	if !single {
+		if count, err = parseInt(args[1]); err != nil || count < 0 {
+			return errNotInt
+		}
+	}
+	members := v.members()
+	rand.Shuffle(len(members), func(i, j int) { members[i], members[j] = members[j], members[i] })
+	if int64(len(members)) > count {
+		members = members[:count]
+	}
+	for _, m := range members {
+		delete(v, m)
+	}
+	s.cleanup(args[0])
+	if single {
+		if len(members) == 0 {
+			return nil
+		}
+		return members[0]
+	}
+	return members
+}
+
+// cmdSRandMember SRANDMEMBER key [count]，count 为负数时允许返回重复元素
+func cmdSRandMember(s *Server, args []string) interface{} {
+	v, err := s.getSet(args[0], false)
+	if err != nil {
+		return err
+	}
+	members := v.members()
+	if len(args) == 1 {
+		if len(members) == 0 {
+			return nil
+		}
+		return members[rand.Intn(len(members))]
+	}
+	count, err := parseInt(args[1])
+	if err != nil {
+		return err
+	}
+	if len(members) == 0 {
+		return []string{}
+	}
+	if count < 0 {
+		res := make([]string, 0, -count)
+		for i := int64(0); i < -count; i++ {
+			res = append(res, members[rand.Intn(len(members))])
+		}
+		return res
+	}
+	rand.Shuffle(len(members), func(i, j int) { members[i], members[j] = members[j], members[i] })
+	if int64(len(members)) > count {
+		members = members[:count]
+	}
+	return members
+}
+
+// combine 计算多个集合的交集/并集/差集
+func (s *Server) combine(keys []string, op string) (setValue, error) {
+	var res setValue
+	for i, key := range keys {
+		v, err := s.getSet(key, false)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			res = make(setValue, len(v))
+			for m := range v {
+				res[m] = struct{}{}
+			}
+			continue
+		}
+		switch op {
+		case "inter":
+			for m := range res {
+				if _, ok := v[m]; !ok {
+					delete(res, m)
+				}
+			}
+		case "union":
+			for m := range v {
+				res[m] = struct{}{}
+			}
+		case "diff":
+			for m := range v {
+				delete(res, m)
+			}
+		}
+	}
+	return res, nil
+}
+
+func (s *Server) combineCmd(keys []string, op string) interface{} {
+	v, err := s.combine(keys, op)
+	if err != nil {
+		return err
+	}
+	return v.members()
+}
+
+func (s *Server) combineStore(args []string, op string) interface{} {
+	v, err := s.combine(args[1:], op)
+	if err != nil {
+		return err
+	}
+	delete(s.data, args[0])
+	if len(v) > 0 {
+		s.set(args[0], v)
+	}
+	return int64(len(v))
+}
+
+func cmdSInter(s *Server, args []string) interface{} {
+	return s.combineCmd(args, "inter")
+}
+
+func cmdSInterStore(s *Server, args []string) interface{} {
+	return s.combineStore(args, "inter")
+}
+
+func cmdSUnion(s *Server, args []string) interface{} {
+	return s.combineCmd(args, "union")
+}
+
+func cmdSUnionStore(s *Server, args []string) interface{} {
+	return s.combineStore(args, "union")
+}
+
+func cmdSDiff(s *Server, args []string) interface{} {
+	return s.combineCmd(args, "diff")
+}
+
+func cmdSDiffStore(s *Server, args []string) interface{} {
+	return s.combineStore(args, "diff")
+}
+
+func cmdSScan(s *Server, args []string) interface{} {
+	v, err := s.getSet(args[0], false)
+	if err != nil {
+		return err
+	}
+	cursor, page, err := scanPage(v.members(), args[1:], nil)
+	if err != nil {
+		return err
+	}
+	return []interface{}{cursor, page}
+}
@@ -0,0 +1,220 @@
+package redistest
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func (s *Server) getString(key string) (string, bool, error) {
+	it := s.get(key)
+	if it == nil {
+		return "", false, nil
+	}
+	v, ok := it.value.(string)
+	if !ok {
+		return "", false, errWrongType
+	}
+	return v, true, nil
+}
+
+func cmdGet(s *Server, args []string) interface{} {
+	v, ok, err := s.getString(args[0])
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return nil
+	}
+	return v
+}
+
+// cmdSet SET key value [EX seconds|PX milliseconds] [NX|XX] [KEEPTTL]
+func cmdSet(s *Server, args []string) interface{} {
+	key, value := args[0], args[1]
+	var (
+		ttl     time.Duration
+		nx, xx  bool
+		keepTTL bool
+	)
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "KEEPTTL":
+			keepTTL = true
+		case "EX", "PX":
+			if i+1 >= len(args) {
+				return errSyntax
+			}
+			n, err := parseInt(args[i+1])
+			if err != nil {
+				return err
+			}
+			if n <= 0 {
+				return errors.New("ERR invalid expire time in 'set' command")
+			}
+			unit := time.Second
+			if strings.ToUpper(args[i]) == "PX" {
+				unit = time.Millisecond
+			}
+			ttl = time.Duration(n) * unit
+			i++
+		default:
+			return errSyntax
+		}
+	}
+	if nx && xx {
+		return errSyntax
+	}
+
+	old := s.get(key)
+	if (nx && old != nil) || (xx && old == nil) {
+		return nil
+	}
+	it := &item{value: value}
+	if ttl > 0 {
+		it.expireAt = s.now().Add(ttl)
+	} else if keepTTL && old != nil {
+		it.expireAt = old.expireAt
+	}
+	s.data[key] = it
+	return status("OK")
+}
+
+func cmdSetNX(s *Server, args []string) interface{} {
+	if s.get(args[0]) != nil {
+		return int64(0)
+	}
+	s.set(args[0], args[1])
+	return int64(1)
+}
+
+func cmdSetEX(s *Server, args []string) interface{} {
+	return cmdSet(s, []string{args[0], args[2], "EX", args[1]})
+}
+
+func cmdGetSet(s *Server, args []string) interface{} {
+	v, ok, err := s.getString(args[0])
+	if err != nil {
+		return err
+	}
+	s.set(args[0], args[1])
+	if !ok {
+		return nil
+	}
+	return v
+}
+
+func cmdMGet(s *Server, args []string) interface{} {
+	res := make([]interface{}, 0, len(args))
+	for _, key := range args {
+		v, ok, err := s.getString(key)
+		if err != nil || !ok {
+			res = append(res, nil)
+			continue
+		}
+		res = append(res, v)
+	}
+	return res
+}
+
+func cmdMSet(s *Server, args []string) interface{} {
+	if len(args)%2 != 0 {
+		return errWrongArgs("mset")
+	}
+	for i := 0; i < len(args); i += 2 {
+		s.set(args[i], args[i+1])
+	}
+	return status("OK")
+}
+
+func cmdAppend(s *Server, args []string) interface{} {
+	v, _, err := s.getString(args[0])
+	if err != nil {
+		return err
+	}
+	v += args[1]
+	s.update(args[0], v)
+	return int64(len(v))
+}
+
+func cmdStrLen(s *Server, args []string) interface{} {
+	v, _, err := s.getString(args[0])
+	if err != nil {
+		return err
+	}
+	return int64(len(v))
+}
+
+func (s *Server) incrBy(key string, delta int64) interface{} {
+	v, ok, err := s.getString(key)
+	if err != nil {
+		return err
+	}
+	var n int64
+	if ok {
+		if n, err = parseInt(v); err != nil {
+			return err
+		}
+	}
+	n += delta
+	s.update(key, strconv.FormatInt(n, 10))
+	return n
+}
+
+func cmdIncr(s *Server, args []string) interface{} {
+	return s.incrBy(args[0], 1)
+}
+
+func cmdDecr(s *Server, args []string) interface{} {
+	return s.incrBy(args[0], -1)
+}
+
+func cmdIncrBy(s *Server, args []string) interface{} {
+	n, err := parseInt(args[1])
+	if err != nil {
+		return err
+	}
+	return s.incrBy(args[0], n)
+}
+
+func cmdDecrBy(s *Server, args []string) interface{} {
+	n, err := parseInt(args[1])
+	if err != nil {
+		return err
+	}
+	return s.incrBy(args[0], -n)
+}
+
+func cmdIncrByFloat(s *Server, args []string) interface{} {
+	delta, err := parseFloat(args[1])
+	if err != nil {
+		return err
+	}
+	v, ok, err := s.getString(args[0])
+	if err != nil {
+		return err
+	}
+	var f float64
+	if ok {
+		if f, err = parseFloat(v); err != nil {
+			return err
+		}
+	}
+	res := formatFloat(f + delta)
+	s.update(args[0], res)
+	return res
+}
+
+// update 修改字符串的值，保留原有的过期时间
+func (s *Server) update(key, value string) {
+	if it := s.get(key); it != nil {
+		it.value = value
+		return
+	}
+	s.set(key, value)
+}
@@ -0,0 +1,28 @@
+package redistest
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/derekAHua/goLib/env"
+	"github.com/derekAHua/goLib/zlog"
+)
+
+// Main 将日志 names 写入临时目录后运行测试，结束后关闭日志、删除目录并退出，供各包的 TestMain 调用:
+//  func TestMain(m *testing.M) {
+//  	redistest.Main(m, zlog.LogNameRedis)
+//  }
+func Main(m *testing.M, names ...zlog.LogName) {
+	dir, err := ioutil.TempDir("", "golib-test-log")
+	if err != nil {
+		panic(err)
+	}
+	env.SetRootPath(dir)
+	zlog.Init(zlog.LogConfig{}, names...)
+
+	code := m.Run()
+	zlog.CloseLogger()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
@@ -0,0 +1,196 @@
+package redistest
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	errWrongType = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+	errNotInt    = errors.New("ERR value is not an integer or out of range")
+	errNotFloat  = errors.New("ERR value is not a valid float")
+	errSyntax    = errors.New("ERR syntax error")
+	errNoSuchKey = errors.New("ERR no such key")
+	errOutRange  = errors.New("ERR index out of range")
+	errorTimeout = errors.New("ERR timeout is not a float or out of range")
+)
+
+func errWrongArgs(cmd string) error {
+	return errors.New("ERR wrong number of arguments for '" + strings.ToLower(cmd) + "' command")
+}
+
+func parseInt(s string) (int64, error) {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, errNotInt
+	}
+	return n, nil
+}
+
+func formatInt(n int64) string {
+	return strconv.FormatInt(n, 10)
+}
+
+func isError(reply interface{}) bool {
+	_, ok := reply.(error)
+	return ok
+}
+
+func parseFloat(s string) (float64, error) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(f) {
+		return 0, errNotFloat
+	}
+	return f, nil
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	default:
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+}
+
+// normalizeRange 将 LRANGE/ZRANGE 风格的 [start, stop] 转换为切片下标 [start, end)，区间为空时返回 ok=false
+func normalizeRange(start, stop int64, length int) (int, int, bool) {
+	n := int64(length)
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+	if start > stop || start >= n {
+		return 0, 0, false
+	}
+	return int(start), int(stop) + 1, true
+}
+
+// scanPage 实现 SCAN 系列命令的游标语义：游标为已排序元素的下标
+func scanPage(elements []string, args []string, filter func(string) bool) (string, []string, error) {
+	cursor, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return "", nil, errors.New("ERR invalid cursor")
+	}
+	match, count := "", 10
+	for i := 1; i < len(args); i++ {
+		if i+1 >= len(args) {
+			return "", nil, errSyntax
+		}
+		switch strings.ToUpper(args[i]) {
+		case "MATCH":
+			match = args[i+1]
+		case "COUNT":
+			n, err := parseInt(args[i+1])
+			if err != nil || n < 1 {
+				return "", nil, errSyntax
+			}
+			count = int(n)
+		case "TYPE":
+			// 由调用方通过 filter 处理
+		default:
+			return "", nil, errSyntax
+		}
+		i++
+	}
+
+	sort.Strings(elements)
+	var page []string
+	next := uint64(0)
+	for i := cursor; i < uint64(len(elements)); i++ {
+		if i >= cursor+uint64(count) {
+			next = i
+			break
+		}
+		e := elements[i]
+		if match != "" && !matchGlob(match, e) {
+			continue
+		}
+		if filter != nil && !filter(e) {
+			continue
+		}
+		page = append(page, e)
+	}
+	return strconv.FormatUint(next, 10), page, nil
+}
+
+// matchGlob 实现redis的glob风格匹配: ? * [abc] [^a] [a-z] \x
+func matchGlob(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if matchGlob(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+			s = s[1:]
+			pattern = pattern[1:]
+		case '[':
+			if len(s) == 0 {
+				return false
+			}
+			end := strings.IndexByte(pattern[1:], ']')
+			if end < 0 {
+				return pattern == s
+			}
+			class := pattern[1 : end+1]
+			pattern = pattern[end+2:]
+			negate := len(class) > 0 && class[0] == '^'
+			if negate {
+				class = class[1:]
+			}
+			matched := false
+			for i := 0; i < len(class); i++ {
+				if i+2 < len(class) && class[i+1] == '-' {
+					if class[i] <= s[0] && s[0] <= class[i+2] {
+						matched = true
+					}
+					i += 2
+				} else if class[i] == s[0] {
+					matched = true
+				}
+			}
+			if matched == negate {
+				return false
+			}
+			s = s[1:]
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+			s = s[1:]
+			pattern = pattern[1:]
+		}
+	}
+	return len(s) == 0
+}
@@ -0,0 +1,627 @@
+package redistest
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strings"
+)
+
+type zsetValue map[string]float64
+
+type zsetEntry struct {
+	member string
+	score  float64
+}
+
+// sorted 按 score 递增排序，score 相同时按 member 字典序排序
+func (z zsetValue) sorted() []zsetEntry {
+	res := make([]zsetEntry, 0, len(z))
+	for m, sc := range z {
+		res = append(res, zsetEntry{member: m, score: sc})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].score != res[j].score {
+			return res[i].score < res[j].score
+		}
+		return res[i].member < res[j].member
+	})
+	return res
+}
+
+// getZSet 返回有序集，key不存在且 create 为true时创建新的有序集
+func (s *Server) getZSet(key string, create bool) (zsetValue, error) {
+	it := s.get(key)
+	if it == nil {
+		if !create {
+			return nil, nil
+		}
+		z := make(zsetValue)
+		s.set(key, z)
+		return z, nil
+	}
+	z, ok := it.value.(zsetValue)
+	if !ok {
+		return nil, errWrongType
+	}
+	return z, nil
+}
+
+// cmdZAdd ZADD key [NX|XX] [CH] [INCR] score member [score member ...]
+func cmdZAdd(s *Server, args []string) interface{} {
+	key := args[0]
+	var nx, xx, ch, incr bool
+	i := 1
+loop:
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "CH":
+			ch = true
+		case "INCR":
+			incr = true
+		default:
+			break loop
+		}
+	}
+	pairs := args[i:]
+	if len(pairs) == 0 || len(pairs)%2 != 0 || (nx && xx) || (incr && len(pairs) != 2) {
+		return errSyntax
+	}
+	scores := make([]float64, 0, len(pairs)/2)
+	for j := 0; j < len(pairs); j += 2 {
+		sc, err := parseFloat(pairs[j])
+		if err != nil {
+			return err
+		}
+		scores = append(scores, sc)
+	}
+
+	z, err := s.getZSet(key, !xx)
+	if err != nil {
+		return err
+	}
+	if z == nil {
+		if incr {
+			return nil
+		}
+		return int64(0)
+	}
+
+	var added, changed int64
+	for j := 0; j < len(pairs); j += 2 {
+		member, sc := pairs[j+1], scores[j/2]
+		old, exists := z[member]
+		if (nx && exists) || (xx && !exists) {
+			if incr {
+				return nil
+			}
+			continue
+		}
+		if incr {
+			sc += old
+		}
+		if !exists {
+			added++
+		} else if old != sc {
+			changed++
+		}
+		z[member] = sc
+		if incr {
+			s.cleanup(key)
+			return formatFloat(sc)
+		}
+	}
+	s.cleanup(key)
+	if ch {
+		return added + changed
+	}
+	return added
+}
+
+func cmdZScore(s *Server, args []string) interface{} {
+	z, err := s.getZSet(args[0], false)
+	if err != nil {
+		return err
+	}
+	sc, ok := z[args[1]]
+	if !ok {
+		return nil
+	}
+	return formatFloat(sc)
+}
+
+func cmdZIncrBy(s *Server, args []string) interface{} {
+	delta, err := parseFloat(args[1])
+	if err != nil {
+		return err
+	}
+	z, err := s.getZSet(args[0], true)
+	if err != nil {
+		return err
+	}
+	z[args[2]] += delta
+	return formatFloat(z[args[2]])
+}
+
+func cmdZCard(s *Server, args []string) interface{} {
+	z, err := s.getZSet(args[0], false)
+	if err != nil {
+		return err
+	}
+	return int64(len(z))
+}
+
+// scoreBound score区间的一端，如 "1.5"、"(1.5"、"-inf"
+type scoreBound struct {
+	value     float64
+	exclusive bool
+}
+
+func parseScoreBound(s string) (scoreBound, error) {
+	b := scoreBound{}
+	if strings.HasPrefix(s, "(") {
+		b.exclusive = true
+		s = s[1:]
+	}
+	v, err := parseFloat(s)
+	if err != nil {
+		return b, errors.New("ERR min or max is not a float")
+	}
+	b.value = v
+	return b, nil
+}
+
+func (b scoreBound) aboveMin(v float64) bool {
+	if b.exclusive {
+		return v > b.value
+	}
+	return v >= b.value
+}
+
+func (b scoreBound) belowMax(v float64) bool {
+	if b.exclusive {
+		return v < b.value
+	}
+	return v <= b.value
+}
+
+// lexBound 字典序区间的一端，如 "-"、"+"、"[a"、"(a"
+type lexBound struct {
+	value     string
+	exclusive bool
+	inf       int
+}
+
+func parseLexBound(s string) (lexBound, error) {
+	switch {
+	case s == "-":
+		return lexBound{inf: -1}, nil
+	case s == "+":
+		return lexBound{inf: 1}, nil
+	case strings.HasPrefix(s, "["):
+		return lexBound{value: s[1:]}, nil
+	case strings.HasPrefix(s, "("):
+		return lexBound{value: s[1:], exclusive: true}, nil
+	default:
+		return lexBound{}, errors.New("ERR min or max not valid string range item")
+	}
+}
+
+func (b lexBound) aboveMin(v string) bool {
+	switch {
+	case b.inf < 0:
+		return true
+	case b.inf > 0:
+		return false
+	case b.exclusive:
+		return v > b.value
+	default:
+		return v >= b.value
+	}
+}
+
+func (b lexBound) belowMax(v string) bool {
+	switch {
+	case b.inf > 0:
+		return true
+	case b.inf < 0:
+		return false
+	case b.exclusive:
+		return v < b.value
+	default:
+		return v <= b.value
+	}
+}
+
+// byScore 返回 score 在 [min, max] 区间内的成员，按 score 递增排序
+func (s *Server) byScore(key, min, max string) ([]zsetEntry, error) {
+	lo, err := parseScoreBound(min)
+	if err != nil {
+		return nil, err
+	}
+	hi, err := parseScoreBound(max)
+	if err != nil {
+		return nil, err
+	}
+	z, err := s.getZSet(key, false)
+	if err != nil {
+		return nil, err
+	}
+	var res []zsetEntry
+	for _, e := range z.sorted() {
+		if lo.aboveMin(e.score) && hi.belowMax(e.score) {
+			res = append(res, e)
+		}
+	}
+	return res, nil
+}
+
+// byLex 返回 member 在字典序区间 [min, max] 内的成员
+func (s *Server) byLex(key, min, max string) ([]zsetEntry, error) {
+	lo, err := parseLexBound(min)
+	if err != nil {
+		return nil, err
+	}
+	hi, err := parseLexBound(max)
+	if err != nil {
+		return nil, err
+	}
+	z, err := s.getZSet(key, false)
+	if err != nil {
+		return nil, err
+	}
+	var res []zsetEntry
+	for _, e := range z.sorted() {
+		if lo.aboveMin(e.member) && hi.belowMax(e.member) {
+			res = append(res, e)
+		}
+	}
+	return res, nil
+}
+
+func cmdZCount(s *Server, args []string) interface{} {
+	res, err := s.byScore(args[0], args[1], args[2])
+	if err != nil {
+		return err
+	}
+	return int64(len(res))
+}
+
+func cmdZLexCount(s *Server, args []string) interface{} {
+	res, err := s.byLex(args[0], args[1], args[2])
+	if err != nil {
+		return err
+	}
+	return int64(len(res))
+}
+
+func entriesReply(entries []zsetEntry, withScores bool) []string {
+	res := make([]string, 0, 2*len(entries))
+	for _, e := range entries {
+		res = append(res, e.member)
+		if withScores {
+			res = append(res, formatFloat(e.score))
+		}
+	}
+	return res
+}
+
+func reverse(entries []zsetEntry) {
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+}
+
+// zrange ZRANGE/ZREVRANGE key start stop [WITHSCORES]
+func (s *Server) zrange(args []string, rev bool) interface{} {
+	start, err := parseInt(args[1])
+	if err != nil {
+		return err
+	}
+	stop, err := parseInt(args[2])
+	if err != nil {
+		return err
+	}
+	withScores := false
+	if len(args) == 4 {
+		if strings.ToUpper(args[3]) != "WITHSCORES" {
+			return errSyntax
+		}
+		withScores = true
+	} else if len(args) > 4 {
+		return errSyntax
+	}
+	z, err := s.getZSet(args[0], false)
+	if err != nil {
+		return err
+	}
+	entries := z.sorted()
+	if rev {
+		reverse(entries)
+	}
+	from, to, ok := normalizeRange(start, stop, len(entries))
+	if !ok {
+		return []string{}
+	}
+	return entriesReply(entries[from:to], withScores)
+}
+
+func cmdZRange(s *Server, args []string) interface{} {
+	return s.zrange(args, false)
+}
+
+func cmdZRevRange(s *Server, args []string) interface{} {
+	return s.zrange(args, true)
+}
+
+// zrangeByScore ZRANGEBYSCORE key min max / ZREVRANGEBYSCORE key max min [WITHSCORES] [LIMIT offset count]
+func (s *Server) zrangeByScore(args []string, rev bool) interface{} {
+	min, max := args[1], args[2]
+	if rev {
+		min, max = max, min
+	}
+	withScores := false
+	offset, count := int64(0), int64(-1)
+	for i := 3; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "WITHSCORES":
+			withScores = true
+		case "LIMIT":
+			if i+2 >= len(args) {
+				return errSyntax
+			}
+			var err error
+			if offset, err = parseInt(args[i+1]); err != nil {
+				return err
+			}
+			if count, err = parseInt(args[i+2]); err != nil {
+				return err
+			}
+			i += 2
+		default:
+			return errSyntax
+		}
+	}
+	entries, err := s.byScore(args[0], min, max)
+	if err != nil {
+		return err
+	}
+	if rev {
+		reverse(entries)
+	}
+	if offset < 0 || offset >= int64(len(entries)) {
+		return []string{}
+	}
+	entries = entries[offset:]
+	if count >= 0 && count < int64(len(entries)) {
+		entries = entries[:count]
+	}
+	return entriesReply(entries, withScores)
+}
+
+func cmdZRangeByScore(s *Server, args []string) interface{} {
+	return s.zrangeByScore(args, false)
+}
+
+func cmdZRevRangeByScore(s *Server, args []string) interface{} {
+	return s.zrangeByScore(args, true)
+}
+
+func (s *Server) zrank(args []string, rev bool) interface{} {
+	z, err := s.getZSet(args[0], false)
+	if err != nil {
+		return err
+	}
+	if _, ok := z[args[1]]; !ok {
+		return nil
+	}
+	entries := z.sorted()
+	if rev {
+		reverse(entries)
+	}
+	for i, e := range entries {
+		if e.member == args[1] {
+			return int64(i)
+		}
+	}
+	return nil
+}
+
+func cmdZRank(s *Server, args []string) interface{} {
+	return s.zrank(args, false)
+}
+
+func cmdZRevRank(s *Server, args []string) interface{} {
+	return s.zrank(args, true)
+}
+
+func cmdZRem(s *Server, args []string) interface{} {
+	z, err := s.getZSet(args[0], false)
+	if err != nil {
+		return err
+	}
+	var n int64
+	for _, m := range args[1:] {
+		if _, ok := z[m]; ok {
+			delete(z, m)
+			n++
+		}
+	}
+	s.cleanup(args[0])
+	return n
+}
+
+func (s *Server) removeEntries(key string, entries []zsetEntry) int64 {
+	z, _ := s.getZSet(key, false)
+	for _, e := range entries {
+		delete(z, e.member)
+	}
+	s.cleanup(key)
+	return int64(len(entries))
+}
+
+func cmdZRemRangeByRank(s *Server, args []string) interface{} {
+	start, err := parseInt(args[1])
+	if err != nil {
+		return err
+	}
+	stop, err := parseInt(args[2])
+	if err != nil {
+		return err
+	}
+	z, err := s.getZSet(args[0], false)
+	if err != nil {
+		return err
+	}
+	entries := z.sorted()
+	from, to, ok := normalizeRange(start, stop, len(entries))
+	if !ok {
+		return int64(0)
+	}
+	return s.removeEntries(args[0], entries[from:to])
+}
+
+func cmdZRemRangeByScore(s *Server, args []string) interface{} {
+	entries, err := s.byScore(args[0], args[1], args[2])
+	if err != nil {
+		return err
+	}
+	return s.removeEntries(args[0], entries)
+}
+
+func cmdZRemRangeByLex(s *Server, args []string) interface{} {
+	entries, err := s.byLex(args[0], args[1], args[2])
+	if err != nil {
+		return err
+	}
+	return s.removeEntries(args[0], entries)
+}
+
+// zstore ZUNIONSTORE/ZINTERSTORE destination numkeys key [key ...] [WEIGHTS weight ...] [AGGREGATE SUM|MIN|MAX]
+// 源key也可以是集合，成员的 score 视为1
+func (s *Server) zstore(args []string, inter bool) interface{} {
+	n, err := parseInt(args[1])
+	if err != nil {
+		return err
+	}
+	if n < 1 || int64(len(args)) < 2+n {
+		return errSyntax
+	}
+	keys := args[2 : 2+n]
+	weights := make([]float64, n)
+	for i := range weights {
+		weights[i] = 1
+	}
+	aggregate := "SUM"
+	for i := 2 + int(n); i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "WEIGHTS":
+			if i+int(n) >= len(args) {
+				return errSyntax
+			}
+			for j := 0; j < int(n); j++ {
+				if weights[j], err = parseFloat(args[i+1+j]); err != nil {
+					return errors.New("ERR weight value is not a float")
+				}
+			}
+			i += int(n)
+		case "AGGREGATE":
+			if i+1 >= len(args) {
+				return errSyntax
+			}
+			aggregate = strings.ToUpper(args[i+1])
+			if aggregate != "SUM" && aggregate != "MIN" && aggregate != "MAX" {
+				return errSyntax
+			}
+			i++
+		default:
+			return errSyntax
+		}
+	}
+
+	var res zsetValue
+	for i, key := range keys {
+		src := make(zsetValue)
+		if it := s.get(key); it != nil {
+			switch v := it.value.(type) {
+			case zsetValue:
+				for m, sc := range v {
+					src[m] = sc
+				}
+			case setValue:
+				for m := range v {
+					src[m] = 1
+				}
+			default:
+				return errWrongType
+			}
+		}
+		for m, sc := range src {
+			src[m] = sc * weights[i]
+		}
+
+		if i == 0 {
+			res = src
+			continue
+		}
+		if inter {
+			for m := range res {
+				if _, ok := src[m]; !ok {
+					delete(res, m)
+				}
+			}
+		}
+		for m, sc := range src {
+			old, ok := res[m]
+			switch {
+			case !ok && inter:
+			case !ok:
+				res[m] = sc
+			case aggregate == "MIN":
+				res[m] = math.Min(old, sc)
+			case aggregate == "MAX":
+				res[m] = math.Max(old, sc)
+			default:
+				res[m] = old + sc
+			}
+		}
+	}
+
+	delete(s.data, args[0])
+	if len(res) > 0 {
+		s.set(args[0], res)
+	}
+	return int64(len(res))
+}
+
+func cmdZUnionStore(s *Server, args []string) interface{} {
+	return s.zstore(args, false)
+}
+
+func cmdZInterStore(s *Server, args []string) interface{} {
+	return s.zstore(args, true)
+}
+
+func cmdZScan(s *Server, args []string) interface{} {
+	z, err := s.getZSet(args[0], false)
+	if err != nil {
+		return err
+	}
+	members := make([]string, 0, len(z))
+	for m := range z {
+		members = append(members, m)
+	}
+	cursor, page, err := scanPage(members, args[1:], nil)
+	if err != nil {
+		return err
+	}
+	res := make([]string, 0, 2*len(page))
+	for _, m := range page {
+		res = append(res, m, formatFloat(z[m]))
+	}
+	return []interface{}{cursor, res}
+}
@@ -0,0 +1,294 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gomodule/redigo/redis"
+)
+
+type (
+	// ScanOption SCAN系列迭代器的可选项
+	ScanOption func(*scanOptions)
+
+	scanOptions struct {
+		match    string
+		count    int
+		typ      string
+		interval time.Duration
+		stdCtx   context.Context
+	}
+)
+
+// WithScanMatch 只返回符合glob风格 pattern 的元素（MATCH）
+func WithScanMatch(pattern string) ScanOption {
+	return func(o *scanOptions) {
+		o.match = pattern
+	}
+}
+
+// WithScanCount 每次迭代返回元素数量的提示值（COUNT），实际数量并不准确=count
+func WithScanCount(count int) ScanOption {
+	return func(o *scanOptions) {
+		o.count = count
+	}
+}
+
+// WithScanType 只返回指定类型的key（TYPE），仅对 Scan 生效，需要redis 6.0+
+// 如：string, list, set, zset, hash, stream
+func WithScanType(typ string) ScanOption {
+	return func(o *scanOptions) {
+		o.typ = typ
+	}
+}
+
+// WithScanRate 限制每秒最多发起 perSecond 次SCAN调用，避免批量任务占满redis
+func WithScanRate(perSecond int) ScanOption {
+	return func(o *scanOptions) {
+		if perSecond > 0 {
+			o.interval = time.Second / time.Duration(perSecond)
+		}
+	}
+}
+
+// WithScanContext 指定控制迭代取消的context
+// 不指定时使用 gin.Context 中 Request 的context（如果存在）
+func WithScanContext(ctx context.Context) ScanOption {
+	return func(o *scanOptions) {
+		o.stdCtx = ctx
+	}
+}
+
+// ScanIterator 基于游标的惰性迭代器，按需调用SCAN/SSCAN/HSCAN/ZSCAN直至游标归零
+//  it := r.Scan(ctx, WithScanMatch("user:*"), WithScanCount(100))
+//  for it.Next() {
+//      key := it.Val()
+//  }
+//  if err := it.Err(); err != nil {...}
+type ScanIterator struct {
+	ctx   *gin.Context
+	redis *Redis
+	cmd   string
+	key   string
+	opts  *scanOptions
+
+	cursor   uint64
+	started  bool
+	items    []string
+	pos      int
+	val      string
+	lastCall time.Time
+	err      error
+}
+
+// Scan 迭代整个keyspace（SCAN），用于替代会阻塞redis的KEYS命令
+func (r *Redis) Scan(ctx *gin.Context, opts ...ScanOption) *ScanIterator {
+	return r.newScanIterator(ctx, "SCAN", "", opts...)
+}
+
+// SScanIter 迭代集合 key 的全部成员（SSCAN）
+func (r *Redis) SScanIter(ctx *gin.Context, key string, opts ...ScanOption) *ScanIterator {
+	return r.newScanIterator(ctx, "SSCAN", key, opts...)
+}
+
+// HScanIter 迭代哈希表 key 的全部field-value（HSCAN）
+func (r *Redis) HScanIter(ctx *gin.Context, key string, opts ...ScanOption) *HashScanIterator {
+	return &HashScanIterator{it: r.newScanIterator(ctx, "HSCAN", key, opts...)}
+}
+
+// ZScanIter 迭代有序集 key 的全部member-score（ZSCAN）
+func (r *Redis) ZScanIter(ctx *gin.Context, key string, opts ...ScanOption) *ZSetScanIterator {
+	return &ZSetScanIterator{it: r.newScanIterator(ctx, "ZSCAN", key, opts...)}
+}
+
+func (r *Redis) newScanIterator(ctx *gin.Context, cmd, key string, opts ...ScanOption) *ScanIterator {
+	o := new(scanOptions)
+	for _, f := range opts {
+		f(o)
+	}
+	if o.stdCtx == nil && ctx != nil && ctx.Request != nil {
+		o.stdCtx = ctx.Request.Context()
+	}
+	return &ScanIterator{
+		ctx:   ctx,
+		redis: r,
+		cmd:   cmd,
+		key:   key,
+		opts:  o,
+	}
+}
+
+// Next 移动到下一个元素，迭代结束或出错时返回false
+func (it *ScanIterator) Next() bool {
+	for it.pos >= len(it.items) {
+		if it.err != nil || (it.started && it.cursor == 0) {
+			return false
+		}
+		if it.err = it.fetch(); it.err != nil {
+			return false
+		}
+	}
+	it.val = it.items[it.pos]
+	it.pos++
+	return true
+}
+
+// Val 返回当前元素
+func (it *ScanIterator) Val() string {
+	return it.val
+}
+
+// Err 返回迭代过程中遇到的错误，context取消时返回context的错误
+func (it *ScanIterator) Err() error {
+	return it.err
+}
+
+func (it *ScanIterator) fetch() error {
+	if err := it.wait(); err != nil {
+		return err
+	}
+
+	var args []interface{}
+	if it.key != "" {
+		args = packArgs(it.key, it.cursor)
+	} else {
+		args = packArgs(it.cursor)
+	}
+	if it.opts.match != "" {
+		args = append(args, "MATCH", it.opts.match)
+	}
+	if it.opts.count > 0 {
+		args = append(args, "COUNT", it.opts.count)
+	}
+	if it.opts.typ != "" && it.cmd == "SCAN" {
+		args = append(args, "TYPE", it.opts.typ)
+	}
+
+	it.lastCall = time.Now()
+	values, err := redis.Values(it.redis.Do(it.ctx, it.cmd, args...))
+	if err != nil {
+		return err
+	}
+	var items []string
+	if _, err = redis.Scan(values, &it.cursor, &items); err != nil {
+		return err
+	}
+	it.started = true
+	it.items, it.pos = items, 0
+	return nil
+}
+
+// wait 检查context是否已取消，并按照限速要求等待到下一次可调用的时间
+func (it *ScanIterator) wait() error {
+	var done <-chan struct{}
+	if it.opts.stdCtx != nil {
+		if err := it.opts.stdCtx.Err(); err != nil {
+			return err
+		}
+		done = it.opts.stdCtx.Done()
+	}
+
+	if it.opts.interval <= 0 || it.lastCall.IsZero() {
+		return nil
+	}
+	d := it.opts.interval - time.Since(it.lastCall)
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-done:
+		return it.opts.stdCtx.Err()
+	}
+}
+
+// HashScanIterator 哈希表的field-value迭代器
+type HashScanIterator struct {
+	it    *ScanIterator
+	field string
+	value string
+	err   error
+}
+
+// Next 移动到下一个field-value，迭代结束或出错时返回false
+func (h *HashScanIterator) Next() bool {
+	if h.err != nil || !h.it.Next() {
+		return false
+	}
+	h.field = h.it.Val()
+	if !h.it.Next() {
+		if h.it.Err() == nil {
+			h.err = errors.New("hscan reply has odd number of elements")
+		}
+		return false
+	}
+	h.value = h.it.Val()
+	return true
+}
+
+// Field 返回当前field
+func (h *HashScanIterator) Field() string {
+	return h.field
+}
+
+// Value 返回当前value
+func (h *HashScanIterator) Value() string {
+	return h.value
+}
+
+// Err 返回迭代过程中遇到的错误
+func (h *HashScanIterator) Err() error {
+	if h.err != nil {
+		return h.err
+	}
+	return h.it.Err()
+}
+
+// ZSetScanIterator 有序集的member-score迭代器
+type ZSetScanIterator struct {
+	it     *ScanIterator
+	member string
+	score  float64
+	err    error
+}
+
+// Next 移动到下一个member-score，迭代结束或出错时返回false
+func (z *ZSetScanIterator) Next() bool {
+	if z.err != nil || !z.it.Next() {
+		return false
+	}
+	z.member = z.it.Val()
+	if !z.it.Next() {
+		if z.it.Err() == nil {
+			z.err = errors.New("zscan reply has odd number of elements")
+		}
+		return false
+	}
+	z.score, z.err = strconv.ParseFloat(z.it.Val(), 64)
+	return z.err == nil
+}
+
+// Member 返回当前成员
+func (z *ZSetScanIterator) Member() string {
+	return z.member
+}
+
+// Score 返回当前成员的score
+func (z *ZSetScanIterator) Score() float64 {
+	return z.score
+}
+
+// Err 返回迭代过程中遇到的错误
+func (z *ZSetScanIterator) Err() error {
+	if z.err != nil {
+		return z.err
+	}
+	return z.it.Err()
+}
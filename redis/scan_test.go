@@ -0,0 +1,114 @@
+package redis_test
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/derekAHua/goLib/redis"
+	"github.com/derekAHua/goLib/redis/redistest"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScan(t *testing.T) {
+	ctx := &gin.Context{}
+	r, _ := redistest.NewRedis(t)
+
+	var users []string
+	for i := 0; i < 7; i++ {
+		key := "user:" + strconv.Itoa(i)
+		users = append(users, key)
+		assert.Nil(t, r.Set(ctx, key, i))
+	}
+	assert.Nil(t, r.Set(ctx, "order:1", 1))
+	_, err := r.SAdd(ctx, "user:set", "a")
+	assert.Nil(t, err)
+
+	// COUNT 小于结果数量时需要沿游标多次迭代
+	it := r.Scan(ctx, redis.WithScanMatch("user:*"), redis.WithScanCount(2))
+	var keys []string
+	for it.Next() {
+		keys = append(keys, it.Val())
+	}
+	assert.Nil(t, it.Err())
+	sort.Strings(keys)
+	assert.Equal(t, append(users, "user:set"), keys)
+
+	// TYPE 只返回指定类型的key
+	it = r.Scan(ctx, redis.WithScanMatch("user:*"), redis.WithScanType("set"), redis.WithScanCount(3))
+	keys = keys[:0]
+	for it.Next() {
+		keys = append(keys, it.Val())
+	}
+	assert.Nil(t, it.Err())
+	assert.Equal(t, []string{"user:set"}, keys)
+}
+
+func TestScan_Context(t *testing.T) {
+	ctx := &gin.Context{}
+	r, _ := redistest.NewRedis(t)
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, r.Set(ctx, "key:"+strconv.Itoa(i), i))
+	}
+
+	// 已取消的context不发起任何SCAN
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	it := r.Scan(ctx, redis.WithScanContext(canceled))
+	assert.False(t, it.Next())
+	assert.Equal(t, context.Canceled, it.Err())
+
+	// 迭代中途取消: 当前页返回完后停止，不再拉取下一页
+	stdCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	it = r.Scan(ctx, redis.WithScanContext(stdCtx), redis.WithScanCount(2))
+	var keys []string
+	for it.Next() {
+		keys = append(keys, it.Val())
+		cancel()
+	}
+	assert.Equal(t, context.Canceled, it.Err())
+	assert.Equal(t, []string{"key:0", "key:1"}, keys)
+}
+
+func TestScanIter(t *testing.T) {
+	ctx := &gin.Context{}
+	r, _ := redistest.NewRedis(t)
+
+	_, err := r.SAdd(ctx, "set", "a1", "a2", "a3", "b1", "b2")
+	assert.Nil(t, err)
+	it := r.SScanIter(ctx, "set", redis.WithScanMatch("a*"), redis.WithScanCount(2))
+	var members []string
+	for it.Next() {
+		members = append(members, it.Val())
+	}
+	assert.Nil(t, it.Err())
+	sort.Strings(members)
+	assert.Equal(t, []string{"a1", "a2", "a3"}, members)
+
+	assert.Nil(t, r.HMSet(ctx, "hash", map[string]interface{}{"f1": "v1", "f2": "v2", "f3": "v3"}))
+	hit := r.HScanIter(ctx, "hash", redis.WithScanCount(1))
+	fields := make(map[string]string)
+	for hit.Next() {
+		fields[hit.Field()] = hit.Value()
+	}
+	assert.Nil(t, hit.Err())
+	assert.Equal(t, map[string]string{"f1": "v1", "f2": "v2", "f3": "v3"}, fields)
+
+	_, err = r.ZAdd(ctx, "zset", map[string]float64{"m1": 1.5, "m2": 2, "n1": 3})
+	assert.Nil(t, err)
+	zit := r.ZScanIter(ctx, "zset", redis.WithScanMatch("m*"), redis.WithScanCount(1))
+	scores := make(map[string]float64)
+	for zit.Next() {
+		scores[zit.Member()] = zit.Score()
+	}
+	assert.Nil(t, zit.Err())
+	assert.Equal(t, map[string]float64{"m1": 1.5, "m2": 2}, scores)
+
+	// key 不存在时没有元素
+	it = r.SScanIter(ctx, "missing")
+	assert.False(t, it.Next())
+	assert.Nil(t, it.Err())
+}
@@ -1,13 +1,16 @@
 package rmq
 
 import (
+	"errors"
 	"github.com/derekAHua/goLib/zlog"
 	"go.uber.org/zap"
 	"net"
 	"net/http"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/apache/rocketmq-client-go/v2/primitive"
 	"github.com/apache/rocketmq-client-go/v2/rlog"
 )
 
@@ -25,8 +28,10 @@ type ClientConfig struct {
 	NameServers []string `json:"nameservers" yaml:"nameservers"`
 	// 生产/消费者组名称，各业务线间需要保持唯一
 	Group string `json:"group" yaml:"group"`
-	// 要消费/订阅的主题
+	// 要消费/订阅的主题，也是 NewMessage 发送的默认主题
 	Topic string `json:"topic" yaml:"topic"`
+	// 同一消费者组订阅的多个主题及标签，由 StartMultiConsumer 使用
+	Subscriptions []Subscription `json:"subscriptions" yaml:"subscriptions"`
 	// 如果配置了ACL，需提供验证信息
 	Auth auth `json:"auth" yaml:"auth"`
 	// 是否是广播消费模式
@@ -37,16 +42,73 @@ type ClientConfig struct {
 	Retry int `json:"retry" yaml:"retry"`
 	// 生产超时时间
 	Timeout int `json:"timeout" yaml:"timeout"`
+	// 生产者未完成发送（含异步发送）的数量上限，默认1024
+	MaxInflight int `json:"maxInflight" yaml:"maxInflight"`
+	// 消费失败的最大重试次数，超过后转入死信主题，默认使用 Retry
+	MaxReconsumeTimes int `json:"maxReconsumeTimes" yaml:"maxReconsumeTimes"`
+	// 死信主题，为空时由Broker投递到默认死信队列 %DLQ%{Group}
+	DeadLetterTopic string `json:"deadLetterTopic" yaml:"deadLetterTopic"`
+	// 批量消费时每批的最大消息数，默认32
+	BatchSize int `json:"batchSize" yaml:"batchSize"`
+	// 推模式消费者每次拉取后等待的时间（毫秒），默认不等待。
+	// 批量消费时可减少拉取次数，但每批的消息数仍取决于单次拉取到的消息，不会等待凑满 BatchSize
+	PullInterval int `json:"pullInterval" yaml:"pullInterval"`
+	// 同时进行的消费回调数上限，默认不限制
+	ConsumeGoroutines int `json:"consumeGoroutines" yaml:"consumeGoroutines"`
+	// 每次从Broker拉取的消息数，默认32
+	PullBatchSize int `json:"pullBatchSize" yaml:"pullBatchSize"`
+	// 每秒最多消费的消息数，用于保护下游，默认不限制
+	MaxConsumePerSecond int `json:"maxConsumePerSecond" yaml:"maxConsumePerSecond"`
+	// 消息体超过该字节数时使用gzip压缩后发送，消费时自动解压，默认不压缩
+	CompressThreshold int `json:"compressThreshold" yaml:"compressThreshold"`
+	// 接收 Request 响应的主题，各服务需使用不同的主题，配置后 StartProducer 同时启动响应消费者
+	ReplyTopic string `json:"replyTopic" yaml:"replyTopic"`
+	// Request 等待响应的超时时间（毫秒），ctx 有截止时间时以 ctx 为准，默认3000
+	RequestTimeout int `json:"requestTimeout" yaml:"requestTimeout"`
+	// 名字服务器的接入方式：http（默认）通过本地HTTP服务提供地址，direct 将解析后的地址直接交给SDK
+	NamingMode string `json:"namingMode" yaml:"namingMode"`
+	// direct 模式下重新解析名字服务器域名的间隔（秒），默认30
+	DnsRefreshInterval int `json:"dnsRefreshInterval" yaml:"dnsRefreshInterval"`
+}
+
+// Subscription 订阅的主题及要消费的消息标签，未指定标签时消费全部消息
+type Subscription struct {
+	Topic string   `json:"topic" yaml:"topic"`
+	Tags  []string `json:"tags" yaml:"tags"`
 }
 
 // Client 为客户端主体结构
 type client struct {
 	*ClientConfig
-	mu sync.RWMutex
+	mu      sync.RWMutex
+	service string
+
+	producer            *rmqProducer
+	forwardProducer     *rmqProducer
+	transactionProducer *rmqTransactionProducer
+	pushConsumer        *rmqPushConsumer
+	pullConsumer        *rmqPullConsumer
+	replyConsumer       *rmqPushConsumer
+	namingListener      net.Listener
+	resolver            *dnsResolver
+	middlewares         []MessageMiddleware
+	sendInterceptors    []SendInterceptor
 
-	producer       *rmqProducer
-	pushConsumer   *rmqPushConsumer
-	namingListener net.Listener
+	// replies 等待响应的请求，关联ID -> chan *messageWrapper
+	replies sync.Map
+	// forwarded 整批重试时已转发的延迟消息及已单独投递死信的消息，MsgId -> 过期时间
+	forwarded sync.Map
+}
+
+// startNaming 按 NamingMode 启动名字服务
+func (c *client) startNaming() error {
+	if c.NamingMode != NamingDirect {
+		return c.startNamingHandler()
+	}
+	c.resolver = newDnsResolver(c.service, c.lookupNameServers)
+	c.resolver.refresh()
+	c.resolver.start(time.Duration(c.DnsRefreshInterval) * time.Second)
+	return nil
 }
 
 func (c *client) startNamingHandler() error {
@@ -57,19 +119,42 @@ func (c *client) startNamingHandler() error {
 		return err
 	}
 
-	go func() {
-		err = http.Serve(c.namingListener, c.createNamingHandler())
+	go func(l net.Listener) {
+		err := http.Serve(l, c.createNamingHandler())
+		if errors.Is(err, net.ErrClosed) {
+			wrapLogger(zlog.InfoLogger, nil, "naming handler stopped", zap.String("service", c.service))
+			return
+		}
 		wrapLogger(zlog.ErrorLogger, nil, "naming handler stopped", zap.String("error", err.Error()))
-	}()
+	}(c.namingListener)
 
 	return nil
 }
 
-func (c *client) getNameserverDomain() (string, error) {
+// stopNamingHandler 关闭名字服务的监听并停止定期解析，之后不能再启动生产者或消费者
+func (c *client) stopNamingHandler() error {
+	c.mu.Lock()
+	l, r := c.namingListener, c.resolver
+	c.namingListener, c.resolver = nil, nil
+	c.mu.Unlock()
+	if r != nil {
+		r.stop()
+	}
+	if l == nil {
+		return nil
+	}
+	return l.Close()
+}
+
+// nsResolver 获取生产者、消费者使用的名字服务器解析器，调用方需持有锁
+func (c *client) nsResolver() (primitive.NsResolver, error) {
+	if c.resolver != nil {
+		return c.resolver, nil
+	}
 	if c.namingListener != nil {
-		return "https://" + c.namingListener.Addr().String(), nil
+		return primitive.NewHttpResolver("DEFAULT", "https://"+c.namingListener.Addr().String()), nil
 	}
-	return "", ErrRmqSvcInvalidOperation
+	return nil, ErrRmqSvcInvalidOperation
 }
 
 func (c *client) createNamingHandler() http.HandlerFunc {
@@ -91,11 +176,21 @@ func (c *client) createNamingHandler() http.HandlerFunc {
 }
 
 func (c *client) getHostListByDns() (hostList string) {
+	return strings.Join(c.resolveNameServers(false), ";")
+}
+
+// lookupNameServers 解析 direct 模式下交给SDK的地址，SDK仅支持IPv4地址
+func (c *client) lookupNameServers() []string {
+	return c.resolveNameServers(true)
+}
+
+// resolveNameServers 将配置的名字服务器域名解析为 ip:port 列表
+func (c *client) resolveNameServers(ipv4Only bool) []string {
 	wrapLogger(zlog.DebugLogger, nil, "try serve through static config, nameServer",
 		zap.Strings("ns", c.ClientConfig.NameServers),
 	)
 
-	var firstItem = true
+	var hostList []string
 	for _, ns := range c.ClientConfig.NameServers {
 		var parts = strings.Split(ns, ":")
 		if len(parts) != 2 {
@@ -113,12 +208,10 @@ func (c *client) getHostListByDns() (hostList string) {
 		}
 
 		for _, addr := range addressList {
-			if !firstItem {
-				hostList += ";"
+			if ipv4Only && net.ParseIP(addr).To4() == nil {
+				continue
 			}
-
-			hostList += addr + ":" + port
-			firstItem = false
+			hostList = append(hostList, addr+":"+port)
 		}
 	}
 
@@ -149,6 +242,21 @@ const (
 	Hours2
 )
 
+var delayLevelDurations = []time.Duration{
+	time.Second, 5 * time.Second, 10 * time.Second, 30 * time.Second,
+	time.Minute, 2 * time.Minute, 3 * time.Minute, 4 * time.Minute, 5 * time.Minute,
+	6 * time.Minute, 7 * time.Minute, 8 * time.Minute, 9 * time.Minute, 10 * time.Minute,
+	20 * time.Minute, 30 * time.Minute, time.Hour, 2 * time.Hour,
+}
+
+// Duration 返回延迟等级对应的延迟时间（Broker默认配置），无效等级返回0
+func (l DelayLevel) Duration() time.Duration {
+	if l < Second || l > Hours2 {
+		return 0
+	}
+	return delayLevelDurations[l-1]
+}
+
 func init() {
 	rlog.SetLogger(&rmqLogger{})
 }
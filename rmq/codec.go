@@ -0,0 +1,224 @@
+package rmq
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/derekAHua/goLib/zlog"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/protobuf/proto"
+	"go.uber.org/zap"
+)
+
+// PropertyContentType 消息体编码方式，由 NewTypedMessage 写入，消费时据此选择解码器
+const PropertyContentType = "CONTENT_TYPE"
+
+// ErrRmqCodecUnsupported 编解码器不支持该类型的值或消息的编码方式
+var ErrRmqCodecUnsupported = errors.New("rmq codec does not support the value or content type")
+
+// Codec 消息体编解码器
+type Codec interface {
+	// ContentType 编码方式，记录在消息属性中
+	ContentType() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string { return "application/json" }
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) { return json.Marshal(v) }
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+type protobufCodec struct{}
+
+func (protobufCodec) ContentType() string { return "application/x-protobuf" }
+
+func (protobufCodec) Marshal(v interface{}) ([]byte, error) {
+	pb, ok := v.(proto.Message)
+	if !ok {
+		return nil, ErrRmqCodecUnsupported
+	}
+	return proto.Marshal(pb)
+}
+
+func (protobufCodec) Unmarshal(data []byte, v interface{}) error {
+	pb, ok := v.(proto.Message)
+	if !ok {
+		return ErrRmqCodecUnsupported
+	}
+	return proto.Unmarshal(data, pb)
+}
+
+var (
+	// JSONCodec 使用 encoding/json 编解码
+	JSONCodec Codec = jsonCodec{}
+	// ProtobufCodec 使用protobuf编解码，值需要实现 proto.Message
+	ProtobufCodec Codec = protobufCodec{}
+)
+
+var (
+	codecs   = map[string]Codec{}
+	codecsMu sync.RWMutex
+)
+
+// RegisterCodec 注册编解码器，消费时按消息的 PropertyContentType 查找，相同编码方式的会被覆盖
+func RegisterCodec(codec Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[codec.ContentType()] = codec
+}
+
+func getCodec(contentType string) (Codec, bool) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	codec, ok := codecs[contentType]
+	return codec, ok
+}
+
+func init() {
+	RegisterCodec(JSONCodec)
+	RegisterCodec(ProtobufCodec)
+}
+
+// NewTypedMessage 以 codec 编码 v 作为消息体，发送到服务配置的主题
+func NewTypedMessage(service string, v interface{}, codec Codec) (Message, error) {
+	body, err := codec.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	msg, err := NewMessage(service, body)
+	if err != nil {
+		return nil, err
+	}
+	msg.(*messageWrapper).msg.WithProperty(PropertyContentType, codec.ContentType())
+	return msg, nil
+}
+
+// NewTypedMessageTo 以 codec 编码 v 作为消息体，发送到指定主题 topic
+func NewTypedMessageTo(service string, topic string, v interface{}, codec Codec) (Message, error) {
+	body, err := codec.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	msg, err := NewMessageTo(service, topic, body)
+	if err != nil {
+		return nil, err
+	}
+	msg.(*messageWrapper).msg.WithProperty(PropertyContentType, codec.ContentType())
+	return msg, nil
+}
+
+// DecodeMessage 按消息的编码方式将消息体解码到 v，未记录编码方式时使用 fallback，fallback 为nil时使用 JSONCodec
+func DecodeMessage(msg Message, v interface{}, fallback Codec) error {
+	codec := fallback
+	if m, ok := msg.(*messageWrapper); ok {
+		if ct := m.msg.GetProperty(PropertyContentType); ct != "" {
+			if codec, ok = getCodec(ct); !ok {
+				wrapLogger(zlog.WarnLogger, nil, "no codec registered for content type",
+					zap.String("contentType", ct),
+					zap.String("msgId", msg.GetID()))
+				return ErrRmqCodecUnsupported
+			}
+		}
+	}
+	if codec == nil {
+		codec = JSONCodec
+	}
+	return codec.Unmarshal(msg.GetContent(), v)
+}
+
+// DecodeErrorHandler 处理解码失败的消息，返回值作为消费结果
+type DecodeErrorHandler func(ctx *gin.Context, msg Message, err error) error
+
+type typedOptions struct {
+	codec   Codec
+	onError DecodeErrorHandler
+}
+
+// TypedOption 类型化消费回调的配置项
+type TypedOption func(*typedOptions)
+
+// WithDefaultCodec 消息未记录编码方式时使用的解码器，默认 JSONCodec
+func WithDefaultCodec(codec Codec) TypedOption {
+	return func(o *typedOptions) {
+		o.codec = codec
+	}
+}
+
+// WithDecodeErrorHandler 解码失败时的处理，默认记录日志后投递死信（见 DeadLetter），
+// 返回 Drop(err) 丢弃消息，返回nil视为消费成功
+func WithDecodeErrorHandler(handler DecodeErrorHandler) TypedOption {
+	return func(o *typedOptions) {
+		o.onError = handler
+	}
+}
+
+var (
+	ginContextType = reflect.TypeOf((*gin.Context)(nil))
+	messageType    = reflect.TypeOf((*Message)(nil)).Elem()
+	errorType      = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// Typed 将类型化的处理函数转换为 MessageCallback，消息体按编码方式解码后作为处理函数的最后一个参数。
+// handler 的签名为以下之一，T 为任意可解码的类型:
+//
+//	func(ctx *gin.Context, v *T) error
+//	func(ctx *gin.Context, msg Message, v *T) error
+//
+// handler 为nil或签名不符合要求时 panic
+func Typed(handler interface{}, opts ...TypedOption) MessageCallback {
+	o := typedOptions{
+		onError: func(ctx *gin.Context, msg Message, err error) error {
+			return DeadLetter(err)
+		},
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	fn := reflect.ValueOf(handler)
+	if !fn.IsValid() || fn.Kind() != reflect.Func || fn.IsNil() {
+		panic("rmq: invalid typed handler")
+	}
+	t := fn.Type()
+	if t.NumOut() != 1 || t.Out(0) != errorType ||
+		t.NumIn() < 2 || t.NumIn() > 3 || t.In(0) != ginContextType ||
+		(t.NumIn() == 3 && t.In(1) != messageType) {
+		panic(fmt.Sprintf("rmq: invalid typed handler %s", t))
+	}
+	argType := t.In(t.NumIn() - 1)
+
+	return func(ctx *gin.Context, msg Message) error {
+		var v reflect.Value
+		if argType.Kind() == reflect.Ptr {
+			v = reflect.New(argType.Elem())
+		} else {
+			v = reflect.New(argType)
+		}
+		if err := DecodeMessage(msg, v.Interface(), o.codec); err != nil {
+			wrapLogger(zlog.ErrorLogger, ctx, "failed to decode message",
+				zap.String("msgId", msg.GetID()),
+				zap.String("type", argType.String()),
+				zap.String("error", err.Error()))
+			return o.onError(ctx, msg, err)
+		}
+		if argType.Kind() != reflect.Ptr {
+			v = v.Elem()
+		}
+
+		args := []reflect.Value{reflect.ValueOf(ctx), v}
+		if t.NumIn() == 3 {
+			args = []reflect.Value{reflect.ValueOf(ctx), reflect.ValueOf(&msg).Elem(), v}
+		}
+		if err := fn.Call(args)[0].Interface(); err != nil {
+			return err.(error)
+		}
+		return nil
+	}
+}
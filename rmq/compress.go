@@ -0,0 +1,97 @@
+package rmq
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io/ioutil"
+
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/derekAHua/goLib/zlog"
+	"go.uber.org/zap"
+)
+
+const (
+	// PropertyContentEncoding 消息体的压缩方式，消费时据此解压，无法解压的消息不交给回调，直接投递死信
+	PropertyContentEncoding = "CONTENT_ENCODING"
+	// EncodingGzip gzip 压缩
+	EncodingGzip = "gzip"
+)
+
+// ErrRmqUnsupportedEncoding 消息的压缩方式不支持，消息体无法解压
+var ErrRmqUnsupportedEncoding = errors.New("rmq message content encoding is not supported")
+
+// compressMessages 将消息体超过 threshold 字节的消息压缩后返回其副本，原消息不变。
+// threshold 不大于0或消息已压缩时不处理
+func compressMessages(threshold int, msgList []*primitive.Message) ([]*primitive.Message, error) {
+	if threshold <= 0 {
+		return msgList, nil
+	}
+	var out []*primitive.Message
+	for i, m := range msgList {
+		if len(m.Body) <= threshold || m.GetProperty(PropertyContentEncoding) != "" {
+			if out != nil {
+				out = append(out, m)
+			}
+			continue
+		}
+		if out == nil {
+			out = append(make([]*primitive.Message, 0, len(msgList)), msgList[:i]...)
+		}
+		cp, err := compressMessage(m)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, cp)
+	}
+	if out == nil {
+		return msgList, nil
+	}
+	return out, nil
+}
+
+func compressMessage(m *primitive.Message) (*primitive.Message, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(m.Body); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	cp := primitive.NewMessage(m.Topic, buf.Bytes())
+	cp.WithProperties(m.GetProperties())
+	cp.WithProperty(PropertyContentEncoding, EncodingGzip)
+	cp.Flag, cp.TransactionId = m.Flag, m.TransactionId
+	return cp, nil
+}
+
+// decompressMessage 解压消费到的消息，成功后移除压缩属性，转发时按生产者的配置重新压缩。
+// 压缩方式不支持或解压失败时返回错误，保留原消息体及属性
+func decompressMessage(m *primitive.MessageExt) error {
+	encoding := m.GetProperty(PropertyContentEncoding)
+	if encoding == "" {
+		return nil
+	}
+	if encoding != EncodingGzip {
+		wrapLogger(zlog.ErrorLogger, nil, "unsupported message content encoding",
+			zap.String("msgId", m.MsgId),
+			zap.String("encoding", encoding))
+		return ErrRmqUnsupportedEncoding
+	}
+
+	r, err := gzip.NewReader(bytes.NewReader(m.Body))
+	if err == nil {
+		var body []byte
+		if body, err = ioutil.ReadAll(r); err == nil {
+			m.Body = body
+			m.RemoveProperty(PropertyContentEncoding)
+			return nil
+		}
+	}
+	wrapLogger(zlog.ErrorLogger, nil, "failed to decompress message",
+		zap.String("msgId", m.MsgId),
+		zap.String("error", err.Error()))
+	return err
+}
@@ -0,0 +1,289 @@
+package rmq
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apache/rocketmq-client-go/v2/consumer"
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/derekAHua/goLib/zlog"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// 死信消息中记录原始信息的属性
+const (
+	PropertyDLQOriginTopic    = "DLQ_ORIGIN_TOPIC"
+	PropertyDLQOriginGroup    = "DLQ_ORIGIN_GROUP"
+	PropertyDLQOriginMsgID    = "DLQ_ORIGIN_MSG_ID"
+	PropertyDLQReason         = "DLQ_REASON"
+	PropertyDLQReconsumeTimes = "DLQ_RECONSUME_TIMES"
+)
+
+const (
+	// defaultMaxReconsumeTimes Broker默认的最大重试次数
+	defaultMaxReconsumeTimes = 16
+	// retryTopicPrefix 消费者组重试主题的前缀，与SDK一致，只有该组的消费者订阅重试主题
+	retryTopicPrefix = "%RETRY%"
+)
+
+// ConsumeAction 消费失败后的处理方式
+type ConsumeAction int
+
+const (
+	// ActionRetry 稍后重试
+	ActionRetry ConsumeAction = iota
+	// ActionDrop 丢弃消息
+	ActionDrop
+	// ActionDeadLetter 投递到死信主题
+	ActionDeadLetter
+)
+
+// ConsumeError 指定了处理方式的消费错误，由 RetryLater、Drop、DeadLetter 创建。
+// 回调返回其他错误时按 ActionRetry 处理
+type ConsumeError struct {
+	Action ConsumeAction
+	Delay  DelayLevel
+	Err    error
+}
+
+func (e *ConsumeError) Error() string {
+	if e.Err == nil {
+		return "rmq consume failed"
+	}
+	return e.Err.Error()
+}
+
+func (e *ConsumeError) Unwrap() error {
+	return e.Err
+}
+
+// RetryLater 在延迟等级 lvl 后重试，顺序消费时挂起当前队列相应的时间
+func RetryLater(lvl DelayLevel, err error) error {
+	return &ConsumeError{Action: ActionRetry, Delay: lvl, Err: err}
+}
+
+// Drop 丢弃消息，不再重试
+func Drop(err error) error {
+	return &ConsumeError{Action: ActionDrop, Err: err}
+}
+
+// DeadLetter 直接投递到死信主题
+func DeadLetter(err error) error {
+	return &ConsumeError{Action: ActionDeadLetter, Err: err}
+}
+
+// maxReconsumeTimes 消费失败的最大重试次数
+func (c *client) maxReconsumeTimes() int {
+	if c.ClientConfig.MaxReconsumeTimes > 0 {
+		return c.ClientConfig.MaxReconsumeTimes
+	}
+	if c.ClientConfig.Retry > 0 {
+		return c.ClientConfig.Retry
+	}
+	return defaultMaxReconsumeTimes
+}
+
+// consumeFailed 根据回调返回的错误决定消息的处理方式
+// 批量消费时 msgList 作为整体处理，其中任一消息超过最大重试次数时整批投递死信
+func (c *client) consumeFailed(ctx context.Context, err error, msgList ...*primitive.MessageExt) consumer.ConsumeResult {
+	action, delay := ActionRetry, DelayLevel(0)
+	var ce *ConsumeError
+	if errors.As(err, &ce) {
+		action, delay = ce.Action, ce.Delay
+	}
+
+	var (
+		msgIDs    = make([]string, 0, len(msgList))
+		topic     = c.ClientConfig.Topic
+		reconsume int32
+	)
+	for _, m := range msgList {
+		topic = m.Topic
+		msgIDs = append(msgIDs, m.MsgId)
+		if m.ReconsumeTimes > reconsume {
+			reconsume = m.ReconsumeTimes
+		}
+	}
+	if action == ActionRetry && int(reconsume) >= c.maxReconsumeTimes() {
+		action = ActionDeadLetter
+	}
+
+	fields := []zlog.Field{
+		zap.String("topic", topic),
+		zap.Strings("msgIds", msgIDs),
+		zap.Int32("reconsumeTimes", reconsume),
+		zap.String("error", err.Error()),
+	}
+	switch action {
+	case ActionDrop:
+		wrapLogger(zlog.WarnLogger, nil, "rmq message dropped", fields...)
+		return consumer.ConsumeSuccess
+	case ActionDeadLetter:
+		if c.ClientConfig.DeadLetterTopic == "" {
+			// 并发消费时 -1 表示由Broker直接投递到默认死信队列
+			if cc, ok := primitive.GetConcurrentlyCtx(ctx); ok {
+				wrapLogger(zlog.WarnLogger, nil, "rmq message sent to broker dead letter queue", fields...)
+				cc.DelayLevelWhenNextConsume = -1
+				return consumer.ConsumeRetryLater
+			}
+			break
+		}
+		if dlqErr := c.sendToDeadLetter(err, msgList...); dlqErr != nil {
+			fields = append(fields, zap.String("dlqError", dlqErr.Error()))
+			wrapLogger(zlog.ErrorLogger, nil, "failed to send message to dead letter topic", fields...)
+			break
+		}
+		wrapLogger(zlog.WarnLogger, nil, "rmq message sent to dead letter topic",
+			append(fields, zap.String("deadLetterTopic", c.ClientConfig.DeadLetterTopic))...)
+		return consumer.ConsumeSuccess
+	}
+	return c.retryLater(ctx, delay)
+}
+
+func (c *client) retryLater(ctx context.Context, delay DelayLevel) consumer.ConsumeResult {
+	if c.ClientConfig.Orderly {
+		if oc, ok := primitive.GetOrderlyCtx(ctx); ok && delay.Duration() > 0 {
+			oc.SuspendCurrentQueueTimeMillis = int(delay.Duration() / time.Millisecond)
+		}
+		return consumer.SuspendCurrentQueueAMoment
+	}
+	if cc, ok := primitive.GetConcurrentlyCtx(ctx); ok && delay.Duration() > 0 {
+		cc.DelayLevelWhenNextConsume = int(delay)
+	}
+	return consumer.ConsumeRetryLater
+}
+
+// forwardExcludedProperties 转发时不复制的系统属性
+var forwardExcludedProperties = []string{
+	primitive.PropertyUniqueClientMessageIdKeyIndex,
+	primitive.PropertyDelayTimeLevel,
+	primitive.PropertyRetryTopic,
+	primitive.PropertyRealTopic,
+	primitive.PropertyRealQueueId,
+	primitive.PropertyMinOffset,
+	primitive.PropertyMaxOffset,
+	primitive.PropertyReconsumeTime,
+	primitive.PropertyMaxReconsumeTimes,
+	primitive.PropertyConsumeStartTime,
+	primitive.PropertyTransactionPrepared,
+	primitive.PropertyProducerGroup,
+}
+
+// deadLetterExcludedProperties 投递死信时额外不复制的属性，延迟消息到期后才会被消费，重新投递时不应再次转发
+var deadLetterExcludedProperties = []string{
+	PropertyDeliverAt,
+	PropertyDelayOwner,
+}
+
+// redriveExcludedProperties 重新投递死信时不复制的属性
+var redriveExcludedProperties = append([]string{
+	PropertyDLQOriginTopic,
+	PropertyDLQOriginGroup,
+	PropertyDLQOriginMsgID,
+	PropertyDLQReason,
+	PropertyDLQReconsumeTimes,
+}, deadLetterExcludedProperties...)
+
+// copyMessage 复制消息体及业务属性到新主题，不复制系统属性及 excluded 中的属性
+func copyMessage(topic string, m *primitive.Message, excluded ...string) *primitive.Message {
+	msg := primitive.NewMessage(topic, m.Body)
+	props := m.GetProperties()
+	for _, k := range forwardExcludedProperties {
+		delete(props, k)
+	}
+	for _, k := range excluded {
+		delete(props, k)
+	}
+	msg.WithProperties(props)
+	return msg
+}
+
+// originTopic 返回消息的原主题，SDK消费重试消息时主题为 %RETRY%group，原主题记录在 RETRY_TOPIC 属性中
+func originTopic(m *primitive.MessageExt) string {
+	if topic := m.GetProperty(primitive.PropertyRetryTopic); topic != "" && strings.HasPrefix(m.Topic, retryTopicPrefix) {
+		return topic
+	}
+	return m.Topic
+}
+
+func (c *client) sendToDeadLetter(cause error, msgList ...*primitive.MessageExt) error {
+	prod, err := c.getForwardProducer()
+	if err != nil {
+		return err
+	}
+
+	for _, m := range msgList {
+		msg := copyMessage(c.ClientConfig.DeadLetterTopic, &m.Message, deadLetterExcludedProperties...)
+		msg.WithProperty(PropertyDLQOriginTopic, originTopic(m))
+		msg.WithProperty(PropertyDLQOriginGroup, c.ClientConfig.Group)
+		msg.WithProperty(PropertyDLQOriginMsgID, m.MsgId)
+		msg.WithProperty(PropertyDLQReason, truncate(cause.Error(), 512))
+		msg.WithProperty(PropertyDLQReconsumeTimes, strconv.Itoa(int(m.ReconsumeTimes)))
+		if _, _, _, err := prod.SendMessage(context.Background(), msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RedriveFilter 决定死信消息是否重新投递，返回false时丢弃该消息
+type RedriveFilter func(ctx *gin.Context, msg Message) bool
+
+// Redrive 返回将死信消息重新投递给原消费者组的消费回调，用于消费死信主题的服务，例如:
+//
+//	StartConsumer(g, "order-dlq", nil, Redrive("order", nil))
+//
+// 消息发送到原消费者组的重试主题 %RETRY%group，只有该组会再次消费，订阅原主题的其他消费者组不受影响；
+// 未记录原消费者组的死信消息（如Broker投递的死信）发送回原主题，此时订阅该主题的全部消费者组都会再次消费。
+// 消息通过已启动生产者的服务 service 发送，filter 为nil时全部重新投递
+func Redrive(service string, filter RedriveFilter) MessageCallback {
+	return func(ctx *gin.Context, msg Message) error {
+		dead, ok := msg.(*messageWrapper)
+		if !ok {
+			return ErrRmqSvcInvalidOperation
+		}
+		if filter != nil && !filter(ctx, msg) {
+			wrapLogger(zlog.InfoLogger, ctx, "dead letter message skipped", zap.String("msgId", dead.msgID))
+			return nil
+		}
+
+		topic := dead.msg.GetProperty(PropertyDLQOriginTopic)
+		group := dead.msg.GetProperty(PropertyDLQOriginGroup)
+		var (
+			m   Message
+			err error
+		)
+		switch {
+		case topic != "" && group != "":
+			m, err = NewMessageTo(service, retryTopicPrefix+group, nil)
+		case topic != "":
+			m, err = NewMessageTo(service, topic, nil)
+		default:
+			m, err = NewMessage(service, nil)
+		}
+		if err != nil {
+			return err
+		}
+		w := m.(*messageWrapper)
+		w.msg = copyMessage(w.msg.Topic, dead.msg, redriveExcludedProperties...)
+		if group != "" {
+			w.msg.WithProperty(primitive.PropertyRetryTopic, topic)
+		}
+
+		msgID, err := w.SendContext(ctx)
+		if err != nil {
+			return err
+		}
+		wrapLogger(zlog.InfoLogger, ctx, "dead letter message redriven",
+			zap.String("msgId", dead.msgID),
+			zap.String("originMsgId", dead.msg.GetProperty(PropertyDLQOriginMsgID)),
+			zap.String("topic", w.msg.Topic),
+			zap.String("newMsgId", msgID),
+		)
+		return nil
+	}
+}
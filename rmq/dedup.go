@@ -0,0 +1,143 @@
+package rmq
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/derekAHua/goLib/redis"
+	"github.com/derekAHua/goLib/zlog"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// ErrRmqMessageProcessing 相同的消息正在被其他消费者处理，稍后重试
+var ErrRmqMessageProcessing = errors.New("rmq message is being processed by another consumer")
+
+const (
+	dedupProcessing = "processing"
+	dedupDone       = "done"
+
+	// dedupClearScript 仅当处理中标记仍属于本次消费时删除，标记过期后可能已被其他消费者重新占用
+	dedupClearScript = "if redis.call('GET', KEYS[1]) == ARGV[1] then return redis.call('DEL', KEYS[1]) else return 0 end"
+)
+
+type dedupOptions struct {
+	prefix        string
+	property      string
+	ttl           time.Duration
+	processingTTL time.Duration
+}
+
+// DedupOption 消息去重配置项
+type DedupOption func(*dedupOptions)
+
+// WithDedupPrefix redis key前缀，默认 rmq:dedup:
+func WithDedupPrefix(prefix string) DedupOption {
+	return func(o *dedupOptions) {
+		o.prefix = prefix
+	}
+}
+
+// WithDedupProperty 使用消息属性 name 的值（业务键）去重，属性为空时使用消息ID
+func WithDedupProperty(name string) DedupOption {
+	return func(o *dedupOptions) {
+		o.property = name
+	}
+}
+
+// WithDedupTTL 已消费记录的保留时间，默认24小时
+func WithDedupTTL(ttl time.Duration) DedupOption {
+	return func(o *dedupOptions) {
+		o.ttl = ttl
+	}
+}
+
+// WithDedupProcessingTTL 消费中标记的过期时间，默认5分钟。
+// 消费者崩溃时标记过期后消息可被重新消费，应大于单条消息的最长处理时间
+func WithDedupProcessingTTL(ttl time.Duration) DedupOption {
+	return func(o *dedupOptions) {
+		o.processingTTL = ttl
+	}
+}
+
+// Dedup 基于redis的幂等消费中间件，group 用于区分不同的消费者组。
+// 消费前标记为处理中，成功后标记为已完成；失败时清除本次消费的标记以便重试；
+// 已完成的消息直接跳过，处理中的消息返回 ErrRmqMessageProcessing 稍后重试
+func Dedup(rds *redis.Redis, group string, opts ...DedupOption) MessageMiddleware {
+	o := dedupOptions{
+		prefix:        "rmq:dedup:",
+		ttl:           24 * time.Hour,
+		processingTTL: 5 * time.Minute,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return func(next MessageCallback) MessageCallback {
+		return func(ctx *gin.Context, msg Message) error {
+			id := o.messageKey(msg)
+			if id == "" {
+				return next(ctx, msg)
+			}
+			key := o.prefix + group + ":" + id
+			// 处理中标记带上本次消费的唯一标识，失败时只清除自己的标记
+			token := dedupProcessing + ":" + strconv.FormatInt(generateSnowflake(), 10)
+
+			ok, err := rds.SetNxByPX(ctx, key, token, uint64(o.processingTTL/time.Millisecond))
+			if err != nil {
+				wrapLogger(zlog.ErrorLogger, ctx, "failed to mark message processing",
+					zap.String("key", key),
+					zap.String("error", err.Error()))
+				return err
+			}
+			if !ok {
+				state, err := rds.Get(ctx, key)
+				if err != nil {
+					return err
+				}
+				if string(state) == dedupDone {
+					wrapLogger(zlog.InfoLogger, ctx, "skip duplicated message",
+						zap.String("key", key),
+						zap.String("tag", msg.GetTag()))
+					return nil
+				}
+				wrapLogger(zlog.WarnLogger, ctx, "message is being processed",
+					zap.String("key", key),
+					zap.String("tag", msg.GetTag()))
+				return ErrRmqMessageProcessing
+			}
+
+			if err = next(ctx, msg); err != nil {
+				if _, delErr := rds.Lua(ctx, dedupClearScript, 1, key, token); delErr != nil {
+					wrapLogger(zlog.ErrorLogger, ctx, "failed to clear message processing mark",
+						zap.String("key", key),
+						zap.String("error", delErr.Error()))
+				}
+				return err
+			}
+
+			if err = rds.SetEx(ctx, key, dedupDone, int64(o.ttl/time.Second)); err != nil {
+				// 消息已处理成功，仅记录日志，标记过期后可能被重复消费
+				wrapLogger(zlog.ErrorLogger, ctx, "failed to mark message done",
+					zap.String("key", key),
+					zap.String("error", err.Error()))
+			}
+			return nil
+		}
+	}
+}
+
+// messageKey 优先使用业务键，其次使用消息ID（重试时不变）
+func (o *dedupOptions) messageKey(msg Message) string {
+	m, ok := msg.(*messageWrapper)
+	if !ok {
+		return msg.GetID()
+	}
+	if o.property != "" {
+		if v := m.msg.GetProperty(o.property); v != "" {
+			return v
+		}
+	}
+	return m.msgID
+}
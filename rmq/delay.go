@@ -0,0 +1,163 @@
+package rmq
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/derekAHua/goLib/env"
+	"github.com/derekAHua/goLib/zlog"
+	"go.uber.org/zap"
+)
+
+const (
+	// PropertyDeliverAt 任意时间延迟消息的投递时间（毫秒时间戳）
+	PropertyDeliverAt = "RMQ_DELIVER_AT"
+	// PropertyDelayOwner 转发延迟消息的消费者组，广播模式下还包含实例的IP，其他消费者忽略该副本
+	PropertyDelayOwner = "RMQ_DELAY_OWNER"
+)
+
+const (
+	// delayHopTolerance 距投递时间不足该值时视为已到期，避免Broker调度误差导致多一次中转
+	delayHopTolerance = 100 * time.Millisecond
+	// forwardedTTL 记录已转发消息的时间，需覆盖消费重试的最长间隔(2小时)
+	forwardedTTL = 3 * time.Hour
+)
+
+// delayLevelFor 返回不超过 remaining 的最大延迟等级，到期时返回0，不足1秒时使用 Second
+func delayLevelFor(remaining time.Duration) DelayLevel {
+	if remaining <= delayHopTolerance {
+		return 0
+	}
+	for lvl := Hours2; lvl > Second; lvl-- {
+		if lvl.Duration() <= remaining {
+			return lvl
+		}
+	}
+	return Second
+}
+
+// deliverAt 解析消息的投递时间，未设置时返回false
+func deliverAt(msg *primitive.Message) (time.Time, bool) {
+	v := msg.GetProperty(PropertyDeliverAt)
+	if v == "" {
+		return time.Time{}, false
+	}
+	ms, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, ms*int64(time.Millisecond)), true
+}
+
+func (m *messageWrapper) WithDelayUntil(t time.Time) Message {
+	m.msg.WithProperty(PropertyDeliverAt, strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10))
+	if lvl := delayLevelFor(time.Until(t)); lvl > 0 {
+		m.msg = m.msg.WithDelayTimeLevel(int(lvl))
+	}
+	return m
+}
+
+func (m *messageWrapper) WithDelayDuration(d time.Duration) Message {
+	return m.WithDelayUntil(time.Now().Add(d))
+}
+
+// delayOwner 转发延迟消息时标记的归属，集群模式为消费者组；
+// 广播模式下各实例分别转发，以本机IP区分实例，重启后仍能消费自己转发的副本
+func (c *client) delayOwner() string {
+	if c.ClientConfig.Broadcast {
+		return c.ClientConfig.Group + "@" + env.LocalIP
+	}
+	return c.ClientConfig.Group
+}
+
+// hopDue 转发一批消息中未到投递时间的延迟消息，返回需要消费的消息。
+// 中途转发失败时记录已转发的消息，整批重新投递后不再重复转发
+func (c *client) hopDue(msgList []*primitive.MessageExt) ([]*primitive.MessageExt, error) {
+	due := make([]*primitive.MessageExt, 0, len(msgList))
+	for i, m := range msgList {
+		hopped, err := c.hopDelayed(m)
+		if err != nil {
+			c.rememberForwarded(msgList[:i], due)
+			return nil, err
+		}
+		if !hopped {
+			due = append(due, m)
+		}
+	}
+	return due, nil
+}
+
+// rememberForwarded 记录 msgList 中已转发（不在 due 中）的消息，并清理过期的记录
+func (c *client) rememberForwarded(msgList, due []*primitive.MessageExt) {
+	now := time.Now()
+	c.forwarded.Range(func(k, v interface{}) bool {
+		if now.After(v.(time.Time)) {
+			c.forwarded.Delete(k)
+		}
+		return true
+	})
+	pending := make(map[string]bool, len(due))
+	for _, m := range due {
+		pending[m.MsgId] = true
+	}
+	for _, m := range msgList {
+		if !pending[m.MsgId] {
+			c.forwarded.Store(m.MsgId, now.Add(forwardedTTL))
+		}
+	}
+}
+
+// alreadyForwarded 返回消息是否已在之前的消费中转发，见 rememberForwarded，记录随之删除
+func (c *client) alreadyForwarded(m *primitive.MessageExt) bool {
+	v, ok := c.forwarded.Load(m.MsgId)
+	if !ok {
+		return false
+	}
+	c.forwarded.Delete(m.MsgId)
+	return time.Now().Before(v.(time.Time))
+}
+
+// hopDelayed 未到投递时间的消息以剩余时间对应的延迟等级重新发送到原主题，返回是否已转发。
+// 各消费者组（广播模式下各实例）分别转发原消息，副本标记归属后只由转发方消费，其他消费者直接确认
+func (c *client) hopDelayed(m *primitive.MessageExt) (bool, error) {
+	at, ok := deliverAt(&m.Message)
+	if !ok {
+		return false, nil
+	}
+	if c.alreadyForwarded(m) {
+		wrapLogger(zlog.DebugLogger, nil, "ignore delayed message already forwarded", zap.String("msgId", m.MsgId))
+		return true, nil
+	}
+	owner := c.delayOwner()
+	if o := m.GetProperty(PropertyDelayOwner); o != "" && o != owner {
+		wrapLogger(zlog.DebugLogger, nil, "ignore delayed message forwarded by other consumer",
+			zap.String("msgId", m.MsgId),
+			zap.String("owner", o))
+		return true, nil
+	}
+	lvl := delayLevelFor(time.Until(at))
+	if lvl == 0 {
+		return false, nil
+	}
+
+	prod, err := c.getForwardProducer()
+	if err != nil {
+		return false, err
+	}
+	msg := copyMessage(m.Topic, &m.Message).WithDelayTimeLevel(int(lvl))
+	msg.WithProperty(PropertyDelayOwner, owner)
+	if _, _, _, err = prod.SendMessage(context.Background(), msg); err != nil {
+		wrapLogger(zlog.ErrorLogger, nil, "failed to forward delayed message",
+			zap.String("msgId", m.MsgId),
+			zap.String("error", err.Error()))
+		return false, err
+	}
+	wrapLogger(zlog.DebugLogger, nil, "rmq delayed message forwarded",
+		zap.String("topic", m.Topic),
+		zap.String("msgId", m.MsgId),
+		zap.Time("deliverAt", at),
+		zap.Int("delayLevel", int(lvl)))
+	return true, nil
+}
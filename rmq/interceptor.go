@@ -0,0 +1,141 @@
+package rmq
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/derekAHua/goLib/zlog"
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrRmqMessageTooLarge 消息体超过 MaxBodySize 限制
+	ErrRmqMessageTooLarge = errors.New("rmq message body is too large")
+	// ErrRmqTopicNotAllowed 消息主题不在 AllowTopics 允许的列表中
+	ErrRmqTopicNotAllowed = errors.New("rmq message topic is not allowed")
+)
+
+// SendFunc 发送消息，单条发送时 msgs 只有一条消息；异步及单向发送时消息交给生产者后即返回，msgID 为空
+type SendFunc func(ctx context.Context, msgs []Message) (msgID string, err error)
+
+// SendInterceptor 发送拦截器，包装 SendFunc 以组合通用的发送逻辑，可在调用 next 前修改消息或直接返回错误拒绝发送
+type SendInterceptor func(next SendFunc) SendFunc
+
+// ChainSend 按顺序组合拦截器，第一个拦截器位于最外层
+func ChainSend(send SendFunc, interceptors ...SendInterceptor) SendFunc {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		send = interceptors[i](send)
+	}
+	return send
+}
+
+// UseSendInterceptor 为指定服务注册发送拦截器，对 Message 及 MessageBatch 的全部发送方式生效（含异步、单向及事务消息）
+func UseSendInterceptor(service string, interceptors ...SendInterceptor) error {
+	if client, ok := lookupClient(service); ok {
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		client.sendInterceptors = append(client.sendInterceptors, interceptors...)
+		return nil
+	}
+	return ErrRmqSvcNotRegistered
+}
+
+// sendChain 用服务注册的拦截器包装 send
+func (c *client) sendChain(send SendFunc) SendFunc {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return ChainSend(send, c.sendInterceptors...)
+}
+
+// rawMessages 转换为SDK消息，拦截器替换为其他 Message 实现时返回 ErrRmqSvcInvalidOperation
+func rawMessages(msgs []Message) ([]*primitive.Message, error) {
+	list := make([]*primitive.Message, 0, len(msgs))
+	for _, m := range msgs {
+		w, ok := m.(*messageWrapper)
+		if !ok {
+			return nil, ErrRmqSvcInvalidOperation
+		}
+		list = append(list, w.msg)
+	}
+	return list, nil
+}
+
+// StampProperties 为每条消息设置固定的属性，例如来源服务、环境等
+func StampProperties(props map[string]string) SendInterceptor {
+	return func(next SendFunc) SendFunc {
+		return func(ctx context.Context, msgs []Message) (string, error) {
+			for _, m := range msgs {
+				for k, v := range props {
+					m.WithProperty(k, v)
+				}
+			}
+			return next(ctx, msgs)
+		}
+	}
+}
+
+// MaxBodySize 拒绝发送消息体超过 size 字节的消息。
+// 检查的是压缩前的原始消息体，配置了 CompressThreshold 时实际发送的消息可能小于 size
+func MaxBodySize(size int) SendInterceptor {
+	return func(next SendFunc) SendFunc {
+		return func(ctx context.Context, msgs []Message) (string, error) {
+			for _, m := range msgs {
+				if len(m.GetContent()) > size {
+					wrapLogger(zlog.WarnLogger, nil, "rmq message body too large",
+						zap.String("topic", m.GetTopic()),
+						zap.String("tag", m.GetTag()),
+						zap.Int("size", len(m.GetContent())),
+						zap.Int("limit", size),
+					)
+					return "", ErrRmqMessageTooLarge
+				}
+			}
+			return next(ctx, msgs)
+		}
+	}
+}
+
+// AllowTopics 只允许发送到指定的主题
+func AllowTopics(topics ...string) SendInterceptor {
+	allowed := make(map[string]bool, len(topics))
+	for _, topic := range topics {
+		allowed[topic] = true
+	}
+	return func(next SendFunc) SendFunc {
+		return func(ctx context.Context, msgs []Message) (string, error) {
+			for _, m := range msgs {
+				if !allowed[m.GetTopic()] {
+					wrapLogger(zlog.WarnLogger, nil, "rmq message topic not allowed", zap.String("topic", m.GetTopic()))
+					return "", ErrRmqTopicNotAllowed
+				}
+			}
+			return next(ctx, msgs)
+		}
+	}
+}
+
+// SendTiming 记录每次发送的耗时
+func SendTiming() SendInterceptor {
+	return func(next SendFunc) SendFunc {
+		return func(ctx context.Context, msgs []Message) (string, error) {
+			start := time.Now()
+			msgID, err := next(ctx, msgs)
+
+			fields := []zlog.Field{
+				zap.String("msgId", msgID),
+				zap.Int("count", len(msgs)),
+				zap.Float64("cost", float64(time.Since(start).Nanoseconds()/1e4)/100.0),
+			}
+			if len(msgs) > 0 {
+				fields = append(fields, zap.String("topic", msgs[0].GetTopic()))
+			}
+			if err != nil {
+				fields = append(fields, zap.String("error", err.Error()))
+			}
+			wrapLogger(zlog.InfoLogger, nil, "rmq-send", fields...)
+			return msgID, err
+		}
+	}
+}
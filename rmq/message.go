@@ -1,13 +1,20 @@
 package rmq
 
 import (
+	"context"
+	"time"
+
 	"github.com/apache/rocketmq-client-go/v2/primitive"
 	"github.com/derekAHua/goLib/zlog"
+	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 )
 
 // Message 消息提供的接口定义
 type (
+	// SendCallback 异步发送的结果回调
+	SendCallback func(ctx *gin.Context, msgID string, err error)
+
 	Message interface {
 		// WithTag 设置消息的标签Tag
 		WithTag(string) Message
@@ -15,16 +22,46 @@ type (
 		WithShard(string) Message
 		// WithDelay 设置消息的延迟等级
 		WithDelay(DelayLevel) Message
+		// WithDelayUntil 设置消息在时间 t 投递，超过最大延迟等级时由消费者按剩余时间逐级转发直到到期。
+		// 订阅该主题的每个消费者组（广播模式下每个实例）各自转发一份副本，副本会投递给全部订阅方再由非转发方直接确认，
+		// 每次中转的投递次数为订阅方数量的平方，订阅方较多且延迟较长时应改用定时任务
+		WithDelayUntil(t time.Time) Message
+		// WithDelayDuration 设置消息在 d 之后投递，见 WithDelayUntil
+		WithDelayDuration(d time.Duration) Message
+		// WithContext 在消息属性中携带请求的logId/requestId，接收ctx的发送方法会自动携带，未调用时 Send 生成新的logId/requestId
+		WithContext(*gin.Context) Message
+		// WithKeys 设置消息的业务键，可在控制台按键查询消息
+		WithKeys(keys ...string) Message
+		// WithProperty 设置自定义属性
+		WithProperty(key, value string) Message
 		// Send 发送消息
 		Send() (msgID string, err error)
+		// SendContext 发送消息并携带 ctx 的logId/requestId，ctx 结束时放弃等待发送名额及Broker的响应
+		SendContext(ctx *gin.Context) (msgID string, err error)
+		// SendAsync 异步发送消息，发送结果通过 callback 返回；ctx 结束时放弃等待发送名额，已开始的发送不受影响，callback 收到的是 ctx 的副本
+		SendAsync(ctx *gin.Context, callback SendCallback) error
+		// SendOneWay 单向发送消息，不等待Broker确认
+		SendOneWay(ctx *gin.Context) error
+		// SendInTransaction 发送事务消息，半消息发送成功后以 arg 调用本地事务执行器，返回本地事务状态
+		SendInTransaction(ctx *gin.Context, arg interface{}) (msgID string, state TransactionState, err error)
 		// GetContent 获取消息体内容
 		GetContent() []byte
 		// GetTag 获取消息标签
 		GetTag() string
 		// GetShard 获取消息分片键
 		GetShard() string
-		// GetID 获取消息ID
+		// GetID 获取消息ID（客户端生成的唯一ID，重试时不变），发送成功后可用
 		GetID() string
+		// GetProperty 获取自定义属性
+		GetProperty(key string) string
+		// GetTopic 获取消息主题
+		GetTopic() string
+		// GetBornTime 获取消息的发送时间，仅消费到的消息有效
+		GetBornTime() time.Time
+		// GetReconsumeTimes 获取消息的重试次数，仅消费到的消息有效
+		GetReconsumeTimes() int
+		// GetQueueOffset 获取消息在队列中的位点，未消费的消息返回-1
+		GetQueueOffset() int64
 	}
 
 	messageWrapper struct {
@@ -32,9 +69,23 @@ type (
 		client   *client
 		offsetID string
 		msgID    string
+		// ext 消费到的消息，发送的消息为nil
+		ext *primitive.MessageExt
 	}
 )
 
+// wrapMessageExt 包装消费到的消息，压缩的消息体会被解压。
+// 无法解压时仍返回包装后的消息（保留压缩属性）及解压的错误，由调用方决定拒绝消费或交给业务处理
+func wrapMessageExt(m *primitive.MessageExt) (*messageWrapper, error) {
+	err := decompressMessage(m)
+	return &messageWrapper{
+		msg:      &m.Message,
+		offsetID: m.OffsetMsgId,
+		msgID:    m.MsgId,
+		ext:      m,
+	}, err
+}
+
 func (m *messageWrapper) WithTag(tag string) Message {
 	m.msg = m.msg.WithTag(tag)
 	return m
@@ -50,22 +101,70 @@ func (m *messageWrapper) WithDelay(lvl DelayLevel) Message {
 	return m
 }
 
-func (m *messageWrapper) Send() (msgID string, err error) {
+// getProducer 获取消息所属服务已启动的生产者
+func (m *messageWrapper) getProducer(ctx *gin.Context) (*rmqProducer, error) {
 	if m.client == nil {
-		wrapLogger(zlog.ErrorLogger, nil, "client is not specified")
-		return "", ErrRmqSvcInvalidOperation
+		wrapLogger(zlog.ErrorLogger, ctx, "client is not specified")
+		return nil, ErrRmqSvcInvalidOperation
 	}
-	m.client.mu.Lock()
+	m.client.mu.RLock()
 	prod := m.client.producer
-	m.client.mu.Unlock()
+	m.client.mu.RUnlock()
 	if prod == nil {
-		wrapLogger(zlog.ErrorLogger, nil, "producer not started")
-		return "", ErrRmqSvcInvalidOperation
+		wrapLogger(zlog.ErrorLogger, ctx, "producer not started")
+		return nil, ErrRmqSvcInvalidOperation
+	}
+	return prod, nil
+}
+
+func (m *messageWrapper) WithKeys(keys ...string) Message {
+	m.msg = m.msg.WithKeys(keys)
+	return m
+}
+
+func (m *messageWrapper) WithProperty(key, value string) Message {
+	m.msg.WithProperty(key, value)
+	return m
+}
+
+func (m *messageWrapper) WithContent(body []byte) Message {
+	m.msg.Body = body
+	return m
+}
+
+func (m *messageWrapper) WithContext(ctx *gin.Context) Message {
+	injectTrace(ctx, m.msg)
+	return m
+}
+
+func (m *messageWrapper) Send() (msgID string, err error) {
+	injectTrace(nil, m.msg)
+	return m.send(nil, context.Background())
+}
+
+func (m *messageWrapper) SendContext(ctx *gin.Context) (msgID string, err error) {
+	injectTrace(ctx, m.msg)
+	return m.send(ctx, stdContext(ctx))
+}
+
+// send 同步发送，sendCtx 控制发送的等待时间，ctx 用于记录日志
+func (m *messageWrapper) send(ctx *gin.Context, sendCtx context.Context) (msgID string, err error) {
+	prod, err := m.getProducer(ctx)
+	if err != nil {
+		return "", err
 	}
 
-	queue, id, offset, err := m.client.producer.SendMessage(m.msg)
+	var queue, offset string
+	id, err := m.client.sendChain(func(sendCtx context.Context, msgs []Message) (id string, err error) {
+		list, err := rawMessages(msgs)
+		if err != nil {
+			return "", err
+		}
+		queue, id, offset, err = prod.SendMessage(sendCtx, list...)
+		return id, err
+	})(sendCtx, []Message{m})
 	if err != nil {
-		wrapLogger(zlog.ErrorLogger, nil, "failed to send message",
+		wrapLogger(zlog.ErrorLogger, ctx, "failed to send message",
 			zap.String("error", err.Error()),
 			zap.String("message", m.msg.String()),
 		)
@@ -78,9 +177,120 @@ func (m *messageWrapper) Send() (msgID string, err error) {
 		zap.String("msgId", id),
 		zap.String("offsetId", offset),
 	}
-	wrapLogger(zlog.InfoLogger, nil, "rmq sent message", fields...)
+	wrapLogger(zlog.InfoLogger, ctx, "rmq sent message", fields...)
+
+	m.msgID, m.offsetID = id, offset
+	return id, nil
+}
+
+func (m *messageWrapper) SendAsync(ctx *gin.Context, callback SendCallback) error {
+	prod, err := m.getProducer(ctx)
+	if err != nil {
+		return err
+	}
+
+	injectTrace(ctx, m.msg)
+	// ctx 只用于等待发送名额，回调时请求可能已经结束
+	cbCtx := copyContext(ctx)
+	_, err = m.client.sendChain(func(sendCtx context.Context, msgs []Message) (string, error) {
+		list, err := rawMessages(msgs)
+		if err != nil {
+			return "", err
+		}
+		content := m.msg.String()
+		return "", prod.SendMessageAsync(sendCtx, func(res *primitive.SendResult, err error) {
+			ctx := cbCtx
+			if err != nil {
+				wrapLogger(zlog.ErrorLogger, ctx, "failed to send message async",
+					zap.String("error", err.Error()),
+					zap.String("message", content),
+				)
+				if callback != nil {
+					callback(ctx, "", err)
+				}
+				return
+			}
 
-	return offset, nil
+			wrapLogger(zlog.InfoLogger, ctx, "rmq sent message async",
+				zap.String("message", content),
+				zap.String("queue", res.MessageQueue.String()),
+				zap.String("msgId", res.MsgID),
+				zap.String("offsetId", res.OffsetMsgID),
+			)
+			if callback != nil {
+				callback(ctx, res.MsgID, nil)
+			}
+		}, list...)
+	})(stdContext(ctx), []Message{m})
+	return err
+}
+
+func (m *messageWrapper) SendOneWay(ctx *gin.Context) error {
+	prod, err := m.getProducer(ctx)
+	if err != nil {
+		return err
+	}
+
+	injectTrace(ctx, m.msg)
+	_, err = m.client.sendChain(func(sendCtx context.Context, msgs []Message) (string, error) {
+		list, err := rawMessages(msgs)
+		if err != nil {
+			return "", err
+		}
+		return "", prod.SendMessageOneWay(sendCtx, list...)
+	})(stdContext(ctx), []Message{m})
+	if err != nil {
+		wrapLogger(zlog.ErrorLogger, ctx, "failed to send message one way",
+			zap.String("error", err.Error()),
+			zap.String("message", m.msg.String()),
+		)
+		return err
+	}
+	wrapLogger(zlog.InfoLogger, ctx, "rmq sent message one way", zap.String("message", m.msg.String()))
+	return nil
+}
+
+func (m *messageWrapper) SendInTransaction(ctx *gin.Context, arg interface{}) (msgID string, state TransactionState, err error) {
+	if m.client == nil {
+		wrapLogger(zlog.ErrorLogger, ctx, "client is not specified")
+		return "", TransactionUnknown, ErrRmqSvcInvalidOperation
+	}
+	m.client.mu.RLock()
+	prod := m.client.transactionProducer
+	m.client.mu.RUnlock()
+	if prod == nil {
+		wrapLogger(zlog.ErrorLogger, ctx, "transaction producer not started")
+		return "", TransactionUnknown, ErrRmqSvcInvalidOperation
+	}
+
+	injectTrace(ctx, m.msg)
+	var res *primitive.TransactionSendResult
+	_, err = m.client.sendChain(func(sendCtx context.Context, _ []Message) (string, error) {
+		var err error
+		if res, err = prod.SendMessage(sendCtx, &transactionArg{ctx: ctx, msg: m, arg: arg}, m.msg); err != nil {
+			return "", err
+		}
+		return res.MsgID, nil
+	})(stdContext(ctx), []Message{m})
+	if err != nil {
+		wrapLogger(zlog.ErrorLogger, ctx, "failed to send transaction message",
+			zap.String("error", err.Error()),
+			zap.String("message", m.msg.String()),
+		)
+		return "", TransactionUnknown, err
+	}
+
+	m.msgID, m.offsetID = res.MsgID, res.OffsetMsgID
+	fields := []zlog.Field{
+		zap.String("message", m.msg.String()),
+		zap.String("queue", res.MessageQueue.String()),
+		zap.String("msgId", res.MsgID),
+		zap.String("offsetId", res.OffsetMsgID),
+		zap.Int("state", int(res.State)),
+	}
+	wrapLogger(zlog.InfoLogger, ctx, "rmq sent transaction message", fields...)
+
+	return res.MsgID, res.State, nil
 }
 
 func (m *messageWrapper) GetContent() []byte {
@@ -96,24 +306,87 @@ func (m *messageWrapper) GetShard() string {
 }
 
 func (m *messageWrapper) GetID() string {
-	return m.offsetID
+	return m.msgID
+}
+
+func (m *messageWrapper) GetProperty(key string) string {
+	return m.msg.GetProperty(key)
+}
+
+func (m *messageWrapper) GetTopic() string {
+	return m.msg.Topic
+}
+
+func (m *messageWrapper) GetBornTime() time.Time {
+	if m.ext == nil {
+		return time.Time{}
+	}
+	return time.Unix(0, m.ext.BornTimestamp*int64(time.Millisecond))
+}
+
+func (m *messageWrapper) GetReconsumeTimes() int {
+	if m.ext == nil {
+		return 0
+	}
+	return int(m.ext.ReconsumeTimes)
+}
+
+func (m *messageWrapper) GetQueueOffset() int64 {
+	if m.ext == nil {
+		return -1
+	}
+	return m.ext.QueueOffset
 }
 
 type MessageBatch []Message
 
+// messages 转换为SDK消息，批量消息需属于同一服务
+func (batch MessageBatch) messages() (*rmqProducer, []*primitive.Message, error) {
+	if len(batch) < 1 {
+		return nil, nil, ErrRmqSvcInvalidOperation
+	}
+	list, err := rawMessages(batch)
+	if err != nil {
+		return nil, nil, err
+	}
+	prod, err := batch[0].(*messageWrapper).getProducer(nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return prod, list, nil
+}
+
 func (batch MessageBatch) Send() (msgID string, err error) {
-	var msgList = make([]*primitive.Message, 0)
-	for _, m := range batch {
-		msgList = append(msgList, m.(*messageWrapper).msg)
+	return batch.send(nil, context.Background())
+}
+
+// SendContext 批量发送消息并携带 ctx 的logId/requestId，ctx 结束时放弃等待发送名额及Broker的响应
+func (batch MessageBatch) SendContext(ctx *gin.Context) (msgID string, err error) {
+	return batch.send(ctx, stdContext(ctx))
+}
+
+// send 同步批量发送，ctx 为nil时保留 WithContext 已写入的logId/requestId
+func (batch MessageBatch) send(ctx *gin.Context, sendCtx context.Context) (msgID string, err error) {
+	prod, msgList, err := batch.messages()
+	if err != nil {
+		return "", err
 	}
-	if len(msgList) < 1 {
-		return "", ErrRmqSvcInvalidOperation
+	for _, msg := range msgList {
+		injectTrace(ctx, msg)
 	}
 
-	queue, id, offset, err := batch[0].(*messageWrapper).client.producer.SendMessage(msgList...)
+	var queue, offset string
+	id, err := batch[0].(*messageWrapper).client.sendChain(func(sendCtx context.Context, msgs []Message) (id string, err error) {
+		list, err := rawMessages(msgs)
+		if err != nil {
+			return "", err
+		}
+		queue, id, offset, err = prod.SendMessage(sendCtx, list...)
+		return id, err
+	})(sendCtx, batch)
 
 	if err != nil {
-		wrapLogger(zlog.ErrorLogger, nil, "failed to send message batch",
+		wrapLogger(zlog.ErrorLogger, ctx, "failed to send message batch",
 			zap.String("error", err.Error()),
 		)
 		return "", err
@@ -124,7 +397,74 @@ func (batch MessageBatch) Send() (msgID string, err error) {
 		zap.String("msgId", id),
 		zap.String("offsetId", offset),
 	}
-	wrapLogger(zlog.InfoLogger, nil, "sent message batch", fields...)
+	wrapLogger(zlog.InfoLogger, ctx, "sent message batch", fields...)
+
+	return id, nil
+}
 
-	return offset, nil
+// SendAsync 异步批量发送消息
+func (batch MessageBatch) SendAsync(ctx *gin.Context, callback SendCallback) error {
+	prod, msgList, err := batch.messages()
+	if err != nil {
+		return err
+	}
+	for _, msg := range msgList {
+		injectTrace(ctx, msg)
+	}
+
+	cbCtx := copyContext(ctx)
+	_, err = batch[0].(*messageWrapper).client.sendChain(func(sendCtx context.Context, msgs []Message) (string, error) {
+		list, err := rawMessages(msgs)
+		if err != nil {
+			return "", err
+		}
+		return "", prod.SendMessageAsync(sendCtx, func(res *primitive.SendResult, err error) {
+			ctx := cbCtx
+			if err != nil {
+				wrapLogger(zlog.ErrorLogger, ctx, "failed to send message batch async",
+					zap.String("error", err.Error()),
+				)
+				if callback != nil {
+					callback(ctx, "", err)
+				}
+				return
+			}
+
+			wrapLogger(zlog.InfoLogger, ctx, "sent message batch async",
+				zap.String("queue", res.MessageQueue.String()),
+				zap.String("msgId", res.MsgID),
+				zap.String("offsetId", res.OffsetMsgID),
+			)
+			if callback != nil {
+				callback(ctx, res.MsgID, nil)
+			}
+		}, list...)
+	})(stdContext(ctx), batch)
+	return err
+}
+
+// SendOneWay 单向批量发送消息
+func (batch MessageBatch) SendOneWay(ctx *gin.Context) error {
+	prod, msgList, err := batch.messages()
+	if err != nil {
+		return err
+	}
+	for _, msg := range msgList {
+		injectTrace(ctx, msg)
+	}
+
+	_, err = batch[0].(*messageWrapper).client.sendChain(func(sendCtx context.Context, msgs []Message) (string, error) {
+		list, err := rawMessages(msgs)
+		if err != nil {
+			return "", err
+		}
+		return "", prod.SendMessageOneWay(sendCtx, list...)
+	})(stdContext(ctx), batch)
+	if err != nil {
+		wrapLogger(zlog.ErrorLogger, ctx, "failed to send message batch one way",
+			zap.String("error", err.Error()),
+		)
+		return err
+	}
+	return nil
 }
@@ -0,0 +1,105 @@
+package rmq
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/derekAHua/goLib/zlog"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// MessageMiddleware 消费中间件，包装 MessageCallback 以组合通用的消费逻辑
+type MessageMiddleware func(next MessageCallback) MessageCallback
+
+// Chain 按顺序组合中间件，第一个中间件位于最外层
+func Chain(callback MessageCallback, middlewares ...MessageMiddleware) MessageCallback {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		callback = middlewares[i](callback)
+	}
+	return callback
+}
+
+// UseMiddleware 为指定服务注册消费中间件，对之后启动的消费者生效
+func UseMiddleware(service string, middlewares ...MessageMiddleware) error {
+	if client, ok := lookupClient(service); ok {
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		client.middlewares = append(client.middlewares, middlewares...)
+		return nil
+	}
+	return ErrRmqSvcNotRegistered
+}
+
+// Recovery 捕获消费回调中的panic，记录消息内容及堆栈，并返回错误使消息稍后重试
+func Recovery() MessageMiddleware {
+	return func(next MessageCallback) MessageCallback {
+		return func(ctx *gin.Context, msg Message) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					wrapLogger(zlog.ErrorLogger, ctx, fmt.Sprintf("rmq consume panic(%v)", r),
+						zap.String("msgId", msg.GetID()),
+						zap.String("tag", msg.GetTag()),
+						zap.ByteString("body", msg.GetContent()),
+						zap.Stack("stack"),
+					)
+					err = fmt.Errorf("rmq consume panic: %v", r)
+				}
+			}()
+			return next(ctx, msg)
+		}
+	}
+}
+
+// Timing 记录每条消息的消费耗时
+func Timing() MessageMiddleware {
+	return func(next MessageCallback) MessageCallback {
+		return func(ctx *gin.Context, msg Message) error {
+			start := time.Now()
+			err := next(ctx, msg)
+
+			fields := []zlog.Field{
+				zap.String("msgId", msg.GetID()),
+				zap.String("tag", msg.GetTag()),
+				zap.Float64("cost", float64(time.Since(start).Nanoseconds()/1e4)/100.0),
+			}
+			if err != nil {
+				fields = append(fields, zap.String("error", err.Error()))
+			}
+			wrapLogger(zlog.InfoLogger, ctx, "rmq-consume", fields...)
+			return err
+		}
+	}
+}
+
+// MetricsObserver 上报消费指标，tag 为消息标签，err 为消费结果
+type MetricsObserver func(tag string, cost time.Duration, err error)
+
+// Metrics 将每条消息的消费结果及耗时交给 observer 上报
+func Metrics(observer MetricsObserver) MessageMiddleware {
+	return func(next MessageCallback) MessageCallback {
+		return func(ctx *gin.Context, msg Message) error {
+			start := time.Now()
+			err := next(ctx, msg)
+			observer(msg.GetTag(), time.Since(start), err)
+			return err
+		}
+	}
+}
+
+// RouteByTag 按消息标签分发到不同的回调，没有匹配的回调时交给 fallback，fallback 为nil则忽略该消息
+func RouteByTag(routes map[string]MessageCallback, fallback MessageCallback) MessageCallback {
+	return func(ctx *gin.Context, msg Message) error {
+		if cb, ok := routes[msg.GetTag()]; ok {
+			return cb(ctx, msg)
+		}
+		if fallback != nil {
+			return fallback(ctx, msg)
+		}
+		wrapLogger(zlog.WarnLogger, ctx, "no route for message tag",
+			zap.String("msgId", msg.GetID()),
+			zap.String("tag", msg.GetTag()),
+		)
+		return nil
+	}
+}
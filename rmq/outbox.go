@@ -0,0 +1,373 @@
+package rmq
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/derekAHua/goLib/redis"
+	"github.com/derekAHua/goLib/zlog"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// 发件箱消息状态
+const (
+	OutboxPending = iota
+	OutboxSent
+	OutboxFailed
+)
+
+// 仅当锁仍由自己持有时续期/释放
+const (
+	outboxRenewScript  = "if redis.call('GET', KEYS[1]) == ARGV[1] then return redis.call('PEXPIRE', KEYS[1], ARGV[2]) else return 0 end"
+	outboxUnlockScript = "if redis.call('GET', KEYS[1]) == ARGV[1] then return redis.call('DEL', KEYS[1]) else return 0 end"
+)
+
+// OutboxMessage 发件箱表记录，与业务数据在同一事务中写入，由 Outbox 的转发任务投递到RocketMQ
+type OutboxMessage struct {
+	ID         uint64    `gorm:"column:id;primaryKey;autoIncrement"`
+	Service    string    `gorm:"column:service;type:varchar(64);not null"`
+	Topic      string    `gorm:"column:topic;type:varchar(255);not null"`
+	Body       []byte    `gorm:"column:body;type:mediumblob"`
+	Properties string    `gorm:"column:properties;type:text"`
+	Status     int       `gorm:"column:status;not null;default:0;index:idx_status_next_at,priority:1"`
+	Retries    int       `gorm:"column:retries;not null;default:0"`
+	NextAt     time.Time `gorm:"column:next_at;not null;index:idx_status_next_at,priority:2"`
+	MsgID      string    `gorm:"column:msg_id;type:varchar(64)"`
+	LastError  string    `gorm:"column:last_error;type:varchar(1024)"`
+	CreatedAt  time.Time `gorm:"column:created_at"`
+	UpdatedAt  time.Time `gorm:"column:updated_at"`
+}
+
+type outboxOptions struct {
+	batchSize   int
+	interval    time.Duration
+	maxRetries  int
+	backoffBase time.Duration
+	backoffMax  time.Duration
+	lockTTL     time.Duration
+}
+
+// OutboxOption 发件箱配置项
+type OutboxOption func(*outboxOptions)
+
+// WithOutboxBatchSize 每次轮询最多转发的消息数，默认100
+func WithOutboxBatchSize(n int) OutboxOption {
+	return func(o *outboxOptions) {
+		o.batchSize = n
+	}
+}
+
+// WithOutboxInterval 轮询间隔，默认1秒
+func WithOutboxInterval(d time.Duration) OutboxOption {
+	return func(o *outboxOptions) {
+		o.interval = d
+	}
+}
+
+// WithOutboxMaxRetries 最大重试次数，超过后消息标记为 OutboxFailed，默认16
+func WithOutboxMaxRetries(n int) OutboxOption {
+	return func(o *outboxOptions) {
+		o.maxRetries = n
+	}
+}
+
+// WithOutboxBackoff 发送失败后按 base*2^(retries-1) 退避，最长 max，默认1秒~10分钟
+func WithOutboxBackoff(base, max time.Duration) OutboxOption {
+	return func(o *outboxOptions) {
+		o.backoffBase = base
+		o.backoffMax = max
+	}
+}
+
+// WithOutboxLockTTL 转发锁的过期时间，默认30秒，转发过程中每隔 ttl/3 续期。
+// ttl/3 需大于单条消息的发送超时，否则发送期间锁可能过期
+func WithOutboxLockTTL(d time.Duration) OutboxOption {
+	return func(o *outboxOptions) {
+		o.lockTTL = d
+	}
+}
+
+// Outbox 事务发件箱：消息随业务数据写入同一个mysql事务，再由转发任务投递，保证两者的原子性。
+// 同一张表的转发任务通过redis锁保证只有一个实例在运行
+type Outbox struct {
+	db    *gorm.DB
+	redis *redis.Redis
+	table string
+	opts  outboxOptions
+	token string
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewOutbox 创建使用 table 表的发件箱
+func NewOutbox(db *gorm.DB, rds *redis.Redis, table string, opts ...OutboxOption) *Outbox {
+	o := outboxOptions{
+		batchSize:   100,
+		interval:    time.Second,
+		maxRetries:  16,
+		backoffBase: time.Second,
+		backoffMax:  10 * time.Minute,
+		lockTTL:     30 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &Outbox{
+		db:    db,
+		redis: rds,
+		table: table,
+		opts:  o,
+		token: strconv.FormatInt(generateSnowflake(), 10),
+	}
+}
+
+// AutoMigrate 创建或更新发件箱表结构
+func (o *Outbox) AutoMigrate() error {
+	return o.db.Table(o.table).AutoMigrate(&OutboxMessage{})
+}
+
+// Save 在调用方的事务 tx 中写入待发送消息，msg 需由 NewMessage 创建
+func (o *Outbox) Save(ctx *gin.Context, tx *gorm.DB, msg Message) error {
+	m, ok := msg.(*messageWrapper)
+	if !ok || m.client == nil {
+		return ErrRmqSvcInvalidOperation
+	}
+	injectTrace(ctx, m.msg)
+	props, err := json.Marshal(m.msg.GetProperties())
+	if err != nil {
+		return err
+	}
+	row := &OutboxMessage{
+		Service:    m.client.service,
+		Topic:      m.msg.Topic,
+		Body:       m.msg.Body,
+		Properties: string(props),
+		Status:     OutboxPending,
+		NextAt:     time.Now(),
+	}
+	if err = tx.WithContext(stdContext(ctx)).Table(o.table).Create(row).Error; err != nil {
+		wrapLogger(zlog.ErrorLogger, ctx, "failed to save outbox message",
+			zap.String("table", o.table),
+			zap.String("error", err.Error()))
+		return err
+	}
+	return nil
+}
+
+// Start 启动后台转发任务
+func (o *Outbox) Start() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.cancel != nil {
+		return
+	}
+	var c context.Context
+	c, o.cancel = context.WithCancel(context.Background())
+	o.done = make(chan struct{})
+	go o.loop(c, o.done)
+}
+
+// Stop 停止后台转发任务并释放锁
+func (o *Outbox) Stop() {
+	o.mu.Lock()
+	cancel, done := o.cancel, o.done
+	o.cancel, o.done = nil, nil
+	o.mu.Unlock()
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-done
+	_, _ = o.redis.Lua(&gin.Context{}, outboxUnlockScript, 1, o.lockKey(), o.token)
+}
+
+func (o *Outbox) loop(c context.Context, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(o.opts.interval)
+	defer ticker.Stop()
+	for {
+		o.relayLocked(c)
+
+		select {
+		case <-c.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// relayLocked 持有锁时持续转发，一次取满说明可能还有积压；
+// 转发过程中逐条检查并按需续期锁，失去锁后立即停止，避免与新的持有者重复投递
+func (o *Outbox) relayLocked(c context.Context) {
+	lease := &outboxLease{outbox: o, ctx: &gin.Context{}}
+	for c.Err() == nil {
+		n, err := o.relay(c, lease.hold)
+		if err != nil || n < o.opts.batchSize {
+			return
+		}
+	}
+}
+
+// outboxLease 转发锁的租约，距上次续期超过 lockTTL/3 时再次续期
+type outboxLease struct {
+	outbox    *Outbox
+	ctx       *gin.Context
+	renewedAt time.Time
+}
+
+// hold 确认仍持有锁，获取或续期失败时返回false
+func (l *outboxLease) hold() bool {
+	if !l.renewedAt.IsZero() && time.Since(l.renewedAt) < l.outbox.opts.lockTTL/3 {
+		return true
+	}
+	locked, err := l.outbox.lock(l.ctx)
+	if err != nil {
+		wrapLogger(zlog.ErrorLogger, nil, "failed to acquire outbox lock",
+			zap.String("table", l.outbox.table),
+			zap.String("error", err.Error()))
+		return false
+	}
+	if !locked {
+		l.renewedAt = time.Time{}
+		return false
+	}
+	l.renewedAt = time.Now()
+	return true
+}
+
+func (o *Outbox) lockKey() string {
+	return "rmq:outbox:" + o.table
+}
+
+// lock 获取或续期转发锁
+func (o *Outbox) lock(ctx *gin.Context) (bool, error) {
+	ttl := uint64(o.opts.lockTTL / time.Millisecond)
+	ok, err := o.redis.SetNxByPX(ctx, o.lockKey(), o.token, ttl)
+	if err != nil || ok {
+		return ok, err
+	}
+	reply, err := o.redis.Lua(ctx, outboxRenewScript, 1, o.lockKey(), o.token, ttl)
+	if err != nil {
+		return false, err
+	}
+	renewed, _ := reply.(int64)
+	return renewed == 1, nil
+}
+
+// RelayOnce 转发一批到期的待发送消息，返回本次处理的消息数。
+// 未通过 Start 启动时可由外部调度调用，此时调用方需自行保证单实例运行
+func (o *Outbox) RelayOnce(ctx *gin.Context) (int, error) {
+	return o.relay(stdContext(ctx), nil)
+}
+
+// relay 转发一批消息，hold 不为nil时在查询及每条消息发送前调用，返回false则停止转发
+func (o *Outbox) relay(c context.Context, hold func() bool) (int, error) {
+	if hold != nil && !hold() {
+		return 0, nil
+	}
+	var rows []OutboxMessage
+	err := o.db.WithContext(c).Table(o.table).
+		Where("status = ? AND next_at <= ?", OutboxPending, time.Now()).
+		Order("id").Limit(o.opts.batchSize).
+		Find(&rows).Error
+	if err != nil {
+		wrapLogger(zlog.ErrorLogger, nil, "failed to load outbox messages",
+			zap.String("table", o.table),
+			zap.String("error", err.Error()))
+		return 0, err
+	}
+
+	for i := range rows {
+		if c.Err() != nil {
+			return i, c.Err()
+		}
+		if hold != nil && !hold() {
+			return i, nil
+		}
+		o.deliver(c, &rows[i])
+	}
+	return len(rows), nil
+}
+
+// deliver 发送单条消息并更新状态
+func (o *Outbox) deliver(c context.Context, row *OutboxMessage) {
+	updates := map[string]interface{}{"updated_at": time.Now()}
+	msgID, err := o.send(c, row)
+	if err == nil {
+		updates["status"] = OutboxSent
+		updates["msg_id"] = msgID
+	} else {
+		retries := row.Retries + 1
+		updates["retries"] = retries
+		updates["last_error"] = truncate(err.Error(), 1024)
+		if retries >= o.opts.maxRetries {
+			updates["status"] = OutboxFailed
+		} else {
+			updates["next_at"] = time.Now().Add(o.backoff(retries))
+		}
+		wrapLogger(zlog.WarnLogger, nil, "failed to relay outbox message",
+			zap.String("table", o.table),
+			zap.Uint64("id", row.ID),
+			zap.Int("retries", retries),
+			zap.String("error", err.Error()))
+	}
+
+	err = o.db.WithContext(c).Table(o.table).
+		Where("id = ? AND status = ?", row.ID, OutboxPending).
+		Updates(updates).Error
+	if err != nil {
+		wrapLogger(zlog.ErrorLogger, nil, "failed to update outbox message",
+			zap.String("table", o.table),
+			zap.Uint64("id", row.ID),
+			zap.String("error", err.Error()))
+	}
+}
+
+// send 发送一条记录，保留写入时携带的logId/requestId，c 结束时放弃发送
+func (o *Outbox) send(c context.Context, row *OutboxMessage) (string, error) {
+	msg, err := NewMessageTo(row.Service, row.Topic, row.Body)
+	if err != nil {
+		return "", err
+	}
+	m := msg.(*messageWrapper)
+	if row.Properties != "" {
+		props := make(map[string]string)
+		if err = json.Unmarshal([]byte(row.Properties), &props); err != nil {
+			return "", err
+		}
+		m.msg.WithProperties(props)
+	}
+	injectTrace(nil, m.msg)
+	return m.send(nil, c)
+}
+
+// backoff 第 retries 次失败后的等待时间
+func (o *Outbox) backoff(retries int) time.Duration {
+	d := o.opts.backoffBase
+	for i := 1; i < retries && d < o.opts.backoffMax; i++ {
+		d *= 2
+	}
+	if d > o.opts.backoffMax {
+		d = o.opts.backoffMax
+	}
+	return d
+}
+
+// truncate 截断为最多 n 个字节，不会截断多字节字符
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,202 @@
+package rmq
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/apache/rocketmq-client-go/v2/consumer"
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/derekAHua/goLib/zlog"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	// PropertyCorrelationID 关联请求与响应的ID
+	PropertyCorrelationID = "RMQ_CORRELATION_ID"
+	// PropertyReplyTo 请求方接收响应的主题
+	PropertyReplyTo = "RMQ_REPLY_TO"
+	// PropertyRequestDeadline 请求的截止时间（毫秒时间戳），响应方忽略已超时的请求
+	PropertyRequestDeadline = "RMQ_REQUEST_DEADLINE"
+	// PropertyReplyError 响应方处理请求失败的原因
+	PropertyReplyError = "RMQ_REPLY_ERROR"
+
+	// defaultRequestTimeout 未配置 RequestTimeout 且 ctx 没有截止时间时等待响应的时间
+	defaultRequestTimeout = 3 * time.Second
+)
+
+// ErrRmqRequestTimeout 等待响应超时
+var ErrRmqRequestTimeout = errors.New("rmq request timed out waiting for reply")
+
+// ReplyError 响应方处理请求失败时，请求方收到的错误
+type ReplyError struct {
+	Message string
+}
+
+func (e *ReplyError) Error() string {
+	return "rmq reply error: " + e.Message
+}
+
+// ReplyHandler 处理请求消息，返回的内容作为响应的消息体
+type ReplyHandler func(ctx *gin.Context, msg Message) (reply []byte, err error)
+
+// Request 发送请求消息并等待响应，用于耗时较长的流程以消息方式调用。
+// 响应发送到 service 配置的 ReplyTopic，由 StartProducer 启动的广播模式响应消费者接收，各实例只处理自己发出的请求，
+// service 的生产者未启动时返回 ErrRmqSvcInvalidOperation。发送的是 msg 的副本，不修改 msg。
+// ctx 没有截止时间时按 RequestTimeout 等待，超时返回 ErrRmqRequestTimeout，响应方处理失败时返回 *ReplyError
+func Request(ctx context.Context, service string, msg Message) (Message, error) {
+	w, ok := msg.(*messageWrapper)
+	if !ok {
+		return nil, ErrRmqSvcInvalidOperation
+	}
+	client, ok := lookupClient(service)
+	if !ok {
+		return nil, ErrRmqSvcNotRegistered
+	}
+	if client.ClientConfig.ReplyTopic == "" {
+		return nil, ErrRmqSvcConfigInvalid
+	}
+	client.mu.RLock()
+	started := client.replyConsumer != nil
+	client.mu.RUnlock()
+	if !started {
+		return nil, ErrRmqSvcInvalidOperation
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		timeout := defaultRequestTimeout
+		if client.ClientConfig.RequestTimeout > 0 {
+			timeout = time.Duration(client.ClientConfig.RequestTimeout) * time.Millisecond
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	deadline, _ := ctx.Deadline()
+
+	id := strconv.FormatInt(generateSnowflake(), 10)
+	ch := make(chan *messageWrapper, 1)
+	client.replies.Store(id, ch)
+	defer client.replies.Delete(id)
+
+	req := primitive.NewMessage(w.msg.Topic, w.msg.Body)
+	req.WithProperties(w.msg.GetProperties())
+	req.Flag, req.Queue = w.msg.Flag, w.msg.Queue
+	req.WithProperty(PropertyCorrelationID, id)
+	req.WithProperty(PropertyReplyTo, client.ClientConfig.ReplyTopic)
+	req.WithProperty(PropertyRequestDeadline, strconv.FormatInt(deadline.UnixNano()/int64(time.Millisecond), 10))
+	injectTrace(nil, req)
+	if _, err := (&messageWrapper{client: w.client, msg: req}).send(nil, ctx); err != nil {
+		return nil, err
+	}
+
+	select {
+	case reply := <-ch:
+		if cause := reply.GetProperty(PropertyReplyError); cause != "" {
+			return nil, &ReplyError{Message: cause}
+		}
+		return reply, nil
+	case <-ctx.Done():
+		wrapLogger(zlog.WarnLogger, nil, "rmq request finished without reply",
+			zap.String("service", service),
+			zap.String("correlationId", id),
+			zap.String("error", ctx.Err().Error()))
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, ErrRmqRequestTimeout
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// Responder 将 handler 包装为消费回调，handler 的返回内容由 service 的转发生产者发送到请求方的 ReplyTo 主题。
+// handler 返回错误时请求方收到 *ReplyError，已超时的请求及非请求消息被忽略；响应发送失败时返回错误，消息稍后重试
+func Responder(service string, handler ReplyHandler) MessageCallback {
+	return func(ctx *gin.Context, msg Message) error {
+		id, replyTo := msg.GetProperty(PropertyCorrelationID), msg.GetProperty(PropertyReplyTo)
+		if id == "" || replyTo == "" {
+			wrapLogger(zlog.WarnLogger, ctx, "ignore message without reply address", zap.String("msgId", msg.GetID()))
+			return nil
+		}
+		if ms, err := strconv.ParseInt(msg.GetProperty(PropertyRequestDeadline), 10, 64); err == nil &&
+			time.Now().After(time.Unix(0, ms*int64(time.Millisecond))) {
+			wrapLogger(zlog.WarnLogger, ctx, "ignore expired request",
+				zap.String("msgId", msg.GetID()),
+				zap.String("correlationId", id))
+			return nil
+		}
+		client, ok := lookupClient(service)
+		if !ok {
+			return ErrRmqSvcNotRegistered
+		}
+
+		body, err := handler(ctx, msg)
+		reply := primitive.NewMessage(replyTo, body)
+		reply.WithProperty(PropertyCorrelationID, id)
+		if err != nil {
+			reply.WithProperty(PropertyReplyError, err.Error())
+		}
+		injectTrace(ctx, reply)
+
+		prod, err := client.getForwardProducer()
+		if err != nil {
+			return err
+		}
+		if _, _, _, err = prod.SendMessage(stdContext(ctx), reply); err != nil {
+			return err
+		}
+		return nil
+	}
+}
+
+// startReplyConsumer 启动接收响应的消费者，由 StartProducer 在配置了 ReplyTopic 时调用，调用方需持有锁
+func (c *client) startReplyConsumer() error {
+	resolver, err := c.nsResolver()
+	if err != nil {
+		return err
+	}
+	// 各实例都需要收到响应，使用广播模式
+	con, err := newPushConsumer(
+		c.ClientConfig.Auth.AccessKey,
+		c.ClientConfig.Auth.SecretKey,
+		c.service+"-reply",
+		c.ClientConfig.Group+"-reply",
+		true,
+		false,
+		0,
+		1,
+		[]subscription{{topic: c.ClientConfig.ReplyTopic, cb: c.dispatchReply}},
+		resolver)
+	if err != nil {
+		return err
+	}
+	if err = con.start(); err != nil {
+		return err
+	}
+	c.replyConsumer = con
+	return nil
+}
+
+// dispatchReply 将响应交给等待中的请求，其他实例的请求或已超时请求的响应被忽略
+func (c *client) dispatchReply(_ context.Context, msgs ...*primitive.MessageExt) (consumer.ConsumeResult, error) {
+	for _, m := range msgs {
+		reply, err := wrapMessageExt(m)
+		if err != nil {
+			// 请求方收到 *ReplyError，不等到超时
+			reply.WithProperty(PropertyReplyError, err.Error())
+		}
+		id := reply.GetProperty(PropertyCorrelationID)
+		if v, ok := c.replies.Load(id); ok {
+			select {
+			case v.(chan *messageWrapper) <- reply:
+			default:
+			}
+			continue
+		}
+		wrapLogger(zlog.DebugLogger, nil, "ignore reply without waiting request",
+			zap.String("msgId", m.MsgId),
+			zap.String("correlationId", id))
+	}
+	return consumer.ConsumeSuccess, nil
+}
@@ -0,0 +1,113 @@
+package rmq
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/derekAHua/goLib/zlog"
+	"go.uber.org/zap"
+)
+
+const (
+	// NamingDirect 将解析后的名字服务器地址直接交给SDK，并定期重新解析域名
+	NamingDirect = "direct"
+	// NamingHTTP 在本地启动HTTP服务，SDK每次更新地址时实时解析域名
+	NamingHTTP = "http"
+
+	// defaultDnsRefreshInterval 未配置时重新解析名字服务器域名的间隔
+	defaultDnsRefreshInterval = 30 * time.Second
+)
+
+// dnsResolver 实现 primitive.NsResolver，缓存解析后的名字服务器地址并定期刷新。
+// SDK每2分钟调用一次 Resolve 更新地址
+type dnsResolver struct {
+	service string
+	lookup  func() []string
+
+	mu    sync.RWMutex
+	addrs []string
+
+	stopOnce sync.Once
+	stopCh   chan struct{}
+	done     chan struct{}
+}
+
+var _ primitive.NsResolver = (*dnsResolver)(nil)
+
+func newDnsResolver(service string, lookup func() []string) *dnsResolver {
+	return &dnsResolver{
+		service: service,
+		lookup:  lookup,
+		stopCh:  make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// Resolve 返回最近一次解析的地址，尚未解析成功时（例如启动时DNS不可用）同步解析
+func (r *dnsResolver) Resolve() []string {
+	r.mu.RLock()
+	addrs := r.addrs
+	r.mu.RUnlock()
+	if len(addrs) == 0 {
+		addrs = r.refresh()
+	}
+	return append([]string(nil), addrs...)
+}
+
+func (r *dnsResolver) Description() string {
+	return "rmq dns resolver of " + r.service
+}
+
+// refresh 重新解析名字服务器，地址变化时更新，解析结果为空时保留原有地址。返回最新的地址
+func (r *dnsResolver) refresh() []string {
+	latest := r.lookup()
+	sort.Strings(latest)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(latest) == 0 {
+		wrapLogger(zlog.WarnLogger, nil, "no nameserver resolved, keep previous addresses",
+			zap.String("service", r.service),
+			zap.Strings("ns", r.addrs))
+		return r.addrs
+	}
+	if !primitive.Diff(r.addrs, latest) {
+		return r.addrs
+	}
+	wrapLogger(zlog.InfoLogger, nil, "nameserver addresses changed",
+		zap.String("service", r.service),
+		zap.Strings("old", r.addrs),
+		zap.Strings("new", latest))
+	r.addrs = latest
+	return latest
+}
+
+// start 启动定期刷新，interval 不大于0时使用默认间隔
+func (r *dnsResolver) start(interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultDnsRefreshInterval
+	}
+	go func() {
+		defer close(r.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				r.refresh()
+			case <-r.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// stop 停止定期刷新，之后 Resolve 返回最后一次解析的地址
+func (r *dnsResolver) stop() {
+	r.stopOnce.Do(func() {
+		close(r.stopCh)
+	})
+	<-r.done
+}
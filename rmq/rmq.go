@@ -25,22 +25,41 @@ var (
 
 var (
 	rmqServices   = make(map[string]*client)
-	rmqServicesMu sync.Mutex
+	rmqServicesMu sync.RWMutex
 )
 
+// lookupClient 查找已注册的服务
+func lookupClient(service string) (*client, bool) {
+	rmqServicesMu.RLock()
+	defer rmqServicesMu.RUnlock()
+	client, ok := rmqServices[service]
+	return client, ok
+}
+
 // MessageCallback 定义业务方接收消息的回调接口
 type MessageCallback func(ctx *gin.Context, msg Message) error
 
+// BatchMessageCallback 定义业务方批量接收消息的回调接口
+type BatchMessageCallback func(ctx *gin.Context, msgs []Message) error
+
 func (conf *ClientConfig) checkConfig() error {
 	if conf.Group == "" {
 		return ErrRmqSvcConfigInvalid
 	}
-	if conf.Topic == "" {
+	if conf.Topic == "" && len(conf.Subscriptions) == 0 {
 		return ErrRmqSvcConfigInvalid
 	}
+	for _, sub := range conf.Subscriptions {
+		if sub.Topic == "" {
+			return ErrRmqSvcConfigInvalid
+		}
+	}
 	if len(conf.NameServers) == 0 {
 		return ErrRmqSvcConfigInvalid
 	}
+	if conf.NamingMode != "" && conf.NamingMode != NamingDirect && conf.NamingMode != NamingHTTP {
+		return ErrRmqSvcConfigInvalid
+	}
 	return nil
 }
 
@@ -51,30 +70,31 @@ func InitRmq(service string, config ClientConfig) (err error) {
 
 	client := &client{
 		ClientConfig: &config,
+		service:      service,
 	}
-	rmqServicesMu.Lock()
-	defer rmqServicesMu.Unlock()
-
-	err = client.startNamingHandler()
+	// direct 模式下首次解析域名，不持有全局锁
+	err = client.startNaming()
 	if err != nil {
 		return err
 	}
 
+	rmqServicesMu.Lock()
+	defer rmqServicesMu.Unlock()
 	rmqServices[service] = client
 	return nil
 }
 
-// StartProducer 启动指定已注册的RocketMQ生产服务
+// StartProducer 启动指定已注册的RocketMQ生产服务，配置了 ReplyTopic 时同时启动接收 Request 响应的消费者
 func StartProducer(service string) error {
-	if client, ok := rmqServices[service]; ok {
+	if client, ok := lookupClient(service); ok {
 		client.mu.Lock()
 		defer client.mu.Unlock()
 		if client.producer != nil {
 			return ErrRmqSvcInvalidOperation
 		}
 		var err error
-		var nsDomain string
-		nsDomain, err = client.getNameserverDomain()
+		var resolver primitive.NsResolver
+		resolver, err = client.nsResolver()
 		if err != nil {
 			return err
 		}
@@ -83,102 +103,452 @@ func StartProducer(service string) error {
 			client.ClientConfig.Auth.SecretKey,
 			service,
 			client.ClientConfig.Group,
-			nsDomain,
+			resolver,
 			client.ClientConfig.Retry,
-			time.Duration(client.ClientConfig.Timeout)*time.Millisecond)
+			time.Duration(client.ClientConfig.Timeout)*time.Millisecond,
+			client.ClientConfig.MaxInflight)
 		if err != nil {
 			return err
 		}
-		return client.producer.start()
+		client.producer.compressThreshold = client.ClientConfig.CompressThreshold
+		if err = client.producer.start(); err != nil {
+			client.producer = nil
+			return err
+		}
+		if client.ClientConfig.ReplyTopic != "" {
+			if err = client.startReplyConsumer(); err != nil {
+				_ = client.producer.stop()
+				client.producer = nil
+				return err
+			}
+		}
+		return nil
 	}
 
 	return ErrRmqSvcNotRegistered
 }
 
-// StopProducer 停止指定已注册的RocketMQ生产服务
+// StopProducer 停止指定已注册的RocketMQ生产服务及 Request 的响应消费者，会等待未完成的异步发送结束
 func StopProducer(service string) error {
-	if client, ok := rmqServices[service]; ok {
+	if client, ok := lookupClient(service); ok {
+		// 等待异步发送时不持有锁，回调中可能再次发送消息
+		client.mu.Lock()
+		prod, reply := client.producer, client.replyConsumer
+		client.producer, client.replyConsumer = nil, nil
+		client.mu.Unlock()
+		if prod == nil {
+			return ErrRmqSvcInvalidOperation
+		}
+		if reply != nil {
+			if err := reply.stop(); err != nil {
+				_ = prod.stop()
+				return err
+			}
+		}
+		return prod.stop()
+	}
+	return ErrRmqSvcNotRegistered
+}
+
+// StartTransactionProducer 启动指定已注册的RocketMQ事务生产服务
+// executor 在半消息发送成功后执行本地事务，checker 处理Broker对未决事务的回查。
+// Broker按生产者组回查，事务消息建议使用独立的服务（生产者组）
+func StartTransactionProducer(service string, executor TransactionExecutor, checker TransactionChecker) error {
+	if client, ok := lookupClient(service); ok {
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		if client.transactionProducer != nil || executor == nil || checker == nil {
+			return ErrRmqSvcInvalidOperation
+		}
+		var err error
+		var resolver primitive.NsResolver
+		resolver, err = client.nsResolver()
+		if err != nil {
+			wrapLogger(zlog.ErrorLogger, nil, "invalid transaction producer nameServer", zap.Any("error", err))
+			return err
+		}
+		client.transactionProducer, err = newTransactionProducer(
+			client.ClientConfig.Auth.AccessKey,
+			client.ClientConfig.Auth.SecretKey,
+			service,
+			client.ClientConfig.Group,
+			resolver,
+			client.ClientConfig.Retry,
+			time.Duration(client.ClientConfig.Timeout)*time.Millisecond,
+			executor,
+			checker)
+		if err != nil {
+			return err
+		}
+		client.transactionProducer.compressThreshold = client.ClientConfig.CompressThreshold
+		if err = client.transactionProducer.start(); err != nil {
+			client.transactionProducer = nil
+			return err
+		}
+		return nil
+	}
+
+	return ErrRmqSvcNotRegistered
+}
+
+// StopTransactionProducer 停止指定已注册的RocketMQ事务生产服务
+func StopTransactionProducer(service string) error {
+	if client, ok := lookupClient(service); ok {
 		client.mu.Lock()
 		defer client.mu.Unlock()
-		if client.producer == nil {
+		if client.transactionProducer == nil {
 			return ErrRmqSvcInvalidOperation
 		}
-		err := client.producer.stop()
-		client.producer = nil
+		err := client.transactionProducer.stop()
+		client.transactionProducer = nil
 		return err
 	}
 	return ErrRmqSvcNotRegistered
 }
 
+// startForwardProducer 启动消费者转发消息（投递死信主题、延迟消息中转）使用的生产者，调用方需持有锁
+func (c *client) startForwardProducer(resolver primitive.NsResolver) error {
+	prod, err := newProducer(
+		c.ClientConfig.Auth.AccessKey,
+		c.ClientConfig.Auth.SecretKey,
+		c.service+"-forward",
+		c.ClientConfig.Group,
+		resolver,
+		c.ClientConfig.Retry,
+		time.Duration(c.ClientConfig.Timeout)*time.Millisecond,
+		c.ClientConfig.MaxInflight)
+	if err != nil {
+		return err
+	}
+	prod.compressThreshold = c.ClientConfig.CompressThreshold
+	if err = prod.start(); err != nil {
+		return err
+	}
+	c.forwardProducer = prod
+	return nil
+}
+
+// stopForwardProducer 停止转发生产者，调用方需持有锁
+func (c *client) stopForwardProducer() {
+	if c.forwardProducer == nil {
+		return
+	}
+	if err := c.forwardProducer.stop(); err != nil {
+		wrapLogger(zlog.ErrorLogger, nil, "failed to stop forward producer", zap.String("error", err.Error()))
+	}
+	c.forwardProducer = nil
+}
+
+// getForwardProducer 获取转发生产者，尚未启动时启动
+func (c *client) getForwardProducer() (*rmqProducer, error) {
+	c.mu.RLock()
+	prod := c.forwardProducer
+	c.mu.RUnlock()
+	if prod != nil {
+		return prod, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.forwardProducer == nil {
+		resolver, err := c.nsResolver()
+		if err != nil {
+			return nil, err
+		}
+		if err = c.startForwardProducer(resolver); err != nil {
+			return nil, err
+		}
+	}
+	return c.forwardProducer, nil
+}
+
 // StartConsumer 启动指定已注册的RocketMQ消费服务， 同时指定要消费的消息标签，以及消费回调
+// 通过 UseMiddleware 注册的中间件会包装 callback
 func StartConsumer(g *gin.Engine, service string, tags []string, callback MessageCallback) error {
-	if _, exist := rmqServices[service]; !exist {
+	client, exist := lookupClient(service)
+	if !exist {
 		return ErrRmqSvcNotRegistered
 	}
-	client := rmqServices[service]
 	client.mu.Lock()
 	defer client.mu.Unlock()
 	if client.pushConsumer != nil || callback == nil {
 		return ErrRmqSvcInvalidOperation
 	}
-	var err error
-	var nsDomain string
-	nsDomain, err = client.getNameserverDomain()
-	if err != nil {
-		wrapLogger(zlog.ErrorLogger, nil, "invalid consumer nameServer", zap.Any("error", err))
-		return err
+	if client.ClientConfig.Topic == "" {
+		return ErrRmqSvcConfigInvalid
 	}
 
-	cb := func(ctx context.Context, msgList ...*primitive.MessageExt) (consumer.ConsumeResult, error) {
-		for _, m := range msgList {
+	cb := client.consumeCallback(g, Chain(callback, client.middlewares...))
+	subs := []subscription{{topic: client.ClientConfig.Topic, tags: tags, cb: cb}}
+	return client.startPushConsumer(subs, 1)
+}
+
+// StartMultiConsumer 启动指定已注册的RocketMQ消费服务，在同一消费者组下订阅 ClientConfig.Subscriptions 中的全部主题，
+// handlers 以主题为键指定各主题的消费回调，每个订阅的主题都需要有对应的回调。
+// 通过 UseMiddleware 注册的中间件会包装每个回调
+func StartMultiConsumer(g *gin.Engine, service string, handlers map[string]MessageCallback) error {
+	client, exist := lookupClient(service)
+	if !exist {
+		return ErrRmqSvcNotRegistered
+	}
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if client.pushConsumer != nil || len(client.ClientConfig.Subscriptions) == 0 {
+		return ErrRmqSvcInvalidOperation
+	}
+
+	subs := make([]subscription, 0, len(client.ClientConfig.Subscriptions))
+	for _, sub := range client.ClientConfig.Subscriptions {
+		callback, ok := handlers[sub.Topic]
+		if !ok || callback == nil {
+			wrapLogger(zlog.ErrorLogger, nil, "no handler for subscribed topic", zap.String("topic", sub.Topic))
+			return ErrRmqSvcInvalidOperation
+		}
+		subs = append(subs, subscription{
+			topic: sub.Topic,
+			tags:  sub.Tags,
+			cb:    client.consumeCallback(g, Chain(callback, client.middlewares...)),
+		})
+	}
+	return client.startPushConsumer(subs, 1)
+}
+
+// consumeCallback 将业务回调转换为SDK的消费回调，逐条消费消息
+func (c *client) consumeCallback(g *gin.Engine, callback MessageCallback) pushConsumerCallback {
+	return func(ctx context.Context, msgList ...*primitive.MessageExt) (consumer.ConsumeResult, error) {
+		due, err := c.hopDue(msgList)
+		if err != nil {
+			return c.retryLater(ctx, 0), nil
+		}
+		for _, m := range due {
 			if ctx.Err() != nil {
 				wrapLogger(zlog.ErrorLogger, nil, "stop consume cause ctx cancelled", zap.Any("error", ctx.Err()))
 				return consumer.SuspendCurrentQueueAMoment, ctx.Err()
 			}
-			if err := call(g, callback, m); err != nil {
-				return consumer.SuspendCurrentQueueAMoment, nil
+			if err = call(g, callback, m); err != nil {
+				return c.consumeFailed(ctx, err, m), nil
 			}
 		}
 		return consumer.ConsumeSuccess, nil
 	}
+}
+
+// StartBatchConsumer 启动指定已注册的RocketMQ消费服务，以批量方式消费消息。
+// 每批最多 ClientConfig.BatchSize 条消息，为单次拉取到的消息，不会等待凑满一批。
+// 一批消息作为整体确认：回调返回nil时全部确认，返回错误时整批按错误类型重试、丢弃或投递死信，
+// 其中已处理成功的消息也会被重新投递，回调需要保证幂等。UseMiddleware 注册的中间件不作用于批量回调。
+// 未到投递时间的延迟消息（见 Message.WithDelayUntil）被转发后不会出现在回调的消息列表中；
+// 配置了 DeadLetterTopic 时，无法解压的消息单独投递死信，也不会出现在回调的消息列表中，否则整批投递死信
+func StartBatchConsumer(g *gin.Engine, service string, tags []string, callback BatchMessageCallback) error {
+	client, exist := lookupClient(service)
+	if !exist {
+		return ErrRmqSvcNotRegistered
+	}
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if client.pushConsumer != nil || callback == nil {
+		return ErrRmqSvcInvalidOperation
+	}
+	if client.ClientConfig.Topic == "" {
+		return ErrRmqSvcConfigInvalid
+	}
+
+	cb := func(ctx context.Context, msgList ...*primitive.MessageExt) (consumer.ConsumeResult, error) {
+		if ctx.Err() != nil {
+			wrapLogger(zlog.ErrorLogger, nil, "stop consume cause ctx cancelled", zap.Any("error", ctx.Err()))
+			return consumer.SuspendCurrentQueueAMoment, ctx.Err()
+		}
+		due, err := client.hopDue(msgList)
+		if err != nil {
+			return client.retryLater(ctx, 0), nil
+		}
+		if len(due) == 0 {
+			return consumer.ConsumeSuccess, nil
+		}
+		if err = callBatch(g, client, callback, due); err != nil {
+			return client.consumeFailed(ctx, err, due...), nil
+		}
+		return consumer.ConsumeSuccess, nil
+	}
+
+	batchSize := client.ClientConfig.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+	subs := []subscription{{topic: client.ClientConfig.Topic, tags: tags, cb: cb}}
+	return client.startPushConsumer(subs, batchSize)
+}
+
+// startPushConsumer 创建并启动推模式消费者，每次回调最多 batchSize 条消息，调用方需持有锁
+func (c *client) startPushConsumer(subs []subscription, batchSize int, options ...consumer.Option) error {
+	// 每次拉取的消息数不少于一批消费的消息数
+	pullBatchSize := c.ClientConfig.PullBatchSize
+	if pullBatchSize <= 0 {
+		pullBatchSize = defaultPullBatchSize
+	}
+	if pullBatchSize < batchSize {
+		pullBatchSize = batchSize
+	}
+	if pullBatchSize != defaultPullBatchSize {
+		options = append([]consumer.Option{consumer.WithPullBatchSize(int32(pullBatchSize))}, options...)
+	}
+	if c.ClientConfig.PullInterval > 0 {
+		options = append([]consumer.Option{consumer.WithPullInterval(time.Duration(c.ClientConfig.PullInterval) * time.Millisecond)}, options...)
+	}
 
-	client.pushConsumer, err = newPushConsumer(
-		client.ClientConfig.Auth.AccessKey,
-		client.ClientConfig.Auth.SecretKey,
-		service,
-		client.ClientConfig.Group,
-		client.ClientConfig.Topic,
-		client.ClientConfig.Broadcast,
-		client.ClientConfig.Orderly,
-		client.ClientConfig.Retry,
-		tags,
-		nsDomain,
-		cb)
+	var err error
+	var resolver primitive.NsResolver
+	resolver, err = c.nsResolver()
+	if err != nil {
+		wrapLogger(zlog.ErrorLogger, nil, "invalid consumer nameServer", zap.Any("error", err))
+		return err
+	}
+
+	// 配置了死信主题时预先启动转发生产者，其他情况在首次转发时启动
+	if c.ClientConfig.DeadLetterTopic != "" {
+		if err = c.startForwardProducer(resolver); err != nil {
+			return err
+		}
+	}
+
+	c.pushConsumer, err = newPushConsumer(
+		c.ClientConfig.Auth.AccessKey,
+		c.ClientConfig.Auth.SecretKey,
+		c.service,
+		c.ClientConfig.Group,
+		c.ClientConfig.Broadcast,
+		c.ClientConfig.Orderly,
+		c.maxReconsumeTimes(),
+		batchSize,
+		subs,
+		resolver,
+		options...)
 	if err != nil {
 		wrapLogger(zlog.ErrorLogger, nil, "create new consumer error", zap.Any("error", err))
+		c.stopForwardProducer()
+		return err
+	}
+	c.pushConsumer.concurrency = c.ClientConfig.ConsumeGoroutines
+	c.pushConsumer.limiter = newRateLimiter(c.ClientConfig.MaxConsumePerSecond)
+	if err = c.pushConsumer.start(); err != nil {
+		c.pushConsumer = nil
+		c.stopForwardProducer()
 		return err
 	}
-	return client.pushConsumer.start()
+	return nil
 }
 
 // StopConsumer 停止指定已注册的RocketMQ消费服务
 func StopConsumer(service string) error {
-	if client, exist := rmqServices[service]; exist {
+	if client, exist := lookupClient(service); exist {
+		client.mu.Lock()
+		con := client.pushConsumer
+		client.pushConsumer = nil
+		client.mu.Unlock()
+		if con == nil {
+			return ErrRmqSvcInvalidOperation
+		}
+		// 消费者停止后再关闭转发生产者，停止过程中的消息仍可投递到死信主题
+		err := con.stop()
+		client.mu.Lock()
+		client.stopForwardProducer()
+		client.mu.Unlock()
+		return err
+	}
+	return ErrRmqSvcNotRegistered
+}
+
+// PauseConsumer 暂停指定已注册服务的消费，进行中的回调不受影响，已拉取的消息在恢复后继续处理。
+// 暂停期间SDK按流控停止拉取，不影响消息的重试次数
+func PauseConsumer(service string) error {
+	if client, exist := lookupClient(service); exist {
+		client.mu.RLock()
+		con := client.pushConsumer
+		client.mu.RUnlock()
+		if con == nil {
+			return ErrRmqSvcInvalidOperation
+		}
+		con.pause()
+		wrapLogger(zlog.InfoLogger, nil, "rmq consumer paused", zap.String("service", service))
+		return nil
+	}
+	return ErrRmqSvcNotRegistered
+}
+
+// ResumeConsumer 恢复通过 PauseConsumer 暂停的消费
+func ResumeConsumer(service string) error {
+	if client, exist := lookupClient(service); exist {
+		client.mu.RLock()
+		con := client.pushConsumer
+		client.mu.RUnlock()
+		if con == nil {
+			return ErrRmqSvcInvalidOperation
+		}
+		con.resume()
+		wrapLogger(zlog.InfoLogger, nil, "rmq consumer resumed", zap.String("service", service))
+		return nil
+	}
+	return ErrRmqSvcNotRegistered
+}
+
+// StartPullConsumer 启动指定已注册服务的拉模式消费者，用于回溯、补数等任务。
+// queues 为显式分配的队列，位点由 store 保存（为nil时保存在内存中），不会影响同组推模式消费者的位点
+func StartPullConsumer(service string, queues []PullQueue, store OffsetStore) error {
+	if client, ok := lookupClient(service); ok {
 		client.mu.Lock()
 		defer client.mu.Unlock()
-		if client.pushConsumer == nil {
+		if client.pullConsumer != nil || len(queues) == 0 || client.ClientConfig.Topic == "" {
 			return ErrRmqSvcInvalidOperation
 		}
-		err := client.pushConsumer.stop()
-		client.pushConsumer = nil
+		resolver, err := client.nsResolver()
+		if err != nil {
+			wrapLogger(zlog.ErrorLogger, nil, "invalid pull consumer nameServer", zap.Any("error", err))
+			return err
+		}
+		con, err := newPullConsumer(
+			client.ClientConfig.Auth.AccessKey,
+			client.ClientConfig.Auth.SecretKey,
+			service,
+			client.ClientConfig.Group,
+			client.ClientConfig.Topic,
+			resolver,
+			queues,
+			store)
+		if err != nil {
+			return err
+		}
+		if err = con.start(); err != nil {
+			wrapLogger(zlog.ErrorLogger, nil, "failed to start pull consumer", zap.String("error", err.Error()))
+			return err
+		}
+		client.pullConsumer = con
+		return nil
+	}
+	return ErrRmqSvcNotRegistered
+}
+
+// StopPullConsumer 停止指定已注册服务的拉模式消费者
+func StopPullConsumer(service string) error {
+	if client, ok := lookupClient(service); ok {
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		if client.pullConsumer == nil {
+			return ErrRmqSvcInvalidOperation
+		}
+		err := client.pullConsumer.stop()
+		client.pullConsumer = nil
 		return err
 	}
 	return ErrRmqSvcNotRegistered
 }
 
 // NewMessage return a new Message.
+// 消息发送到服务配置的主题 ClientConfig.Topic
 func NewMessage(service string, content []byte) (Message, error) {
-	if client, exist := rmqServices[service]; exist {
+	if client, exist := lookupClient(service); exist {
+		if client.ClientConfig.Topic == "" {
+			return nil, ErrRmqSvcConfigInvalid
+		}
 		return &messageWrapper{
 			client: client,
 			msg:    primitive.NewMessage(client.ClientConfig.Topic, content),
@@ -187,7 +557,21 @@ func NewMessage(service string, content []byte) (Message, error) {
 	return nil, ErrRmqSvcNotRegistered
 }
 
-// save consumers.
+// NewMessageTo 创建发送到指定主题 topic 的消息，使用服务 service 的生产者发送
+func NewMessageTo(service string, topic string, content []byte) (Message, error) {
+	if topic == "" {
+		return nil, ErrRmqSvcInvalidOperation
+	}
+	if client, exist := lookupClient(service); exist {
+		return &messageWrapper{
+			client: client,
+			msg:    primitive.NewMessage(topic, content),
+		}, nil
+	}
+	return nil, ErrRmqSvcNotRegistered
+}
+
+// save consumers. 与 rmqServices 共用 rmqServicesMu
 var consumers []string
 
 // Use will start the consumer of service.
@@ -195,11 +579,18 @@ func Use(g *gin.Engine, service string, tags []string, handler MessageCallback)
 	if err := StartConsumer(g, service, tags, handler); err != nil {
 		panic("Start consumer  error: " + err.Error())
 	}
+	rmqServicesMu.Lock()
 	consumers = append(consumers, service)
+	rmqServicesMu.Unlock()
 }
 
+// StopRocketMqConsume 停止通过 Use 启动的消费者，不等待进行中的消费回调。
+// 进程退出时使用 Shutdown 关闭全部服务
 func StopRocketMqConsume() {
-	for _, svc := range consumers {
+	rmqServicesMu.RLock()
+	services := append([]string(nil), consumers...)
+	rmqServicesMu.RUnlock()
+	for _, svc := range services {
 		_ = StopConsumer(svc)
 	}
 }
@@ -1,9 +1,19 @@
 package rmq
 
 import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
 	"github.com/apache/rocketmq-client-go/v2"
 	"github.com/apache/rocketmq-client-go/v2/primitive"
 	"github.com/apache/rocketmq-client-go/v2/producer"
+	"github.com/derekAHua/goLib/zlog"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
 )
 
 // @Author: Derek
@@ -17,7 +27,153 @@ type (
 	}
 )
 
+// NewRocketMqTransactionProducer 直接创建SDK的事务生产者，未接入服务注册，推荐使用 StartTransactionProducer
 func NewRocketMqTransactionProducer(listener primitive.TransactionListener, opts ...producer.Option) (RocketMqTransactionProducer, error) {
-	// TODO Implement RocketMqTransactionProducer.
 	return producer.NewTransactionProducer(listener, opts...)
 }
+
+// TransactionState 本地事务状态
+type TransactionState = primitive.LocalTransactionState
+
+const (
+	// TransactionCommit 提交事务，消息对消费者可见
+	TransactionCommit = primitive.CommitMessageState
+	// TransactionRollback 回滚事务，消息被丢弃
+	TransactionRollback = primitive.RollbackMessageState
+	// TransactionUnknown 状态未知，等待Broker回查
+	TransactionUnknown = primitive.UnknowState
+)
+
+type (
+	// TransactionExecutor 执行本地事务，arg 为 SendInTransaction 传入的参数
+	TransactionExecutor func(ctx *gin.Context, msg Message, arg interface{}) TransactionState
+	// TransactionChecker 处理Broker对状态未知的事务消息的回查
+	TransactionChecker func(ctx *gin.Context, msg Message) TransactionState
+)
+
+// transactionArg 半消息发送成功后执行本地事务所需的上下文
+type transactionArg struct {
+	ctx *gin.Context
+	msg Message
+	arg interface{}
+}
+
+type transactionListener struct {
+	service  string
+	executor TransactionExecutor
+	checker  TransactionChecker
+	// SDK在 SendMessageInTransaction 中同步回调 ExecuteLocalTransaction，以消息指针关联调用参数
+	pending sync.Map
+}
+
+func (l *transactionListener) ExecuteLocalTransaction(msg *primitive.Message) TransactionState {
+	v, ok := l.pending.Load(msg)
+	if !ok {
+		wrapLogger(zlog.ErrorLogger, nil, "transaction arg not found", zap.String("service", l.service), zap.String("message", msg.String()))
+		return TransactionUnknown
+	}
+	t := v.(*transactionArg)
+	return l.run(t.ctx, "execute", func() TransactionState {
+		return l.executor(t.ctx, t.msg, t.arg)
+	})
+}
+
+func (l *transactionListener) CheckLocalTransaction(m *primitive.MessageExt) TransactionState {
+	ctx := &gin.Context{}
+	extractTrace(ctx, &m.Message)
+	msg, err := wrapMessageExt(m)
+	if err != nil {
+		// 消息体无法解压，交由Broker稍后回查
+		wrapLogger(zlog.ErrorLogger, ctx, "skip checking undecodable transaction message",
+			zap.String("service", l.service),
+			zap.String("msgId", m.MsgId),
+			zap.String("error", err.Error()))
+		return TransactionUnknown
+	}
+	state := l.run(ctx, "check", func() TransactionState {
+		return l.checker(ctx, msg)
+	})
+	wrapLogger(zlog.InfoLogger, ctx, "rmq transaction checked",
+		zap.String("service", l.service),
+		zap.String("msgId", m.MsgId),
+		zap.String("transactionId", m.TransactionId),
+		zap.Int("state", int(state)),
+	)
+	return state
+}
+
+// run 执行业务回调，panic 时返回 TransactionUnknown 交由Broker回查
+func (l *transactionListener) run(ctx *gin.Context, stage string, fn func() TransactionState) (state TransactionState) {
+	defer func() {
+		if r := recover(); r != nil {
+			wrapLogger(zlog.ErrorLogger, ctx, "transaction callback panic",
+				zap.String("service", l.service),
+				zap.String("stage", stage),
+				zap.String("error", fmt.Sprint(r)),
+			)
+			state = TransactionUnknown
+		}
+	}()
+	return fn()
+}
+
+func newTransactionProducer(ak, sk string, instance, group string, resolver primitive.NsResolver, retry int, timeout time.Duration, executor TransactionExecutor, checker TransactionChecker) (*rmqTransactionProducer, error) {
+	listener := &transactionListener{
+		service:  instance,
+		executor: executor,
+		checker:  checker,
+	}
+	options := producerOptions(ak, sk, instance+"-"+strconv.Itoa(os.Getpid())+"-tx-producer", group, resolver, retry, timeout)
+	prod, err := rocketmq.NewTransactionProducer(listener, options...)
+	if err != nil {
+		wrapLogger(zlog.ErrorLogger, nil, "failed to create transaction producer",
+			zap.String("ns", resolver.Description()),
+			zap.String("error", err.Error()))
+		return nil, err
+	}
+
+	return &rmqTransactionProducer{
+		producer: prod,
+		listener: listener,
+	}, nil
+}
+
+type rmqTransactionProducer struct {
+	producer rocketmq.TransactionProducer
+	listener *transactionListener
+	// compressThreshold 消息体超过该字节数时压缩，不大于0时不压缩
+	compressThreshold int
+}
+
+func (p *rmqTransactionProducer) start() error {
+	err := p.producer.Start()
+	if err != nil {
+		wrapLogger(zlog.ErrorLogger, nil, "failed to start transaction producer",
+			zap.String("error", err.Error()))
+		return err
+	}
+	return nil
+}
+
+func (p *rmqTransactionProducer) stop() error {
+	return p.producer.Shutdown()
+}
+
+// SendMessage 发送半消息并执行本地事务，返回消息ID及最终的本地事务状态
+func (p *rmqTransactionProducer) SendMessage(ctx context.Context, t *transactionArg, msg *primitive.Message) (*primitive.TransactionSendResult, error) {
+	msgList, err := compressMessages(p.compressThreshold, []*primitive.Message{msg})
+	if err != nil {
+		return nil, err
+	}
+	msg = msgList[0]
+	p.listener.pending.Store(msg, t)
+	defer p.listener.pending.Delete(msg)
+
+	res, err := p.producer.SendMessageInTransaction(ctx, msg)
+	if err != nil {
+		wrapLogger(zlog.ErrorLogger, nil, "failed to send transaction message",
+			zap.String("error", err.Error()))
+		return nil, err
+	}
+	return res, nil
+}
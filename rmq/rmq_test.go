@@ -1,8 +1,23 @@
 package rmq
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"strconv"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/apache/rocketmq-client-go/v2"
+	"github.com/apache/rocketmq-client-go/v2/consumer"
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/derekAHua/goLib/env"
+	"github.com/derekAHua/goLib/redis/redistest"
+	"github.com/derekAHua/goLib/zlog"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"github.com/stretchr/testify/assert"
 )
 
 // @Author: Derek
@@ -10,6 +25,10 @@ import (
 // @Date: 2022/8/14 20:19
 // @Version 1.0
 
+func TestMain(m *testing.M) {
+	redistest.Main(m, zlog.LogNameRMQ)
+}
+
 func TestDelay(t *testing.T) {
 	fmt.Println(Second)
 	fmt.Println(Seconds5)
@@ -30,3 +49,811 @@ func TestDelay(t *testing.T) {
 	fmt.Println(Hour1)
 	fmt.Println(Hours2)
 }
+
+func TestTransactionListener(t *testing.T) {
+	l := &transactionListener{
+		executor: func(ctx *gin.Context, msg Message, arg interface{}) TransactionState {
+			if arg.(string) == "panic" {
+				panic("local transaction failed")
+			}
+			return TransactionCommit
+		},
+		checker: func(ctx *gin.Context, msg Message) TransactionState {
+			return TransactionRollback
+		},
+	}
+
+	msg := primitive.NewMessage("topic", []byte("body"))
+	assert.Equal(t, TransactionUnknown, l.ExecuteLocalTransaction(msg))
+
+	l.pending.Store(msg, &transactionArg{ctx: &gin.Context{}, arg: "ok"})
+	assert.Equal(t, TransactionCommit, l.ExecuteLocalTransaction(msg))
+	l.pending.Store(msg, &transactionArg{ctx: &gin.Context{}, arg: "panic"})
+	assert.Equal(t, TransactionUnknown, l.ExecuteLocalTransaction(msg))
+
+	assert.Equal(t, TransactionRollback, l.CheckLocalTransaction(&primitive.MessageExt{Message: primitive.Message{Topic: "topic"}}))
+}
+
+func TestOutbox_Lock(t *testing.T) {
+	ctx := &gin.Context{}
+	r, s := redistest.NewRedis(t)
+	s.Script(outboxRenewScript, func(call func(args ...string) interface{}, keys, argv []string) interface{} {
+		if v, _ := call("GET", keys[0]).(string); v == argv[0] {
+			return call("PEXPIRE", keys[0], argv[1])
+		}
+		return int64(0)
+	})
+
+	o1 := NewOutbox(nil, r, "outbox", WithOutboxLockTTL(time.Second))
+	o2 := NewOutbox(nil, r, "outbox", WithOutboxLockTTL(time.Second))
+	locked, err := o1.lock(ctx)
+	assert.Nil(t, err)
+	assert.True(t, locked)
+	locked, err = o2.lock(ctx)
+	assert.Nil(t, err)
+	assert.False(t, locked)
+
+	// 持有者续期成功，过期后其他实例可以获取
+	locked, err = o1.lock(ctx)
+	assert.Nil(t, err)
+	assert.True(t, locked)
+	s.FastForward(2 * time.Second)
+	locked, err = o2.lock(ctx)
+	assert.Nil(t, err)
+	assert.True(t, locked)
+
+	// 租约在 ttl/3 内不重复续期，锁被其他实例持有后续期失败
+	lease := &outboxLease{outbox: o2, ctx: ctx}
+	assert.True(t, lease.hold())
+	assert.True(t, lease.hold())
+	lease = &outboxLease{outbox: o1, ctx: ctx}
+	assert.False(t, lease.hold())
+	assert.False(t, lease.hold())
+}
+
+func TestOutbox_Truncate(t *testing.T) {
+	assert.Equal(t, "abc", truncate("abc", 5))
+	assert.Equal(t, "ab", truncate("abc", 2))
+	// "消息" 每个字符3字节
+	assert.Equal(t, "消", truncate("消息", 4))
+	assert.Equal(t, "", truncate("消息", 2))
+	assert.Equal(t, "消息", truncate("消息", 6))
+}
+
+func TestOutbox_SendWithoutDefaultTopic(t *testing.T) {
+	fake := &syncProducer{}
+	rmqServices["outbox-test"] = &client{
+		ClientConfig: &ClientConfig{},
+		service:      "outbox-test",
+		producer:     &rmqProducer{producer: fake, inflight: make(chan struct{}, 1)},
+	}
+	defer delete(rmqServices, "outbox-test")
+
+	o := NewOutbox(nil, nil, "outbox")
+	id, err := o.send(context.Background(), &OutboxMessage{Service: "outbox-test", Topic: "order", Body: []byte("paid"), Properties: `{"source":"outbox"}`})
+	assert.Nil(t, err)
+	assert.Equal(t, "forwarded", id)
+	assert.Len(t, fake.sent, 1)
+	assert.Equal(t, "order", fake.sent[0].Topic)
+	assert.Equal(t, "outbox", fake.sent[0].GetProperty("source"))
+}
+
+func TestOutbox_Backoff(t *testing.T) {
+	o := NewOutbox(nil, nil, "outbox", WithOutboxBackoff(time.Second, 10*time.Second))
+	assert.Equal(t, time.Second, o.backoff(1))
+	assert.Equal(t, 4*time.Second, o.backoff(3))
+	assert.Equal(t, 10*time.Second, o.backoff(5))
+}
+
+type asyncProducer struct {
+	rocketmq.Producer
+	callbacks chan func(context.Context, *primitive.SendResult, error)
+	// ctx 最近一次 SendAsync 收到的 ctx
+	ctx context.Context
+}
+
+func (p *asyncProducer) SendAsync(ctx context.Context, f func(context.Context, *primitive.SendResult, error), _ ...*primitive.Message) error {
+	p.ctx = ctx
+	p.callbacks <- f
+	return nil
+}
+
+func (p *asyncProducer) Shutdown() error {
+	return nil
+}
+
+func TestProducer_Inflight(t *testing.T) {
+	fake := &asyncProducer{callbacks: make(chan func(context.Context, *primitive.SendResult, error), 2)}
+	p := &rmqProducer{producer: fake, inflight: make(chan struct{}, 1)}
+
+	var results []error
+	callback := func(_ *primitive.SendResult, err error) {
+		results = append(results, err)
+	}
+	assert.Nil(t, p.SendMessageAsync(context.Background(), callback))
+
+	// 名额已满，ctx 超时后放弃
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, p.SendMessageAsync(ctx, callback))
+
+	stopped := make(chan error)
+	go func() {
+		stopped <- p.stop()
+	}()
+	select {
+	case <-stopped:
+		t.Fatal("stop returned before pending send finished")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	f := <-fake.callbacks
+	f(context.Background(), &primitive.SendResult{}, nil)
+	assert.Nil(t, <-stopped)
+	assert.Equal(t, []error{nil}, results)
+	assert.Equal(t, ErrRmqSvcInvalidOperation, p.SendMessageAsync(context.Background(), callback))
+}
+
+func TestProducer_AsyncDetached(t *testing.T) {
+	fake := &asyncProducer{callbacks: make(chan func(context.Context, *primitive.SendResult, error), 1)}
+	p := &rmqProducer{producer: fake, timeout: time.Second, inflight: make(chan struct{}, 1)}
+
+	// 请求结束后发送不被取消，以发送超时时间为限
+	ctx, cancel := context.WithCancel(context.Background())
+	assert.Nil(t, p.SendMessageAsync(ctx, func(*primitive.SendResult, error) {}))
+	cancel()
+	assert.Nil(t, fake.ctx.Err())
+	deadline, ok := fake.ctx.Deadline()
+	assert.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(time.Second), deadline, 100*time.Millisecond)
+
+	f := <-fake.callbacks
+	f(context.Background(), &primitive.SendResult{}, nil)
+	assert.Equal(t, context.Canceled, fake.ctx.Err())
+}
+
+func TestTracePropagation(t *testing.T) {
+	producerCtx := &gin.Context{}
+	producerCtx.Set(zlog.ContextKeyLogId, "log-1")
+	producerCtx.Set(zlog.ContextKeyRequestId, "req-1")
+
+	ext := &primitive.MessageExt{Message: primitive.Message{Topic: "topic", Body: []byte("body")}}
+	injectTrace(producerCtx, &ext.Message)
+
+	var logID, requestID string
+	err := call(nil, func(ctx *gin.Context, msg Message) error {
+		logID, requestID = zlog.GetLogId(ctx), zlog.GetRequestId(ctx)
+		return nil
+	}, ext)
+	assert.Nil(t, err)
+	assert.Equal(t, "log-1", logID)
+	assert.Equal(t, "req-1", requestID)
+}
+
+func TestMiddleware(t *testing.T) {
+	ctx := &gin.Context{}
+	var trace []string
+	mark := func(name string) MessageMiddleware {
+		return func(next MessageCallback) MessageCallback {
+			return func(ctx *gin.Context, msg Message) error {
+				trace = append(trace, name)
+				return next(ctx, msg)
+			}
+		}
+	}
+
+	var observed []string
+	cb := Chain(RouteByTag(map[string]MessageCallback{
+		"ok": func(ctx *gin.Context, msg Message) error {
+			trace = append(trace, "ok")
+			return nil
+		},
+		"panic": func(ctx *gin.Context, msg Message) error {
+			panic("boom")
+		},
+	}, nil), mark("a"), mark("b"), Metrics(func(tag string, cost time.Duration, err error) {
+		observed = append(observed, tag)
+	}), Recovery())
+
+	msg := &messageWrapper{msg: primitive.NewMessage("topic", []byte("body")).WithTag("ok")}
+	assert.Nil(t, cb(ctx, msg))
+	assert.Equal(t, []string{"a", "b", "ok"}, trace)
+
+	msg = &messageWrapper{msg: primitive.NewMessage("topic", []byte("body")).WithTag("panic")}
+	assert.NotNil(t, cb(ctx, msg))
+	msg = &messageWrapper{msg: primitive.NewMessage("topic", []byte("body")).WithTag("unknown")}
+	assert.Nil(t, cb(ctx, msg))
+	assert.Equal(t, []string{"ok", "panic", "unknown"}, observed)
+}
+
+// foreignMessage 不是由本包创建的 Message 实现
+type foreignMessage struct {
+	Message
+}
+
+func TestRawMessages(t *testing.T) {
+	m := &messageWrapper{msg: primitive.NewMessage("topic", []byte("body"))}
+	list, err := rawMessages([]Message{m})
+	assert.Nil(t, err)
+	assert.Equal(t, []*primitive.Message{m.msg}, list)
+
+	// 拦截器替换为其他实现时返回错误而不是 panic
+	_, err = rawMessages([]Message{m, foreignMessage{m}})
+	assert.Equal(t, ErrRmqSvcInvalidOperation, err)
+}
+
+func TestDedup(t *testing.T) {
+	ctx := &gin.Context{}
+	r, s := redistest.NewRedis(t)
+	s.SetTime(time.Date(2022, 8, 14, 12, 0, 0, 0, time.UTC))
+	s.Script(dedupClearScript, func(call func(args ...string) interface{}, keys, argv []string) interface{} {
+		if v, _ := call("GET", keys[0]).(string); v == argv[0] {
+			return call("DEL", keys[0])
+		}
+		return int64(0)
+	})
+
+	var (
+		calls    int
+		takeover bool
+	)
+	fail := true
+	cb := Chain(func(ctx *gin.Context, msg Message) error {
+		calls++
+		if takeover {
+			// 处理超时，标记过期后被其他消费者占用
+			s.FastForward(6 * time.Minute)
+			assert.Nil(t, r.Set(ctx, "rmq:dedup:group:msg-3", "processing:other"))
+		}
+		if fail {
+			return fmt.Errorf("failed")
+		}
+		return nil
+	}, Dedup(r, "group", WithDedupProperty("orderId")))
+
+	msg := &messageWrapper{msg: primitive.NewMessage("topic", nil), msgID: "msg-1"}
+	assert.NotNil(t, cb(ctx, msg))
+	fail = false
+	assert.Nil(t, cb(ctx, msg))
+	assert.Nil(t, cb(ctx, msg))
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, 24*time.Hour, s.TTL("rmq:dedup:group:msg-1"))
+
+	// 业务键相同视为重复消息
+	other := &messageWrapper{msg: primitive.NewMessage("topic", nil), msgID: "msg-2"}
+	other.msg.WithProperty("orderId", "order-1")
+	assert.Nil(t, r.Set(ctx, "rmq:dedup:group:order-1", dedupProcessing))
+	assert.Equal(t, ErrRmqMessageProcessing, cb(ctx, other))
+	assert.Equal(t, 2, calls)
+
+	// 失败时不清除其他消费者的标记
+	takeover, fail = true, true
+	late := &messageWrapper{msg: primitive.NewMessage("topic", nil), msgID: "msg-3"}
+	assert.NotNil(t, cb(ctx, late))
+	assert.Equal(t, ErrRmqMessageProcessing, cb(ctx, late))
+	assert.Equal(t, 3, calls)
+}
+
+func TestConsumeFailed(t *testing.T) {
+	c := &client{ClientConfig: &ClientConfig{Retry: 3}}
+	newCtx := func() (context.Context, *primitive.ConsumeConcurrentlyContext) {
+		cc := primitive.NewConsumeConcurrentlyContext()
+		return primitive.WithConcurrentlyCtx(context.Background(), cc), cc
+	}
+	m := &primitive.MessageExt{Message: primitive.Message{Topic: "topic"}}
+
+	ctx, cc := newCtx()
+	assert.Equal(t, consumer.ConsumeRetryLater, c.consumeFailed(ctx, RetryLater(Seconds30, errors.New("busy")), m))
+	assert.Equal(t, int(Seconds30), cc.DelayLevelWhenNextConsume)
+
+	ctx, _ = newCtx()
+	assert.Equal(t, consumer.ConsumeSuccess, c.consumeFailed(ctx, Drop(errors.New("invalid")), m))
+
+	// 超过最大重试次数且未配置死信主题时交由Broker投递到默认死信队列
+	m.ReconsumeTimes = 3
+	ctx, cc = newCtx()
+	assert.Equal(t, consumer.ConsumeRetryLater, c.consumeFailed(ctx, errors.New("failed"), m))
+	assert.Equal(t, -1, cc.DelayLevelWhenNextConsume)
+
+	c.Orderly = true
+	oc := primitive.NewConsumeOrderlyContext()
+	ctx = primitive.WithOrderlyCtx(context.Background(), oc)
+	m.ReconsumeTimes = 0
+	assert.Equal(t, consumer.SuspendCurrentQueueAMoment, c.consumeFailed(ctx, RetryLater(Seconds5, nil), m))
+	assert.Equal(t, 5000, oc.SuspendCurrentQueueTimeMillis)
+}
+
+func TestCallBatch(t *testing.T) {
+	msgList := []*primitive.MessageExt{
+		{Message: primitive.Message{Topic: "topic", Body: []byte("1")}, MsgId: "a"},
+		{Message: primitive.Message{Topic: "topic", Body: []byte("2")}, MsgId: "b"},
+	}
+
+	var bodies []string
+	collect := func(ctx *gin.Context, msgs []Message) error {
+		for _, m := range msgs {
+			bodies = append(bodies, string(m.GetContent()))
+		}
+		return nil
+	}
+	err := callBatch(nil, nil, collect, msgList)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1", "2"}, bodies)
+
+	err = callBatch(nil, nil, func(ctx *gin.Context, msgs []Message) error {
+		panic("boom")
+	}, msgList)
+	assert.NotNil(t, err)
+
+	// 无法解压的消息单独投递死信，其余消息交给回调
+	bad := &primitive.MessageExt{Message: primitive.Message{Topic: "topic", Body: []byte("not gzip")}, MsgId: "bad"}
+	bad.WithProperty(PropertyContentEncoding, EncodingGzip)
+	msgList = append(msgList, bad)
+
+	// 未配置死信主题时整批投递死信
+	fake := &syncProducer{}
+	c := &client{
+		ClientConfig:    &ClientConfig{Group: "batch-group"},
+		forwardProducer: &rmqProducer{producer: fake, inflight: make(chan struct{}, 1)},
+	}
+	bodies = nil
+	var ce *ConsumeError
+	assert.True(t, errors.As(callBatch(nil, c, collect, msgList), &ce))
+	assert.Equal(t, ActionDeadLetter, ce.Action)
+	assert.Empty(t, bodies)
+	assert.Empty(t, fake.sent)
+
+	c.ClientConfig.DeadLetterTopic = "batch-dlq"
+	assert.Nil(t, callBatch(nil, c, collect, msgList))
+	assert.Equal(t, []string{"1", "2"}, bodies)
+	assert.Len(t, fake.sent, 1)
+	assert.Equal(t, "batch-dlq", fake.sent[0].Topic)
+	assert.Equal(t, "bad", fake.sent[0].GetProperty(PropertyDLQOriginMsgID))
+
+	// 回调失败整批重试时，已投递死信的消息不再重复投递
+	failed := errors.New("failed")
+	err = callBatch(nil, c, func(ctx *gin.Context, msgs []Message) error {
+		return failed
+	}, msgList)
+	assert.Equal(t, failed, err)
+	assert.Len(t, fake.sent, 2)
+	bodies = nil
+	assert.Nil(t, callBatch(nil, c, collect, msgList))
+	assert.Equal(t, []string{"1", "2"}, bodies)
+	assert.Len(t, fake.sent, 2)
+}
+
+// fakePullConsumer 每个队列有 size 条消息，位点 i 的存储时间为 1000+10*i 毫秒
+type fakePullConsumer struct {
+	size int64
+}
+
+func (f *fakePullConsumer) Start() error    { return nil }
+func (f *fakePullConsumer) Shutdown() error { return nil }
+
+func (f *fakePullConsumer) PullFrom(_ context.Context, mq *primitive.MessageQueue, offset int64, numbers int) (*primitive.PullResult, error) {
+	res := &primitive.PullResult{MinOffset: 0, MaxOffset: f.size, NextBeginOffset: offset, Status: primitive.PullNoNewMsg}
+	var msgs []*primitive.MessageExt
+	for i := offset; i < f.size && len(msgs) < numbers; i++ {
+		msgs = append(msgs, &primitive.MessageExt{
+			Message:        primitive.Message{Topic: mq.Topic, Body: []byte(strconv.FormatInt(i, 10))},
+			QueueOffset:    i,
+			StoreTimestamp: 1000 + 10*i,
+		})
+	}
+	if len(msgs) > 0 {
+		res.Status = primitive.PullFound
+		res.NextBeginOffset = offset + int64(len(msgs))
+		res.SetMessageExts(msgs)
+	}
+	return res, nil
+}
+
+func TestPullConsumer(t *testing.T) {
+	ctx := &gin.Context{}
+	q1, q2 := PullQueue{BrokerName: "broker-a", QueueID: 0}, PullQueue{BrokerName: "broker-a", QueueID: 1}
+	store := NewMemoryOffsetStore()
+	rmqServices["pull-test"] = &client{
+		ClientConfig: &ClientConfig{},
+		pullConsumer: newRmqPullConsumer(&fakePullConsumer{size: 10}, "topic", []PullQueue{q1, q2}, store),
+	}
+	defer delete(rmqServices, "pull-test")
+
+	offset, err := SeekTimestamp(ctx, "pull-test", q1, time.Unix(0, 1045*int64(time.Millisecond)))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), offset)
+
+	msgs, err := PullMessages(ctx, "pull-test", q1, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, "5", string(msgs[0].GetContent()))
+	assert.Equal(t, "6", string(msgs[1].GetContent()))
+	assert.Nil(t, SeekOffset("pull-test", q1, 5))
+	assert.Equal(t, ErrRmqSvcInvalidOperation, SeekOffset("pull-test", PullQueue{BrokerName: "broker-b"}, 0))
+
+	// q1 从位点5开始，q2 从头开始，只处理存储时间早于 1080ms 的消息
+	var bodies []string
+	err = PullLoop(ctx, "pull-test", func(ctx *gin.Context, msgs []Message) error {
+		for _, m := range msgs {
+			bodies = append(bodies, string(m.GetContent()))
+		}
+		return nil
+	}, WithPullBatch(4), WithPullUntil(time.Unix(0, 1080*int64(time.Millisecond))))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"5", "6", "7", "0", "1", "2", "3", "4", "5", "6", "7"}, bodies)
+
+	committed, ok, err := store.Load(ctx, q2)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, int64(8), committed)
+}
+
+func TestSubscriptions(t *testing.T) {
+	conf := ClientConfig{Group: "group", NameServers: []string{"127.0.0.1:9876"}}
+	assert.Equal(t, ErrRmqSvcConfigInvalid, conf.checkConfig())
+	conf.Subscriptions = []Subscription{{Topic: "order", Tags: []string{"paid", "refund"}}, {Topic: "user"}}
+	assert.Nil(t, conf.checkConfig())
+
+	rmqServices["multi-test"] = &client{ClientConfig: &conf, service: "multi-test"}
+	defer delete(rmqServices, "multi-test")
+
+	_, err := NewMessage("multi-test", []byte("body"))
+	assert.Equal(t, ErrRmqSvcConfigInvalid, err)
+	msg, err := NewMessageTo("multi-test", "user", []byte("body"))
+	assert.Nil(t, err)
+	assert.Equal(t, "user", msg.(*messageWrapper).msg.Topic)
+	_, err = NewMessageTo("unknown", "user", nil)
+	assert.Equal(t, ErrRmqSvcNotRegistered, err)
+
+	// 每个订阅的主题都需要回调
+	err = StartMultiConsumer(nil, "multi-test", map[string]MessageCallback{
+		"order": func(ctx *gin.Context, msg Message) error { return nil },
+	})
+	assert.Equal(t, ErrRmqSvcInvalidOperation, err)
+
+	assert.Equal(t, "paid||refund", subscription{topic: "order", tags: []string{"paid", "refund"}}.selector().Expression)
+	assert.Equal(t, "*", subscription{topic: "user"}.selector().Expression)
+}
+
+// syncProducer 记录同步发送的消息
+type syncProducer struct {
+	rocketmq.Producer
+	sent []*primitive.Message
+}
+
+func (p *syncProducer) SendSync(_ context.Context, msgs ...*primitive.Message) (*primitive.SendResult, error) {
+	p.sent = append(p.sent, msgs...)
+	return &primitive.SendResult{MessageQueue: &primitive.MessageQueue{}, MsgID: "forwarded"}, nil
+}
+
+func TestDelayUntil(t *testing.T) {
+	assert.Equal(t, DelayLevel(0), delayLevelFor(50*time.Millisecond))
+	assert.Equal(t, Second, delayLevelFor(500*time.Millisecond))
+	assert.Equal(t, Seconds30, delayLevelFor(45*time.Second))
+	assert.Equal(t, Minutes30, delayLevelFor(45*time.Minute))
+	assert.Equal(t, Hours2, delayLevelFor(72*time.Hour))
+
+	m := &messageWrapper{msg: primitive.NewMessage("topic", []byte("remind"))}
+	m.WithDelayDuration(45 * time.Minute)
+	at, ok := deliverAt(m.msg)
+	assert.True(t, ok)
+	assert.InDelta(t, float64(45*time.Minute), float64(time.Until(at)), float64(time.Second))
+	assert.Equal(t, strconv.Itoa(int(Minutes30)), m.msg.GetProperty(primitive.PropertyDelayTimeLevel))
+
+	fake := &syncProducer{}
+	c := &client{
+		ClientConfig:    &ClientConfig{Group: "remind-group"},
+		forwardProducer: &rmqProducer{producer: fake, inflight: make(chan struct{}, 1)},
+	}
+
+	// 剩余15分钟，以10分钟的等级转发
+	ext := &primitive.MessageExt{Message: primitive.Message{Topic: "topic", Body: []byte("remind")}, MsgId: "a"}
+	ext.WithProperty(PropertyDeliverAt, strconv.FormatInt(time.Now().Add(15*time.Minute).UnixNano()/int64(time.Millisecond), 10))
+	ext.WithProperty(primitive.PropertyDelayTimeLevel, strconv.Itoa(int(Minutes30)))
+	hopped, err := c.hopDelayed(ext)
+	assert.Nil(t, err)
+	assert.True(t, hopped)
+	assert.Len(t, fake.sent, 1)
+	assert.Equal(t, "topic", fake.sent[0].Topic)
+	assert.Equal(t, strconv.Itoa(int(Minutes10)), fake.sent[0].GetProperty(primitive.PropertyDelayTimeLevel))
+	assert.Equal(t, ext.GetProperty(PropertyDeliverAt), fake.sent[0].GetProperty(PropertyDeliverAt))
+	assert.Equal(t, "remind-group", fake.sent[0].GetProperty(PropertyDelayOwner))
+
+	// 其他消费者组转发的副本直接确认
+	ext.WithProperty(PropertyDelayOwner, "other-group")
+	hopped, err = c.hopDelayed(ext)
+	assert.Nil(t, err)
+	assert.True(t, hopped)
+	assert.Len(t, fake.sent, 1)
+	ext.RemoveProperty(PropertyDelayOwner)
+
+	// 已到期及普通消息直接消费
+	ext.WithProperty(PropertyDeliverAt, strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10))
+	hopped, err = c.hopDelayed(ext)
+	assert.Nil(t, err)
+	assert.False(t, hopped)
+	hopped, _ = c.hopDelayed(&primitive.MessageExt{Message: primitive.Message{Topic: "topic"}})
+	assert.False(t, hopped)
+	assert.Len(t, fake.sent, 1)
+}
+
+// failingProducer 发送消息体为 fail 的消息时失败
+type failingProducer struct {
+	syncProducer
+	fail bool
+}
+
+func (p *failingProducer) SendSync(ctx context.Context, msgs ...*primitive.Message) (*primitive.SendResult, error) {
+	if p.fail && string(msgs[0].Body) == "fail" {
+		return nil, errors.New("send failed")
+	}
+	return p.syncProducer.SendSync(ctx, msgs...)
+}
+
+func TestHopDue(t *testing.T) {
+	fake := &failingProducer{fail: true}
+	c := &client{
+		ClientConfig:    &ClientConfig{Group: "remind-group"},
+		forwardProducer: &rmqProducer{producer: fake, inflight: make(chan struct{}, 1)},
+	}
+	later := strconv.FormatInt(time.Now().Add(time.Hour).UnixNano()/int64(time.Millisecond), 10)
+	var msgList []*primitive.MessageExt
+	for _, body := range []string{"ok", "fail"} {
+		ext := &primitive.MessageExt{Message: primitive.Message{Topic: "topic", Body: []byte(body)}, MsgId: body}
+		ext.WithProperty(PropertyDeliverAt, later)
+		msgList = append(msgList, ext)
+	}
+	msgList = append(msgList, &primitive.MessageExt{Message: primitive.Message{Topic: "topic", Body: []byte("now")}, MsgId: "now"})
+
+	_, err := c.hopDue(msgList)
+	assert.NotNil(t, err)
+	assert.Len(t, fake.sent, 1)
+
+	// 整批重新投递时，已转发的消息不再转发
+	fake.fail = false
+	due, err := c.hopDue(msgList)
+	assert.Nil(t, err)
+	assert.Len(t, due, 1)
+	assert.Equal(t, "now", due[0].MsgId)
+	assert.Len(t, fake.sent, 2)
+	assert.Equal(t, "fail", string(fake.sent[1].Body))
+
+	// 广播模式下以本机IP区分实例
+	c.ClientConfig.Broadcast = true
+	assert.Equal(t, "remind-group@"+env.LocalIP, c.delayOwner())
+}
+
+type typedOrder struct {
+	ID    int64  `json:"id"`
+	State string `json:"state"`
+}
+
+func TestTypedMessage(t *testing.T) {
+	rmqServices["typed-test"] = &client{ClientConfig: &ClientConfig{Topic: "order"}, service: "typed-test"}
+	defer delete(rmqServices, "typed-test")
+
+	msg, err := NewTypedMessage("typed-test", &typedOrder{ID: 1, State: "paid"}, JSONCodec)
+	assert.Nil(t, err)
+	assert.Equal(t, "application/json", msg.(*messageWrapper).msg.GetProperty(PropertyContentType))
+
+	var got *typedOrder
+	cb := Typed(func(ctx *gin.Context, o *typedOrder) error {
+		got = o
+		return nil
+	})
+	assert.Nil(t, cb(&gin.Context{}, msg))
+	assert.Equal(t, &typedOrder{ID: 1, State: "paid"}, got)
+
+	pb, err := NewTypedMessageTo("typed-test", "user", &wrappers.StringValue{Value: "hello"}, ProtobufCodec)
+	assert.Nil(t, err)
+	var value string
+	cb = Typed(func(ctx *gin.Context, msg Message, v *wrappers.StringValue) error {
+		value = v.GetValue()
+		return nil
+	})
+	assert.Nil(t, cb(&gin.Context{}, pb))
+	assert.Equal(t, "hello", value)
+	_, err = NewTypedMessage("typed-test", typedOrder{}, ProtobufCodec)
+	assert.Equal(t, ErrRmqCodecUnsupported, err)
+
+	// 解码失败默认投递死信，可通过 WithDecodeErrorHandler 修改
+	bad := &messageWrapper{msg: primitive.NewMessage("order", []byte("{"))}
+	unknown := primitive.NewMessage("order", []byte("x"))
+	unknown.WithProperty(PropertyContentType, "text/unknown")
+	var ce *ConsumeError
+	assert.True(t, errors.As(cb(&gin.Context{}, &messageWrapper{msg: unknown}), &ce))
+	assert.Equal(t, ActionDeadLetter, ce.Action)
+	assert.Equal(t, ErrRmqCodecUnsupported, ce.Err)
+	cb = Typed(func(ctx *gin.Context, o *typedOrder) error { return nil },
+		WithDecodeErrorHandler(func(ctx *gin.Context, msg Message, err error) error { return Drop(err) }))
+	assert.True(t, errors.As(cb(&gin.Context{}, bad), &ce))
+	assert.Equal(t, ActionDrop, ce.Action)
+
+	assert.Panics(t, func() { Typed(func(o *typedOrder) error { return nil }) })
+	assert.PanicsWithValue(t, "rmq: invalid typed handler", func() { Typed(nil) })
+	var handler func(ctx *gin.Context, o *typedOrder) error
+	assert.PanicsWithValue(t, "rmq: invalid typed handler", func() { Typed(handler) })
+}
+
+type fakePushConsumer struct {
+	rocketmq.PushConsumer
+	onShutdown func()
+}
+
+func (f *fakePushConsumer) Shutdown() error {
+	if f.onShutdown != nil {
+		f.onShutdown()
+	}
+	return nil
+}
+
+func TestPushConsumer_Stop(t *testing.T) {
+	fake := &fakePushConsumer{}
+	c := newRmqPushConsumer(fake, false)
+	// SDK先丢弃队列，之后被拒绝的消息不会发回重试主题
+	fake.onShutdown = func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		assert.False(t, c.stopping)
+	}
+	entered, release := make(chan struct{}), make(chan struct{})
+	calls := 0
+	cb := c.track(func(ctx context.Context, msgs ...*primitive.MessageExt) (consumer.ConsumeResult, error) {
+		calls++
+		close(entered)
+		<-release
+		return consumer.ConsumeSuccess, nil
+	})
+
+	result := make(chan consumer.ConsumeResult)
+	go func() {
+		r, _ := cb(context.Background())
+		result <- r
+	}()
+	<-entered
+	assert.Nil(t, c.stop())
+
+	// 停止后的消息不再处理，SDK不提交结果，从已持久化的位点重新投递
+	r, err := cb(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, consumer.ConsumeRetryLater, r)
+	assert.Equal(t, 1, calls)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, c.wait(ctx))
+
+	close(release)
+	assert.Equal(t, consumer.ConsumeSuccess, <-result)
+	assert.Nil(t, c.wait(context.Background()))
+}
+
+func TestPushConsumer_Limits(t *testing.T) {
+	c := newRmqPushConsumer(&fakePushConsumer{}, false)
+	c.concurrency = 2
+
+	var (
+		mu              sync.Mutex
+		running, maxRun int
+		wg              sync.WaitGroup
+	)
+	cb := c.track(func(ctx context.Context, msgs ...*primitive.MessageExt) (consumer.ConsumeResult, error) {
+		mu.Lock()
+		running++
+		if running > maxRun {
+			maxRun = running
+		}
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return consumer.ConsumeSuccess, nil
+	})
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = cb(context.Background())
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 2, maxRun)
+
+	// 暂停期间回调等待恢复
+	c.pause()
+	done := make(chan struct{})
+	go func() {
+		_, _ = cb(context.Background())
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("callback ran while paused")
+	case <-time.After(20 * time.Millisecond):
+	}
+	c.resume()
+	<-done
+
+	// 每秒100条，5条消息至少间隔40毫秒
+	l := newRateLimiter(100)
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		assert.True(t, l.wait(1, nil))
+	}
+	assert.True(t, time.Since(start) >= 40*time.Millisecond)
+	stopped := make(chan struct{})
+	close(stopped)
+	assert.False(t, l.wait(100, stopped))
+	assert.Nil(t, newRateLimiter(0))
+}
+
+func TestDnsResolver(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		addrs []string
+	)
+	set := func(a ...string) {
+		mu.Lock()
+		defer mu.Unlock()
+		addrs = a
+	}
+	r := newDnsResolver("test", func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), addrs...)
+	})
+
+	// 首次解析失败时 Resolve 同步重试
+	assert.Empty(t, r.Resolve())
+	set("10.0.0.2:9876", "10.0.0.1:9876")
+	assert.Equal(t, []string{"10.0.0.1:9876", "10.0.0.2:9876"}, r.Resolve())
+
+	r.start(10 * time.Millisecond)
+	set("10.0.0.3:9876")
+	assert.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([]string{"10.0.0.3:9876"}, r.Resolve())
+	}, time.Second, 10*time.Millisecond)
+
+	// 解析结果为空时保留原有地址
+	set()
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, []string{"10.0.0.3:9876"}, r.Resolve())
+
+	r.stop()
+	r.stop()
+	set("10.0.0.4:9876")
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, []string{"10.0.0.3:9876"}, r.Resolve())
+}
+
+func TestNamingMode(t *testing.T) {
+	t.Cleanup(func() {
+		rmqServicesMu.Lock()
+		defer rmqServicesMu.Unlock()
+		for _, service := range []string{"naming-http", "naming-direct", "naming-invalid"} {
+			delete(rmqServices, service)
+		}
+	})
+
+	// 默认使用本地HTTP服务
+	conf := ClientConfig{NameServers: []string{"localhost:9876"}, Group: "g", Topic: "t"}
+	assert.Nil(t, InitRmq("naming-http", conf))
+	c := rmqServices["naming-http"]
+	assert.NotNil(t, c.namingListener)
+	assert.Nil(t, c.resolver)
+	assert.Nil(t, c.stopNamingHandler())
+
+	conf.NamingMode = NamingDirect
+	assert.Nil(t, InitRmq("naming-direct", conf))
+	c = rmqServices["naming-direct"]
+	assert.Nil(t, c.namingListener)
+	resolver, err := c.nsResolver()
+	assert.Nil(t, err)
+	assert.Contains(t, resolver.Resolve(), "127.0.0.1:9876")
+	assert.Nil(t, c.stopNamingHandler())
+	_, err = c.nsResolver()
+	assert.Equal(t, ErrRmqSvcInvalidOperation, err)
+
+	conf.NamingMode = "consul"
+	assert.Equal(t, ErrRmqSvcConfigInvalid, InitRmq("naming-invalid", conf))
+}
@@ -8,6 +8,7 @@ import (
 	"math/rand"
 	"os"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/apache/rocketmq-client-go/v2"
@@ -26,11 +27,47 @@ func (q *queueSelectorByShardingKey) Select(msg *primitive.Message, queues []*pr
 	return queues[h.Sum32()%uint32(len(queues))]
 }
 
-func newProducer(ak, sk string, instance, group string, nsDomain string, retry int, timeout time.Duration) (*rmqProducer, error) {
+const (
+	// defaultMaxInflight 未配置时允许的最大未完成发送数
+	defaultMaxInflight = 1024
+	// defaultSendTimeout 未配置时异步发送的超时时间，与SDK一致
+	defaultSendTimeout = 3 * time.Second
+)
+
+func newProducer(ak, sk string, instance, group string, resolver primitive.NsResolver, retry int, timeout time.Duration, maxInflight int) (*rmqProducer, error) {
+	options := producerOptions(ak, sk, instance+"-"+strconv.Itoa(os.Getpid())+"-producer", group, resolver, retry, timeout)
+	prod, err := getTransport().NewProducer(ProducerConfig{
+		Service: instance,
+		Group:   group,
+		Options: options,
+	})
+	if err != nil {
+		wrapLogger(zlog.ErrorLogger, nil, "failed to create producer",
+			zap.String("ns", resolver.Description()),
+			zap.String("error", err.Error()))
+		return nil, err
+	}
+
+	if maxInflight <= 0 {
+		maxInflight = defaultMaxInflight
+	}
+	if timeout <= 0 {
+		timeout = defaultSendTimeout
+	}
+	return &rmqProducer{
+		producer: prod,
+		started:  false,
+		timeout:  timeout,
+		inflight: make(chan struct{}, maxInflight),
+	}, nil
+}
+
+// producerOptions 普通生产者与事务生产者共用的配置项
+func producerOptions(ak, sk string, instance, group string, resolver primitive.NsResolver, retry int, timeout time.Duration) []producer.Option {
 	options := []producer.Option{
-		producer.WithInstanceName(instance + "-" + strconv.Itoa(os.Getpid()) + "-producer"),
+		producer.WithInstanceName(instance),
 		producer.WithGroupName(group),
-		producer.WithNameServerDomain(nsDomain),
+		producer.WithNsResolver(resolver),
 		producer.WithRetry(retry),
 		producer.WithQueueSelector(&queueSelectorByShardingKey{}),
 	}
@@ -43,23 +80,22 @@ func newProducer(ak, sk string, instance, group string, nsDomain string, retry i
 	if timeout != 0 {
 		options = append(options, producer.WithSendMsgTimeout(timeout))
 	}
-	prod, err := rocketmq.NewProducer(options...)
-	if err != nil {
-		wrapLogger(zlog.ErrorLogger, nil, "failed to create producer",
-			zap.String("ns", nsDomain),
-			zap.String("error", err.Error()))
-		return nil, err
-	}
-
-	return &rmqProducer{
-		producer: prod,
-		started:  false,
-	}, nil
+	return options
 }
 
 type rmqProducer struct {
 	producer rocketmq.Producer
 	started  bool
+	// compressThreshold 消息体超过该字节数时压缩，不大于0时不压缩
+	compressThreshold int
+	// timeout 异步发送的超时时间
+	timeout time.Duration
+
+	// inflight 限制未完成的发送数，pending 用于停止时等待其完成
+	mu       sync.RWMutex
+	closed   bool
+	inflight chan struct{}
+	pending  sync.WaitGroup
 }
 
 func (p *rmqProducer) start() error {
@@ -73,12 +109,68 @@ func (p *rmqProducer) start() error {
 	return nil
 }
 
+// stop 拒绝新的发送，等待未完成的发送（包括异步发送的回调）结束后关闭生产者
 func (p *rmqProducer) stop() error {
-	return p.producer.Shutdown()
+	return p.stopContext(context.Background())
+}
+
+// stopContext 同 stop，ctx 结束时不再等待未完成的发送，直接关闭生产者并返回 ctx 的错误
+func (p *rmqProducer) stopContext(ctx context.Context) error {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.pending.Wait()
+		close(done)
+	}()
+	var waitErr error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		waitErr = ctx.Err()
+		wrapLogger(zlog.WarnLogger, nil, "producer stopped with pending sends", zap.String("error", waitErr.Error()))
+	}
+	if err := p.producer.Shutdown(); err != nil {
+		return err
+	}
+	return waitErr
+}
+
+// acquire 占用一个发送名额，名额用尽时等待直到 ctx 结束
+func (p *rmqProducer) acquire(ctx context.Context) error {
+	select {
+	case p.inflight <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		<-p.inflight
+		return ErrRmqSvcInvalidOperation
+	}
+	p.pending.Add(1)
+	return nil
+}
+
+func (p *rmqProducer) release() {
+	<-p.inflight
+	p.pending.Done()
 }
 
-func (p *rmqProducer) SendMessage(msgList ...*primitive.Message) (string, string, string, error) {
-	res, err := p.producer.SendSync(context.Background(), msgList...)
+func (p *rmqProducer) SendMessage(ctx context.Context, msgList ...*primitive.Message) (string, string, string, error) {
+	msgList, err := compressMessages(p.compressThreshold, msgList)
+	if err != nil {
+		return "", "", "", err
+	}
+	if err = p.acquire(ctx); err != nil {
+		return "", "", "", err
+	}
+	defer p.release()
+
+	res, err := p.producer.SendSync(ctx, msgList...)
 	if err != nil {
 		wrapLogger(zlog.ErrorLogger, nil, "failed to send messages",
 			zap.String("error", err.Error()))
@@ -86,3 +178,59 @@ func (p *rmqProducer) SendMessage(msgList ...*primitive.Message) (string, string
 	}
 	return res.MessageQueue.String(), res.MsgID, res.OffsetMsgID, err
 }
+
+// SendMessageAsync 异步发送，返回nil时 callback 一定会被调用。
+// ctx 只用于等待发送名额，发送本身不随 ctx 结束而取消，以生产者的发送超时时间为限
+func (p *rmqProducer) SendMessageAsync(ctx context.Context, callback func(*primitive.SendResult, error), msgList ...*primitive.Message) error {
+	msgList, err := compressMessages(p.compressThreshold, msgList)
+	if err != nil {
+		return err
+	}
+	if err = p.acquire(ctx); err != nil {
+		return err
+	}
+	timeout := p.timeout
+	if timeout <= 0 {
+		timeout = defaultSendTimeout
+	}
+	sendCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	var once sync.Once
+	done := func() {
+		once.Do(func() {
+			cancel()
+			p.release()
+		})
+	}
+
+	err = p.producer.SendAsync(sendCtx, func(_ context.Context, res *primitive.SendResult, err error) {
+		defer done()
+		callback(res, err)
+	}, msgList...)
+	if err != nil {
+		done()
+		wrapLogger(zlog.ErrorLogger, nil, "failed to send messages async",
+			zap.String("error", err.Error()))
+		return err
+	}
+	return nil
+}
+
+// SendMessageOneWay 单向发送，不等待Broker响应
+func (p *rmqProducer) SendMessageOneWay(ctx context.Context, msgList ...*primitive.Message) error {
+	msgList, err := compressMessages(p.compressThreshold, msgList)
+	if err != nil {
+		return err
+	}
+	if err = p.acquire(ctx); err != nil {
+		return err
+	}
+	defer p.release()
+
+	err = p.producer.SendOneWay(ctx, msgList...)
+	if err != nil {
+		wrapLogger(zlog.ErrorLogger, nil, "failed to send messages one way",
+			zap.String("error", err.Error()))
+		return err
+	}
+	return nil
+}
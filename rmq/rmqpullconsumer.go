@@ -0,0 +1,426 @@
+package rmq
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/apache/rocketmq-client-go/v2/consumer"
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/derekAHua/goLib/redis"
+	"github.com/derekAHua/goLib/zlog"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// PullQueue 拉模式消费者分配的消息队列。
+// 当前SDK未提供查询主题路由的接口，需显式指定Broker名称及队列ID
+type PullQueue struct {
+	BrokerName string `json:"brokerName" yaml:"brokerName"`
+	QueueID    int    `json:"queueId" yaml:"queueId"`
+}
+
+func (q PullQueue) String() string {
+	return q.BrokerName + ":" + strconv.Itoa(q.QueueID)
+}
+
+// OffsetStore 保存拉模式消费者提交的消费位点
+type OffsetStore interface {
+	// Load 读取队列已提交的位点，ok 为false表示没有提交过
+	Load(ctx *gin.Context, queue PullQueue) (offset int64, ok bool, err error)
+	// Save 提交队列的位点，offset 为下一条待消费消息的位点
+	Save(ctx *gin.Context, queue PullQueue, offset int64) error
+}
+
+type memoryOffsetStore struct {
+	mu      sync.Mutex
+	offsets map[PullQueue]int64
+}
+
+// NewMemoryOffsetStore 进程内的位点存储，进程重启后位点丢失
+func NewMemoryOffsetStore() OffsetStore {
+	return &memoryOffsetStore{offsets: make(map[PullQueue]int64)}
+}
+
+func (s *memoryOffsetStore) Load(_ *gin.Context, queue PullQueue) (int64, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	offset, ok := s.offsets[queue]
+	return offset, ok, nil
+}
+
+func (s *memoryOffsetStore) Save(_ *gin.Context, queue PullQueue, offset int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.offsets[queue] = offset
+	return nil
+}
+
+type redisOffsetStore struct {
+	redis *redis.Redis
+	key   string
+}
+
+// NewRedisOffsetStore 将位点保存在redis的hash key 中，field 为 PullQueue.String()
+func NewRedisOffsetStore(rds *redis.Redis, key string) OffsetStore {
+	return &redisOffsetStore{redis: rds, key: key}
+}
+
+func (s *redisOffsetStore) Load(ctx *gin.Context, queue PullQueue) (int64, bool, error) {
+	v, err := s.redis.HGet(ctx, s.key, queue.String())
+	if err != nil || v == nil {
+		return 0, false, err
+	}
+	offset, err := strconv.ParseInt(string(v), 10, 64)
+	if err != nil {
+		return 0, false, err
+	}
+	return offset, true, nil
+}
+
+func (s *redisOffsetStore) Save(ctx *gin.Context, queue PullQueue, offset int64) error {
+	_, err := s.redis.HSet(ctx, s.key, queue.String(), offset)
+	return err
+}
+
+// sdkPullConsumer SDK拉模式消费者中用到的方法
+type sdkPullConsumer interface {
+	Start() error
+	Shutdown() error
+	PullFrom(ctx context.Context, queue *primitive.MessageQueue, offset int64, numbers int) (*primitive.PullResult, error)
+}
+
+func newPullConsumer(ak, sk string, instance, group, topic string, resolver primitive.NsResolver, queues []PullQueue, store OffsetStore) (*rmqPullConsumer, error) {
+	options := []consumer.Option{
+		// 使用独立的实例，避免与推模式消费者共用客户端
+		consumer.WithInstance(instance + "-" + strconv.Itoa(os.Getpid()) + "-pull-consumer"),
+		consumer.WithGroupName(group),
+		consumer.WithNsResolver(resolver),
+	}
+	if ak != "" && sk != "" {
+		options = append(options, consumer.WithCredentials(primitive.Credentials{
+			AccessKey: ak,
+			SecretKey: sk,
+		}))
+	}
+	con, err := consumer.NewPullConsumer(options...)
+	if err != nil {
+		wrapLogger(zlog.ErrorLogger, nil, "failed to create pull consumer", zap.String("error", err.Error()))
+		return nil, err
+	}
+	return newRmqPullConsumer(con, topic, queues, store), nil
+}
+
+func newRmqPullConsumer(con sdkPullConsumer, topic string, queues []PullQueue, store OffsetStore) *rmqPullConsumer {
+	if store == nil {
+		store = NewMemoryOffsetStore()
+	}
+	return &rmqPullConsumer{
+		consumer:  con,
+		topic:     topic,
+		queues:    queues,
+		store:     store,
+		positions: make(map[PullQueue]int64),
+	}
+}
+
+type rmqPullConsumer struct {
+	consumer sdkPullConsumer
+	topic    string
+	queues   []PullQueue
+	store    OffsetStore
+
+	mu sync.Mutex
+	// positions 下一次拉取的位点，未提交
+	positions map[PullQueue]int64
+}
+
+func (c *rmqPullConsumer) start() error {
+	return c.consumer.Start()
+}
+
+func (c *rmqPullConsumer) stop() error {
+	return c.consumer.Shutdown()
+}
+
+func (c *rmqPullConsumer) messageQueue(queue PullQueue) *primitive.MessageQueue {
+	return &primitive.MessageQueue{
+		Topic:      c.topic,
+		BrokerName: queue.BrokerName,
+		QueueId:    queue.QueueID,
+	}
+}
+
+func (c *rmqPullConsumer) assigned(queue PullQueue) bool {
+	for _, q := range c.queues {
+		if q == queue {
+			return true
+		}
+	}
+	return false
+}
+
+// position 返回下一次拉取的位点，首次拉取时使用已提交的位点，没有提交过时从0开始（由Broker修正到最早的位点）
+func (c *rmqPullConsumer) position(ctx *gin.Context, queue PullQueue) (int64, error) {
+	c.mu.Lock()
+	offset, ok := c.positions[queue]
+	c.mu.Unlock()
+	if ok {
+		return offset, nil
+	}
+	offset, _, err := c.store.Load(ctx, queue)
+	if err != nil {
+		return 0, err
+	}
+	c.seek(queue, offset)
+	return offset, nil
+}
+
+func (c *rmqPullConsumer) seek(queue PullQueue, offset int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.positions[queue] = offset
+}
+
+// pull 从当前位点拉取最多 max 条消息并前移位点
+func (c *rmqPullConsumer) pull(ctx *gin.Context, queue PullQueue, max int) ([]*primitive.MessageExt, error) {
+	offset, err := c.position(ctx, queue)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.consumer.PullFrom(stdContext(ctx), c.messageQueue(queue), offset, max)
+	if err != nil {
+		wrapLogger(zlog.ErrorLogger, ctx, "failed to pull messages",
+			zap.String("queue", queue.String()),
+			zap.Int64("offset", offset),
+			zap.String("error", err.Error()))
+		return nil, err
+	}
+
+	switch res.Status {
+	case primitive.PullFound:
+		c.seek(queue, res.NextBeginOffset)
+		return res.GetMessageExts(), nil
+	case primitive.PullNoNewMsg, primitive.PullNoMsgMatched, primitive.PullOffsetIllegal:
+		// 位点非法时Broker返回修正后的位点
+		c.seek(queue, res.NextBeginOffset)
+	}
+	return nil, nil
+}
+
+// seekTimestamp 二分查找存储时间不早于 t 的第一条消息的位点
+func (c *rmqPullConsumer) seekTimestamp(ctx *gin.Context, queue PullQueue, t time.Time) (int64, error) {
+	mq := c.messageQueue(queue)
+	res, err := c.consumer.PullFrom(stdContext(ctx), mq, 0, 1)
+	if err != nil {
+		return 0, err
+	}
+
+	ts := t.UnixNano() / int64(time.Millisecond)
+	lo, hi := res.MinOffset, res.MaxOffset
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		res, err = c.consumer.PullFrom(stdContext(ctx), mq, mid, 1)
+		if err != nil {
+			return 0, err
+		}
+		msgs := res.GetMessageExts()
+		if res.Status != primitive.PullFound || len(msgs) == 0 {
+			// 位点处的消息已被清理，从下一个有效位点继续查找
+			if res.NextBeginOffset > mid {
+				lo = res.NextBeginOffset
+				continue
+			}
+			break
+		}
+		if msgs[0].StoreTimestamp < ts {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	c.seek(queue, lo)
+	return lo, nil
+}
+
+func (c *rmqPullConsumer) commit(ctx *gin.Context, queue PullQueue, offset int64) error {
+	if err := c.store.Save(ctx, queue, offset); err != nil {
+		wrapLogger(zlog.ErrorLogger, ctx, "failed to commit offset",
+			zap.String("queue", queue.String()),
+			zap.Int64("offset", offset),
+			zap.String("error", err.Error()))
+		return err
+	}
+	return nil
+}
+
+// getPullConsumer 获取服务已启动的拉模式消费者
+func getPullConsumer(service string, queue *PullQueue) (*rmqPullConsumer, error) {
+	client, ok := lookupClient(service)
+	if !ok {
+		return nil, ErrRmqSvcNotRegistered
+	}
+	client.mu.RLock()
+	con := client.pullConsumer
+	client.mu.RUnlock()
+	if con == nil || (queue != nil && !con.assigned(*queue)) {
+		return nil, ErrRmqSvcInvalidOperation
+	}
+	return con, nil
+}
+
+// SeekOffset 设置队列下一次拉取的位点，不会提交
+func SeekOffset(service string, queue PullQueue, offset int64) error {
+	con, err := getPullConsumer(service, &queue)
+	if err != nil {
+		return err
+	}
+	con.seek(queue, offset)
+	return nil
+}
+
+// SeekTimestamp 将队列下一次拉取的位点设置为存储时间不早于 t 的第一条消息，返回该位点
+func SeekTimestamp(ctx *gin.Context, service string, queue PullQueue, t time.Time) (int64, error) {
+	con, err := getPullConsumer(service, &queue)
+	if err != nil {
+		return 0, err
+	}
+	return con.seekTimestamp(ctx, queue, t)
+}
+
+// PullMessages 从队列当前位点拉取最多 max 条消息，位点随之前移但不会提交。
+// 没有新消息时Broker会挂起请求一段时间，期间不响应 ctx 的取消。
+// 无法解压的消息仍会返回，其 PropertyContentEncoding 属性不为空，消息体为原始内容
+func PullMessages(ctx *gin.Context, service string, queue PullQueue, max int) ([]Message, error) {
+	con, err := getPullConsumer(service, &queue)
+	if err != nil {
+		return nil, err
+	}
+	msgList, err := con.pull(ctx, queue, max)
+	if err != nil {
+		return nil, err
+	}
+	return wrapMessages(msgList), nil
+}
+
+// CommitOffset 提交队列的位点，offset 为下一条待消费消息的位点
+func CommitOffset(ctx *gin.Context, service string, queue PullQueue, offset int64) error {
+	con, err := getPullConsumer(service, &queue)
+	if err != nil {
+		return err
+	}
+	return con.commit(ctx, queue, offset)
+}
+
+// wrapMessages 包装拉取到的消息，无法解压的消息保留 PropertyContentEncoding 属性交给调用方处理
+func wrapMessages(msgList []*primitive.MessageExt) []Message {
+	msgs := make([]Message, 0, len(msgList))
+	for _, m := range msgList {
+		msg, _ := wrapMessageExt(m)
+		msgs = append(msgs, msg)
+	}
+	return msgs
+}
+
+type pullLoopOptions struct {
+	batchSize int
+	until     time.Time
+	stopAtEnd bool
+	idle      time.Duration
+}
+
+// PullLoopOption PullLoop 的配置项
+type PullLoopOption func(*pullLoopOptions)
+
+// WithPullBatch 每次拉取的最大消息数，默认32
+func WithPullBatch(n int) PullLoopOption {
+	return func(o *pullLoopOptions) {
+		o.batchSize = n
+	}
+}
+
+// WithPullUntil 只处理存储时间早于 t 的消息，所有队列都到达 t 后结束
+func WithPullUntil(t time.Time) PullLoopOption {
+	return func(o *pullLoopOptions) {
+		o.until = t
+	}
+}
+
+// WithPullStopAtEnd 所有队列都没有新消息时结束，默认持续等待新消息
+func WithPullStopAtEnd() PullLoopOption {
+	return func(o *pullLoopOptions) {
+		o.stopAtEnd = true
+	}
+}
+
+// PullLoop 依次从分配的各队列拉取消息交给 callback 处理，处理成功后提交位点。
+// callback 返回错误时结束并返回该错误，下次从该批消息重新拉取；ctx 取消时结束并返回 ctx 的错误
+func PullLoop(ctx *gin.Context, service string, callback BatchMessageCallback, opts ...PullLoopOption) error {
+	con, err := getPullConsumer(service, nil)
+	if err != nil {
+		return err
+	}
+	client, _ := lookupClient(service)
+	o := pullLoopOptions{batchSize: defaultPullBatchSize, idle: time.Second}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	done := make(map[PullQueue]bool, len(con.queues))
+	std := stdContext(ctx)
+	for len(done) < len(con.queues) {
+		idle := true
+		for _, queue := range con.queues {
+			if std.Err() != nil {
+				return std.Err()
+			}
+			if done[queue] {
+				continue
+			}
+
+			msgList, err := con.pull(ctx, queue, o.batchSize)
+			if err != nil {
+				return err
+			}
+			if !o.until.IsZero() {
+				ts := o.until.UnixNano() / int64(time.Millisecond)
+				for i, m := range msgList {
+					if m.StoreTimestamp >= ts {
+						msgList = msgList[:i]
+						done[queue] = true
+						// 下一次从第一条未处理的消息开始
+						con.seek(queue, m.QueueOffset)
+						break
+					}
+				}
+			}
+			if len(msgList) == 0 {
+				if o.stopAtEnd {
+					done[queue] = true
+				}
+				continue
+			}
+			idle = false
+
+			if err = callBatch(nil, client, callback, msgList); err != nil {
+				con.seek(queue, msgList[0].QueueOffset)
+				return err
+			}
+			next := msgList[len(msgList)-1].QueueOffset + 1
+			if err = con.commit(ctx, queue, next); err != nil {
+				return err
+			}
+		}
+
+		if idle && len(done) < len(con.queues) {
+			select {
+			case <-std.Done():
+				return std.Err()
+			case <-time.After(o.idle):
+			}
+		}
+	}
+	return nil
+}
@@ -7,6 +7,8 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/apache/rocketmq-client-go/v2"
 	"github.com/apache/rocketmq-client-go/v2/consumer"
@@ -20,7 +22,40 @@ var defaultAllMsgSelector = consumer.MessageSelector{
 
 type pushConsumerCallback func(context.Context, ...*primitive.MessageExt) (consumer.ConsumeResult, error)
 
-func newPushConsumer(ak, sk string, instance, group, topic string, broadcast, orderly bool, retry int, tags []string, nsDomain string, cb pushConsumerCallback) (*rmqPushConsumer, error) {
+// 批量消费的默认批大小，及SDK默认的单次拉取消息数
+const (
+	defaultBatchSize     = 32
+	defaultPullBatchSize = 32
+)
+
+// subscription 消费者订阅的主题、标签及该主题的消费回调
+type subscription struct {
+	topic string
+	tags  []string
+	cb    pushConsumerCallback
+}
+
+// selector 根据标签生成消息过滤器，未指定标签时消费全部消息
+func (s subscription) selector() consumer.MessageSelector {
+	if len(s.tags) == 0 {
+		return defaultAllMsgSelector
+	}
+	return consumer.MessageSelector{
+		Type:       consumer.TAG,
+		Expression: strings.Join(s.tags, "||"),
+	}
+}
+
+// newPushConsumer 创建推模式消费者，同一消费者组可订阅多个主题，每次回调最多 batchSize 条消息，extra 中的配置项会覆盖默认配置
+func newPushConsumer(ak, sk string, instance, group string, broadcast, orderly bool, retry, batchSize int, subs []subscription, resolver primitive.NsResolver, extra ...consumer.Option) (*rmqPushConsumer, error) {
+	conf := PushConsumerConfig{
+		Service:           instance,
+		Group:             group,
+		Broadcast:         broadcast,
+		Orderly:           orderly,
+		MaxReconsumeTimes: retry,
+		BatchSize:         batchSize,
+	}
 	if broadcast {
 		instance = instance + "-consumer"
 	} else {
@@ -30,12 +65,12 @@ func newPushConsumer(ak, sk string, instance, group, topic string, broadcast, or
 		consumer.WithInstance(instance),
 		consumer.WithGroupName(group),
 		consumer.WithAutoCommit(true),
-		consumer.WithNameServerDomain(nsDomain),
+		consumer.WithNsResolver(resolver),
 		consumer.WithConsumerOrder(orderly),
-		consumer.WithConsumeMessageBatchMaxSize(1),
 		consumer.WithMaxReconsumeTimes(int32(retry)),
 		consumer.WithStrategy(consumer.AllocateByAveragely),
 		consumer.WithConsumeFromWhere(consumer.ConsumeFromLastOffset),
+		consumer.WithConsumeMessageBatchMaxSize(batchSize),
 	}
 	if broadcast {
 		options = append(options, consumer.WithConsumerModel(consumer.BroadCasting))
@@ -48,45 +83,190 @@ func newPushConsumer(ak, sk string, instance, group, topic string, broadcast, or
 			SecretKey: sk,
 		}))
 	}
-	con, err := rocketmq.NewPushConsumer(options...)
+	conf.Options = append(options, extra...)
+	con, err := getTransport().NewPushConsumer(conf)
 	if err != nil {
 		wrapLogger(zlog.ErrorLogger, nil, "failed to create consumer", zap.String("error", err.Error()))
 		return nil, err
 	}
 
-	if len(tags) == 0 {
-		err = con.Subscribe(topic, defaultAllMsgSelector, cb)
-	} else if len(tags) == 1 {
-		err = con.Subscribe(topic, consumer.MessageSelector{
-			Type:       consumer.TAG,
-			Expression: tags[0],
-		}, cb)
-	} else {
-		err = con.Subscribe(topic, consumer.MessageSelector{
-			Type:       consumer.TAG,
-			Expression: strings.Join(tags, "||"),
-		}, cb)
-	}
-	if err != nil {
-		zlog.Error(nil, "failed to subscribe",
-			logAgentTopic,
-			zap.String("error", err.Error()))
-		return nil, err
+	pc := newRmqPushConsumer(con, orderly)
+	for _, sub := range subs {
+		if err = con.Subscribe(sub.topic, sub.selector(), pc.track(sub.cb)); err != nil {
+			zlog.Error(nil, "failed to subscribe",
+				logAgentTopic,
+				zap.String("topic", sub.topic),
+				zap.String("error", err.Error()))
+			return nil, err
+		}
 	}
 
-	return &rmqPushConsumer{
+	return pc, nil
+}
+
+func newRmqPushConsumer(con rocketmq.PushConsumer, orderly bool) *rmqPushConsumer {
+	c := &rmqPushConsumer{
 		consumer: con,
-	}, nil
+		orderly:  orderly,
+		stopped:  make(chan struct{}),
+	}
+	c.cond = sync.NewCond(&c.mu)
+	return c
 }
 
 type rmqPushConsumer struct {
 	consumer rocketmq.PushConsumer
+	orderly  bool
+
+	// 同时进行的消费回调数上限，0表示不限制
+	concurrency int
+	limiter     *rateLimiter
+
+	// 进行中的消费回调，暂停时新的回调等待恢复，stopping 后拒绝新的回调
+	mu       sync.Mutex
+	cond     *sync.Cond
+	paused   bool
+	stopping bool
+	running  int
+	idle     chan struct{}
+	stopped  chan struct{}
 }
 
 func (c *rmqPushConsumer) start() error {
 	return c.consumer.Start()
 }
 
+// rejected 停止后收到的消息不再处理。stop 先关闭了SDK消费者，队列已被丢弃，
+// SDK不提交此时的消费结果（不发回重试主题，也不计入重试次数），消息从已持久化的位点重新投递
+func (c *rmqPushConsumer) rejected() (consumer.ConsumeResult, error) {
+	if c.orderly {
+		return consumer.SuspendCurrentQueueAMoment, nil
+	}
+	return consumer.ConsumeRetryLater, nil
+}
+
+// track 记录进行中的消费回调，并按配置限制并发数及消费速率
+func (c *rmqPushConsumer) track(cb pushConsumerCallback) pushConsumerCallback {
+	return func(ctx context.Context, msgList ...*primitive.MessageExt) (consumer.ConsumeResult, error) {
+		if !c.enter() {
+			return c.rejected()
+		}
+		defer c.leave()
+
+		if c.limiter != nil && !c.limiter.wait(len(msgList), c.stopped) {
+			return c.rejected()
+		}
+		return cb(ctx, msgList...)
+	}
+}
+
+// enter 等待暂停结束及空闲的并发名额，已停止时返回false
+func (c *rmqPushConsumer) enter() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for !c.stopping && (c.paused || (c.concurrency > 0 && c.running >= c.concurrency)) {
+		c.cond.Wait()
+	}
+	if c.stopping {
+		return false
+	}
+	c.running++
+	return true
+}
+
+func (c *rmqPushConsumer) leave() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.running--
+	if c.stopping && c.running == 0 {
+		close(c.idle)
+	}
+	c.cond.Broadcast()
+}
+
+// pause 暂停消费，进行中的回调不受影响，之后的回调等待 resume
+func (c *rmqPushConsumer) pause() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.paused = true
+}
+
+func (c *rmqPushConsumer) resume() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.paused = false
+	c.cond.Broadcast()
+}
+
+// stop 停止拉取消息并拒绝新的消费回调，不等待进行中的回调，见 wait。
+// 先关闭SDK消费者使其丢弃队列，再放行等待中的回调，被拒绝的消息不会被当作消费失败
 func (c *rmqPushConsumer) stop() error {
-	return c.consumer.Shutdown()
+	err := c.consumer.Shutdown()
+	c.mu.Lock()
+	if !c.stopping {
+		c.stopping = true
+		close(c.stopped)
+		c.idle = make(chan struct{})
+		if c.running == 0 {
+			close(c.idle)
+		}
+		c.cond.Broadcast()
+	}
+	c.mu.Unlock()
+	return err
+}
+
+// wait 等待 stop 前进行中的消费回调结束，ctx 结束时返回 ctx 的错误
+func (c *rmqPushConsumer) wait(ctx context.Context) error {
+	c.mu.Lock()
+	idle := c.idle
+	c.mu.Unlock()
+	if idle == nil {
+		return ErrRmqSvcInvalidOperation
+	}
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// rateLimiter 限制每秒消费的消息数，按固定间隔匀速放行，不允许突发
+type rateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func newRateLimiter(perSecond int) *rateLimiter {
+	if perSecond <= 0 {
+		return nil
+	}
+	return &rateLimiter{interval: time.Second / time.Duration(perSecond)}
+}
+
+// wait 预约 n 条消息的名额并等待到可以消费的时间，cancel 关闭时返回false
+func (l *rateLimiter) wait(n int, cancel <-chan struct{}) bool {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	at := l.next
+	l.next = l.next.Add(time.Duration(n) * l.interval)
+	l.mu.Unlock()
+
+	d := at.Sub(now)
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-cancel:
+		return false
+	}
 }
@@ -0,0 +1,377 @@
+// Package rmqtest 提供进程内的内存版RocketMQ，用于不依赖真实NameServer及Broker的单元测试
+package rmqtest
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/derekAHua/goLib/rmq"
+)
+
+const (
+	brokerName      = "rmqtest"
+	defaultQueueNum = 4
+	// tickInterval 检查延迟消息、重试消息是否到期的间隔
+	tickInterval = 10 * time.Millisecond
+	// retryTopicPrefix 消费者组重试主题的前缀，与SDK一致
+	retryTopicPrefix = "%RETRY%"
+)
+
+// Broker 内存版的NameServer及Broker，实现了 rmq.Transport，
+// 支持标签过滤、按分片键选择队列（同一队列内有序）、延迟等级、消费重试（含发送到重试主题的消息）及死信
+type Broker struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	queueNum  int
+	topics    map[string]*topic
+	groups    map[string]*group
+	published []*primitive.MessageExt
+	scheduled []*scheduled
+	inflight  int
+	seq       int64
+
+	// 时钟：真实时间加上 offset
+	offset time.Duration
+
+	closed    chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+type topic struct {
+	queues [][]*primitive.MessageExt
+	// next 未指定分片键时轮询选择队列
+	next int
+}
+
+// scheduled 尚未到期的延迟消息或重试消息
+type scheduled struct {
+	at  time.Time
+	msg *primitive.MessageExt
+	// 重试消息到期后放入消费进度 cursor，延迟消息为nil，到期后写入主题
+	cursor *cursor
+}
+
+// New 创建 Broker 并通过 rmq.SetTransport 接管之后启动的生产者及消费者，测试结束时自动恢复并关闭。
+// 之后照常使用 rmq 的接口，rmq.InitRmq 的 NameServers 可以填写任意地址:
+//
+//	b := rmqtest.New(t)
+//	_ = rmq.InitRmq("order", rmq.ClientConfig{NameServers: []string{"127.0.0.1:9876"}, Group: "g", Topic: "order"})
+//	_ = rmq.StartProducer("order")
+//	msg, _ := rmq.NewMessage("order", []byte("body"))
+//	_, _ = msg.WithTag("paid").Send()
+//	b.AssertPublished(t, "order", "paid")
+func New(t testing.TB) *Broker {
+	t.Helper()
+	b := NewBroker()
+	prev := rmq.SetTransport(b)
+	t.Cleanup(func() {
+		rmq.SetTransport(prev)
+		b.Close()
+	})
+	return b
+}
+
+// NewBroker 创建 Broker，每个主题有4个队列
+func NewBroker() *Broker {
+	b := &Broker{
+		queueNum: defaultQueueNum,
+		topics:   make(map[string]*topic),
+		groups:   make(map[string]*group),
+		closed:   make(chan struct{}),
+	}
+	b.cond = sync.NewCond(&b.mu)
+	b.wg.Add(1)
+	go b.tick()
+	return b
+}
+
+// Close 停止全部消费者，等待进行中的消费回调结束
+func (b *Broker) Close() {
+	b.closeOnce.Do(func() {
+		close(b.closed)
+		b.mu.Lock()
+		for _, g := range b.groups {
+			for _, c := range g.consumers {
+				c.running = false
+			}
+			g.consumers = nil
+		}
+		b.cond.Broadcast()
+		b.mu.Unlock()
+		b.wg.Wait()
+	})
+}
+
+// tick 定期唤醒消费者，投递到期的延迟消息及重试消息
+func (b *Broker) tick() {
+	defer b.wg.Done()
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.closed:
+			return
+		case <-ticker.C:
+			b.mu.Lock()
+			b.promote()
+			b.cond.Broadcast()
+			b.mu.Unlock()
+		}
+	}
+}
+
+// Now 返回 Broker 当前的时间，用于判断延迟消息及重试消息是否到期
+func (b *Broker) Now() time.Time {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.now()
+}
+
+func (b *Broker) now() time.Time {
+	return time.Now().Add(b.offset)
+}
+
+// FastForward 将时钟向前拨动 d，到期的延迟消息及重试消息立即投递
+func (b *Broker) FastForward(d time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.offset += d
+	b.promote()
+	b.cond.Broadcast()
+}
+
+// WaitIdle 等待所有可投递的消息消费完成（不含尚未到期的延迟消息及重试消息），超时返回false
+func (b *Broker) WaitIdle(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for !b.idle() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		// tick 会定期唤醒
+		b.cond.Wait()
+	}
+	return true
+}
+
+func (b *Broker) idle() bool {
+	if b.inflight > 0 {
+		return false
+	}
+	for _, g := range b.groups {
+		for _, c := range g.consumers {
+			if c.next(true) != nil {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// promote 将到期的消息写入主题或放入重试队列，调用方需持有锁
+func (b *Broker) promote() {
+	now := b.now()
+	remain := b.scheduled[:0]
+	for _, s := range b.scheduled {
+		switch {
+		case s.at.After(now):
+			remain = append(remain, s)
+		case s.cursor != nil:
+			s.cursor.retry = append(s.cursor.retry, s.msg)
+		default:
+			b.store(s.msg)
+		}
+	}
+	b.scheduled = remain
+}
+
+func (b *Broker) topic(name string) *topic {
+	t, ok := b.topics[name]
+	if !ok {
+		t = &topic{queues: make([][]*primitive.MessageExt, b.queueNum)}
+		b.topics[name] = t
+	}
+	return t
+}
+
+// selectQueue 按分片键选择队列，与 rmq 生产者的选择方式一致；未指定分片键时轮询
+func (b *Broker) selectQueue(t *topic, msg *primitive.Message) int {
+	if key := msg.GetShardingKey(); key != "" {
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(key))
+		return int(h.Sum32() % uint32(b.queueNum))
+	}
+	q := t.next % b.queueNum
+	t.next++
+	return q
+}
+
+// send 保存消息，延迟消息到期后才对消费者可见，调用方需持有锁
+func (b *Broker) send(msgs []*primitive.Message) *primitive.SendResult {
+	t := b.topic(msgs[0].Topic)
+	q := b.selectQueue(t, msgs[0])
+	now := b.now()
+	res := &primitive.SendResult{
+		Status:       primitive.SendOK,
+		MessageQueue: &primitive.MessageQueue{Topic: msgs[0].Topic, BrokerName: brokerName, QueueId: q},
+	}
+
+	for i, msg := range msgs {
+		b.seq++
+		ext := &primitive.MessageExt{
+			Message: primitive.Message{
+				Topic:         msg.Topic,
+				Body:          append([]byte(nil), msg.Body...),
+				Flag:          msg.Flag,
+				TransactionId: msg.TransactionId,
+				Queue:         &primitive.MessageQueue{Topic: msg.Topic, BrokerName: brokerName, QueueId: q},
+			},
+			MsgId:         fmt.Sprintf("7F000001%024X", b.seq),
+			OffsetMsgId:   fmt.Sprintf("7F00000100002A9F%016X", b.seq),
+			QueueOffset:   -1,
+			BornTimestamp: now.UnixNano() / int64(time.Millisecond),
+			BornHost:      "127.0.0.1",
+			StoreHost:     "127.0.0.1:10911",
+		}
+		ext.WithProperties(msg.GetProperties())
+		ext.WithProperty(primitive.PropertyUniqueClientMessageIdKeyIndex, ext.MsgId)
+		b.published = append(b.published, clone(ext))
+
+		lvl, _ := strconv.Atoi(msg.GetProperty(primitive.PropertyDelayTimeLevel))
+		d := rmq.DelayLevel(lvl).Duration()
+		switch {
+		case strings.HasPrefix(msg.Topic, retryTopicPrefix):
+			b.sendRetry(strings.TrimPrefix(msg.Topic, retryTopicPrefix), ext, now.Add(d))
+		case d > 0:
+			b.scheduled = append(b.scheduled, &scheduled{at: now.Add(d), msg: ext})
+		default:
+			b.store(ext)
+		}
+
+		if i == 0 {
+			res.MsgID, res.OffsetMsgID, res.QueueOffset = ext.MsgId, ext.OffsetMsgId, ext.QueueOffset
+		} else {
+			res.MsgID += "," + ext.MsgId
+			res.OffsetMsgID += "," + ext.OffsetMsgId
+		}
+	}
+	b.cond.Broadcast()
+	return res
+}
+
+// sendRetry 发送到重试主题 %RETRY%group 的消息只由集群模式的消费者组 group 消费，
+// 与SDK一致，消费时主题恢复为 RETRY_TOPIC 属性中的原主题，调用方需持有锁
+func (b *Broker) sendRetry(group string, msg *primitive.MessageExt, at time.Time) {
+	if topic := msg.GetProperty(primitive.PropertyRetryTopic); topic != "" {
+		msg.Topic = topic
+		msg.Queue.Topic = topic
+	}
+	s := b.group(group).cursor
+	if at.After(b.now()) {
+		b.scheduled = append(b.scheduled, &scheduled{at: at, msg: msg, cursor: s})
+		return
+	}
+	s.retry = append(s.retry, msg)
+}
+
+// store 将消息写入所属队列的末尾，调用方需持有锁
+func (b *Broker) store(msg *primitive.MessageExt) {
+	t := b.topic(msg.Topic)
+	q := msg.Queue.QueueId
+	msg.QueueOffset = int64(len(t.queues[q]))
+	msg.StoreTimestamp = b.now().UnixNano() / int64(time.Millisecond)
+	t.queues[q] = append(t.queues[q], msg)
+}
+
+// Published 返回发送到主题 topic 的全部消息（含尚未到期的延迟消息），按发送顺序排列
+func (b *Broker) Published(topic string) []*primitive.MessageExt {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var msgs []*primitive.MessageExt
+	for _, m := range b.published {
+		if m.Topic == topic {
+			msgs = append(msgs, clone(m))
+		}
+	}
+	return msgs
+}
+
+// publishedWithTag 返回发送到主题 topic、标签为 tag 的消息，tag 为空时不限标签
+func (b *Broker) publishedWithTag(topic, tag string) []*primitive.MessageExt {
+	var msgs []*primitive.MessageExt
+	for _, m := range b.Published(topic) {
+		if tag == "" || m.GetTags() == tag {
+			msgs = append(msgs, m)
+		}
+	}
+	return msgs
+}
+
+// AssertPublished 断言有标签为 tag 的消息发送到了主题 topic（tag 为空时不限标签），返回最后一条匹配的消息
+func (b *Broker) AssertPublished(t testing.TB, topic, tag string) *primitive.MessageExt {
+	t.Helper()
+	msgs := b.publishedWithTag(topic, tag)
+	if len(msgs) == 0 {
+		t.Errorf("rmqtest: no message with tag %q published to topic %q", tag, topic)
+		return nil
+	}
+	return msgs[len(msgs)-1]
+}
+
+// AssertNotPublished 断言没有标签为 tag 的消息发送到主题 topic（tag 为空时不限标签）
+func (b *Broker) AssertNotPublished(t testing.TB, topic, tag string) {
+	t.Helper()
+	if msgs := b.publishedWithTag(topic, tag); len(msgs) > 0 {
+		t.Errorf("rmqtest: %d message(s) with tag %q published to topic %q", len(msgs), tag, topic)
+	}
+}
+
+// DeadLetters 返回消费者组 group 中超过最大重试次数或被投递到死信队列的消息
+func (b *Broker) DeadLetters(group string) []*primitive.MessageExt {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	g, ok := b.groups[group]
+	if !ok {
+		return nil
+	}
+	msgs := make([]*primitive.MessageExt, 0, len(g.deadLetters))
+	for _, m := range g.deadLetters {
+		msgs = append(msgs, clone(m))
+	}
+	return msgs
+}
+
+// clone 复制消息，避免消费者修改 Broker 中保存的消息
+func clone(m *primitive.MessageExt) *primitive.MessageExt {
+	c := &primitive.MessageExt{
+		Message: primitive.Message{
+			Topic:         m.Topic,
+			Body:          append([]byte(nil), m.Body...),
+			Flag:          m.Flag,
+			TransactionId: m.TransactionId,
+		},
+		MsgId:          m.MsgId,
+		OffsetMsgId:    m.OffsetMsgId,
+		QueueOffset:    m.QueueOffset,
+		BornTimestamp:  m.BornTimestamp,
+		BornHost:       m.BornHost,
+		StoreTimestamp: m.StoreTimestamp,
+		StoreHost:      m.StoreHost,
+		ReconsumeTimes: m.ReconsumeTimes,
+	}
+	if m.Queue != nil {
+		q := *m.Queue
+		c.Queue = &q
+	}
+	c.WithProperties(m.GetProperties())
+	return c
+}
@@ -0,0 +1,505 @@
+package rmqtest
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/derekAHua/goLib/env"
+	"github.com/derekAHua/goLib/redis/redistest"
+	"github.com/derekAHua/goLib/rmq"
+	"github.com/derekAHua/goLib/zlog"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	redistest.Main(m, zlog.LogNameRMQ)
+}
+
+// startService 注册服务并启动生产者
+func startService(t *testing.T, service string, conf rmq.ClientConfig) {
+	conf.NameServers = []string{"127.0.0.1:9876"}
+	assert.Nil(t, rmq.InitRmq(service, conf))
+	assert.Nil(t, rmq.StartProducer(service))
+	t.Cleanup(func() {
+		_ = rmq.StopConsumer(service)
+		_ = rmq.StopProducer(service)
+	})
+}
+
+type received struct {
+	mu     sync.Mutex
+	bodies []string
+}
+
+func (r *received) callback(err func(n int) error) rmq.MessageCallback {
+	return func(ctx *gin.Context, msg rmq.Message) error {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.bodies = append(r.bodies, string(msg.GetContent()))
+		if err != nil {
+			return err(len(r.bodies))
+		}
+		return nil
+	}
+}
+
+func (r *received) get() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.bodies...)
+}
+
+func send(t *testing.T, service, tag, shard, body string) {
+	msg, err := rmq.NewMessage(service, []byte(body))
+	assert.Nil(t, err)
+	_, err = msg.WithTag(tag).WithShard(shard).Send()
+	assert.Nil(t, err)
+}
+
+func TestBroker_Consume(t *testing.T) {
+	b := New(t)
+	startService(t, "rmqtest-order", rmq.ClientConfig{Group: "order-group", Topic: "order"})
+
+	var r received
+	assert.Nil(t, rmq.StartConsumer(nil, "rmqtest-order", []string{"paid", "refund"}, r.callback(nil)))
+	for _, body := range []string{"1", "2", "3", "4", "5"} {
+		send(t, "rmqtest-order", "paid", "user-1", body)
+	}
+	send(t, "rmqtest-order", "refund", "user-1", "6")
+	send(t, "rmqtest-order", "created", "user-1", "7")
+
+	assert.True(t, b.WaitIdle(time.Second))
+	// 相同分片键的消息在同一队列中按序消费，未订阅的标签被过滤
+	assert.Equal(t, []string{"1", "2", "3", "4", "5", "6"}, r.get())
+	assert.Equal(t, "7", string(b.AssertPublished(t, "order", "created").Body))
+	assert.Len(t, b.Published("order"), 7)
+	b.AssertNotPublished(t, "order", "cancelled")
+}
+
+func TestBroker_Delay(t *testing.T) {
+	b := New(t)
+	startService(t, "rmqtest-remind", rmq.ClientConfig{Group: "remind-group", Topic: "remind"})
+
+	var r received
+	assert.Nil(t, rmq.StartConsumer(nil, "rmqtest-remind", nil, r.callback(nil)))
+	msg, err := rmq.NewMessage("rmqtest-remind", []byte("later"))
+	assert.Nil(t, err)
+	_, err = msg.WithDelay(rmq.Minutes10).Send()
+	assert.Nil(t, err)
+	send(t, "rmqtest-remind", "now", "", "now")
+
+	assert.True(t, b.WaitIdle(time.Second))
+	assert.Equal(t, []string{"now"}, r.get())
+
+	b.FastForward(10 * time.Minute)
+	assert.True(t, b.WaitIdle(time.Second))
+	assert.Equal(t, []string{"now", "later"}, r.get())
+}
+
+func TestBroker_DelayUntilMultiGroup(t *testing.T) {
+	b := New(t)
+	startService(t, "rmqtest-notify-a", rmq.ClientConfig{Group: "notify-a", Topic: "notify"})
+	startService(t, "rmqtest-notify-b", rmq.ClientConfig{Group: "notify-b", Topic: "notify"})
+	startService(t, "rmqtest-notify-c", rmq.ClientConfig{Group: "notify-c", Topic: "notify", Broadcast: true})
+
+	var ra, rb, rc received
+	assert.Nil(t, rmq.StartConsumer(nil, "rmqtest-notify-a", nil, ra.callback(nil)))
+	assert.Nil(t, rmq.StartConsumer(nil, "rmqtest-notify-b", nil, rb.callback(nil)))
+	assert.Nil(t, rmq.StartConsumer(nil, "rmqtest-notify-c", nil, rc.callback(nil)))
+
+	// 以1秒的等级发送，到期时还剩约0.2秒，各消费者各转发一次
+	msg, err := rmq.NewMessage("rmqtest-notify-a", []byte("later"))
+	assert.Nil(t, err)
+	_, err = msg.WithDelayDuration(1200 * time.Millisecond).Send()
+	assert.Nil(t, err)
+
+	assert.Eventually(t, func() bool {
+		return len(ra.get()) > 0 && len(rb.get()) > 0 && len(rc.get()) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	// 等待可能多出的副本到期
+	time.Sleep(1500 * time.Millisecond)
+	assert.True(t, b.WaitIdle(time.Second))
+	assert.Equal(t, []string{"later"}, ra.get())
+	assert.Equal(t, []string{"later"}, rb.get())
+	assert.Equal(t, []string{"later"}, rc.get())
+}
+
+func TestBroker_Retry(t *testing.T) {
+	b := New(t)
+	startService(t, "rmqtest-pay", rmq.ClientConfig{Group: "pay-group", Topic: "pay", MaxReconsumeTimes: 2})
+
+	var r received
+	assert.Nil(t, rmq.StartConsumer(nil, "rmqtest-pay", nil, func(ctx *gin.Context, msg rmq.Message) error {
+		return r.callback(func(n int) error {
+			if string(msg.GetContent()) == "poison" {
+				return errors.New("always fail")
+			}
+			if n == 1 {
+				return rmq.RetryLater(rmq.Second, errors.New("fail once"))
+			}
+			return nil
+		})(ctx, msg)
+	}))
+
+	send(t, "rmqtest-pay", "", "", "ok")
+	assert.True(t, b.WaitIdle(time.Second))
+	b.FastForward(time.Second)
+	assert.True(t, b.WaitIdle(time.Second))
+	assert.Equal(t, []string{"ok", "ok"}, r.get())
+
+	// 超过最大重试次数后投递死信
+	send(t, "rmqtest-pay", "", "", "poison")
+	for i := 0; i < 3; i++ {
+		assert.True(t, b.WaitIdle(time.Second))
+		b.FastForward(time.Hour)
+	}
+	assert.True(t, b.WaitIdle(time.Second))
+	assert.Equal(t, []string{"ok", "ok", "poison", "poison", "poison"}, r.get())
+	dlq := b.DeadLetters("pay-group")
+	assert.Len(t, dlq, 1)
+	assert.Equal(t, "poison", string(dlq[0].Body))
+	assert.Equal(t, int32(2), dlq[0].ReconsumeTimes)
+}
+
+func TestBroker_Redrive(t *testing.T) {
+	b := New(t)
+	startService(t, "rmqtest-order", rmq.ClientConfig{Group: "order-group", Topic: "order", DeadLetterTopic: "order-dlq"})
+	startService(t, "rmqtest-audit", rmq.ClientConfig{Group: "audit-group", Topic: "order"})
+	startService(t, "rmqtest-order-dlq", rmq.ClientConfig{Group: "dlq-group", Topic: "order-dlq"})
+
+	var order, audit received
+	assert.Nil(t, rmq.StartConsumer(nil, "rmqtest-order", nil, order.callback(func(n int) error {
+		if n == 1 {
+			return rmq.DeadLetter(errors.New("bad order"))
+		}
+		return nil
+	})))
+	assert.Nil(t, rmq.StartConsumer(nil, "rmqtest-audit", nil, audit.callback(nil)))
+	assert.Nil(t, rmq.StartConsumer(nil, "rmqtest-order-dlq", nil, rmq.Redrive("rmqtest-order", nil)))
+
+	msg, err := rmq.NewMessage("rmqtest-order", []byte("order-1"))
+	assert.Nil(t, err)
+	_, err = msg.WithProperty("source", "app").WithProperty(rmq.PropertyDelayOwner, "other-group").Send()
+	assert.Nil(t, err)
+	assert.True(t, b.WaitIdle(time.Second))
+
+	// 死信记录原主题及消费失败的消费者组，不携带延迟消息的属性
+	dead := b.AssertPublished(t, "order-dlq", "")
+	assert.Equal(t, "order", dead.GetProperty(rmq.PropertyDLQOriginTopic))
+	assert.Equal(t, "order-group", dead.GetProperty(rmq.PropertyDLQOriginGroup))
+	assert.Equal(t, "bad order", dead.GetProperty(rmq.PropertyDLQReason))
+	assert.Empty(t, dead.GetProperty(rmq.PropertyDelayOwner))
+
+	// 只重新投递给失败的消费者组
+	redriven := b.AssertPublished(t, "%RETRY%order-group", "")
+	assert.Equal(t, "app", redriven.GetProperty("source"))
+	assert.Empty(t, redriven.GetProperty(rmq.PropertyDLQOriginGroup))
+	assert.Equal(t, []string{"order-1", "order-1"}, order.get())
+	assert.Equal(t, []string{"order-1"}, audit.get())
+	assert.Len(t, b.Published("order"), 1)
+}
+
+func TestBroker_Shutdown(t *testing.T) {
+	b := New(t)
+	startService(t, "rmqtest-shutdown", rmq.ClientConfig{Group: "shutdown-group", Topic: "shutdown"})
+
+	var (
+		entered  = make(chan struct{})
+		finished bool
+		sent     = make(chan error, 1)
+	)
+	assert.Nil(t, rmq.StartConsumer(nil, "rmqtest-shutdown", nil, func(ctx *gin.Context, msg rmq.Message) error {
+		close(entered)
+		time.Sleep(50 * time.Millisecond)
+		finished = true
+		return nil
+	}))
+	send(t, "rmqtest-shutdown", "", "", "slow")
+	<-entered
+
+	msg, err := rmq.NewMessage("rmqtest-shutdown", []byte("async"))
+	assert.Nil(t, err)
+	assert.Nil(t, msg.SendAsync(&gin.Context{}, func(ctx *gin.Context, msgID string, err error) {
+		sent <- err
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.Nil(t, rmq.Shutdown(ctx))
+	// 进行中的消费回调及异步发送在关闭前完成
+	assert.True(t, finished)
+	select {
+	case err = <-sent:
+		assert.Nil(t, err)
+	default:
+		t.Fatal("async send not flushed")
+	}
+	assert.True(t, b.WaitIdle(time.Second))
+
+	_, err = rmq.NewMessage("rmqtest-shutdown", nil)
+	assert.Equal(t, rmq.ErrRmqSvcNotRegistered, err)
+}
+
+func TestBroker_Pause(t *testing.T) {
+	b := New(t)
+	startService(t, "rmqtest-pause", rmq.ClientConfig{Group: "pause-group", Topic: "pause", MaxConsumePerSecond: 1000})
+
+	var r received
+	assert.Nil(t, rmq.StartConsumer(nil, "rmqtest-pause", nil, r.callback(nil)))
+	assert.Nil(t, rmq.PauseConsumer("rmqtest-pause"))
+	send(t, "rmqtest-pause", "", "", "held")
+	time.Sleep(20 * time.Millisecond)
+	assert.Empty(t, r.get())
+
+	assert.Nil(t, rmq.ResumeConsumer("rmqtest-pause"))
+	assert.True(t, b.WaitIdle(time.Second))
+	assert.Equal(t, []string{"held"}, r.get())
+	assert.Equal(t, rmq.ErrRmqSvcNotRegistered, rmq.PauseConsumer("unknown"))
+}
+
+func TestBroker_MessageProperties(t *testing.T) {
+	b := New(t)
+	startService(t, "rmqtest-props", rmq.ClientConfig{Group: "props-group", Topic: "props"})
+
+	var got rmq.Message
+	assert.Nil(t, rmq.StartConsumer(nil, "rmqtest-props", nil, func(ctx *gin.Context, msg rmq.Message) error {
+		got = msg
+		return nil
+	}))
+	msg, err := rmq.NewMessage("rmqtest-props", []byte("body"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(-1), msg.GetQueueOffset())
+	msgID, err := msg.WithKeys("order-1", "user-1").WithProperty("source", "app").Send()
+	assert.Nil(t, err)
+	assert.Equal(t, msgID, msg.GetID())
+	assert.True(t, b.WaitIdle(time.Second))
+
+	// 消费到的消息ID与发送返回的一致
+	assert.Equal(t, b.AssertPublished(t, "props", "").MsgId, msgID)
+	assert.Equal(t, msgID, got.GetID())
+	assert.Equal(t, "props", got.GetTopic())
+	assert.Equal(t, "app", got.GetProperty("source"))
+	assert.Equal(t, []string{"order-1", "user-1"}, strings.Fields(got.GetProperty("KEYS")))
+	assert.Equal(t, 0, got.GetReconsumeTimes())
+	assert.Equal(t, int64(0), got.GetQueueOffset())
+	assert.WithinDuration(t, time.Now(), got.GetBornTime(), time.Second)
+}
+
+func TestBroker_Trace(t *testing.T) {
+	b := New(t)
+	startService(t, "rmqtest-trace", rmq.ClientConfig{Group: "trace-group", Topic: "trace"})
+
+	var logIDs []string
+	assert.Nil(t, rmq.StartConsumer(nil, "rmqtest-trace", nil, func(ctx *gin.Context, msg rmq.Message) error {
+		logIDs = append(logIDs, zlog.GetLogId(ctx))
+		return nil
+	}))
+
+	// Send 携带 WithContext 写入的请求信息
+	reqCtx := &gin.Context{}
+	reqCtx.Set(zlog.ContextKeyLogId, "log-1")
+	reqCtx.Set(zlog.ContextKeyRequestId, "req-1")
+	msg, err := rmq.NewMessage("rmqtest-trace", []byte("with ctx"))
+	assert.Nil(t, err)
+	_, err = msg.WithContext(reqCtx).Send()
+	assert.Nil(t, err)
+	published := b.AssertPublished(t, "trace", "")
+	assert.Equal(t, "log-1", published.GetProperty(rmq.PropertyLogID))
+	assert.Equal(t, "req-1", published.GetProperty(rmq.PropertyRequestID))
+
+	// SendContext 携带 ctx 的请求信息
+	reqCtx = &gin.Context{}
+	reqCtx.Set(zlog.ContextKeyLogId, "log-2")
+	msg, _ = rmq.NewMessage("rmqtest-trace", []byte("send ctx"))
+	_, err = msg.SendContext(reqCtx)
+	assert.Nil(t, err)
+	assert.Equal(t, "log-2", b.Published("trace")[1].GetProperty(rmq.PropertyLogID))
+
+	// 未调用 WithContext 时生成新的 logId
+	msg, _ = rmq.NewMessage("rmqtest-trace", []byte("plain"))
+	_, err = msg.Send()
+	assert.Nil(t, err)
+	m1, _ := rmq.NewMessage("rmqtest-trace", []byte("batch"))
+	_, err = rmq.MessageBatch{m1}.Send()
+	assert.Nil(t, err)
+	for _, m := range b.Published("trace")[2:] {
+		assert.NotEmpty(t, m.GetProperty(rmq.PropertyLogID))
+		assert.NotEmpty(t, m.GetProperty(rmq.PropertyRequestID))
+		assert.Equal(t, env.GetAppName(), m.GetProperty(rmq.PropertyApp))
+	}
+
+	assert.True(t, b.WaitIdle(time.Second))
+	assert.Len(t, logIDs, 4)
+	assert.Equal(t, "log-1", logIDs[0])
+	assert.Equal(t, "log-2", logIDs[1])
+	assert.NotEmpty(t, logIDs[2])
+	assert.NotEmpty(t, logIDs[3])
+}
+
+func TestBroker_SendInterceptor(t *testing.T) {
+	b := New(t)
+	startService(t, "rmqtest-intercept", rmq.ClientConfig{Group: "intercept-group", Topic: "intercept"})
+
+	var calls []int
+	assert.Nil(t, rmq.UseSendInterceptor("rmqtest-intercept",
+		rmq.SendTiming(),
+		rmq.AllowTopics("intercept"),
+		rmq.MaxBodySize(8),
+		rmq.StampProperties(map[string]string{"source": "app"}),
+		func(next rmq.SendFunc) rmq.SendFunc {
+			return func(ctx context.Context, msgs []rmq.Message) (string, error) {
+				calls = append(calls, len(msgs))
+				return next(ctx, msgs)
+			}
+		},
+	))
+	assert.Equal(t, rmq.ErrRmqSvcNotRegistered, rmq.UseSendInterceptor("unknown", rmq.SendTiming()))
+
+	send(t, "rmqtest-intercept", "", "", "small")
+	assert.Equal(t, "app", b.AssertPublished(t, "intercept", "").GetProperty("source"))
+
+	msg, err := rmq.NewMessage("rmqtest-intercept", []byte("too large body"))
+	assert.Nil(t, err)
+	_, err = msg.Send()
+	assert.Equal(t, rmq.ErrRmqMessageTooLarge, err)
+
+	msg, err = rmq.NewMessageTo("rmqtest-intercept", "other", []byte("x"))
+	assert.Nil(t, err)
+	_, err = msg.Send()
+	assert.Equal(t, rmq.ErrRmqTopicNotAllowed, err)
+
+	m1, _ := rmq.NewMessage("rmqtest-intercept", []byte("a"))
+	m2, _ := rmq.NewMessage("rmqtest-intercept", []byte("b"))
+	_, err = rmq.MessageBatch{m1, m2}.Send()
+	assert.Nil(t, err)
+
+	// 异步及单向发送同样经过拦截器
+	msg, _ = rmq.NewMessage("rmqtest-intercept", []byte("too large body"))
+	assert.Equal(t, rmq.ErrRmqMessageTooLarge, msg.SendAsync(&gin.Context{}, nil))
+	msg, _ = rmq.NewMessageTo("rmqtest-intercept", "other", []byte("x"))
+	assert.Equal(t, rmq.ErrRmqTopicNotAllowed, msg.SendOneWay(&gin.Context{}))
+	m3, _ := rmq.NewMessage("rmqtest-intercept", []byte("c"))
+	m4, _ := rmq.NewMessageTo("rmqtest-intercept", "other", []byte("d"))
+	assert.Equal(t, rmq.ErrRmqTopicNotAllowed, rmq.MessageBatch{m3, m4}.SendOneWay(&gin.Context{}))
+
+	done := make(chan struct{})
+	msg, _ = rmq.NewMessage("rmqtest-intercept", []byte("async"))
+	assert.Nil(t, msg.SendAsync(&gin.Context{}, func(ctx *gin.Context, msgID string, err error) {
+		assert.Nil(t, err)
+		close(done)
+	}))
+	<-done
+
+	assert.Equal(t, []int{1, 2, 1}, calls)
+	assert.Len(t, b.Published("intercept"), 4)
+	assert.Equal(t, "app", b.AssertPublished(t, "intercept", "").GetProperty("source"))
+	assert.Empty(t, b.Published("other"))
+}
+
+func TestBroker_Compression(t *testing.T) {
+	b := New(t)
+	startService(t, "rmqtest-compress", rmq.ClientConfig{Group: "compress-group", Topic: "compress", CompressThreshold: 16})
+
+	var (
+		r        received
+		encoding []string
+	)
+	assert.Nil(t, rmq.StartConsumer(nil, "rmqtest-compress", nil, func(ctx *gin.Context, msg rmq.Message) error {
+		encoding = append(encoding, msg.GetProperty(rmq.PropertyContentEncoding))
+		return r.callback(nil)(ctx, msg)
+	}))
+
+	large := strings.Repeat("payload ", 32)
+	msg, err := rmq.NewMessage("rmqtest-compress", []byte(large))
+	assert.Nil(t, err)
+	_, err = msg.WithTag("large").Send()
+	assert.Nil(t, err)
+	// 发送不改变原消息
+	assert.Equal(t, large, string(msg.GetContent()))
+	send(t, "rmqtest-compress", "small", "", "small")
+	// 不支持的压缩方式不交给回调，直接投递死信
+	msg, err = rmq.NewMessage("rmqtest-compress", []byte("brotli"))
+	assert.Nil(t, err)
+	_, err = msg.WithTag("unknown").WithProperty(rmq.PropertyContentEncoding, "br").Send()
+	assert.Nil(t, err)
+	assert.True(t, b.WaitIdle(time.Second))
+
+	dlq := b.DeadLetters("compress-group")
+	if assert.Len(t, dlq, 1) {
+		assert.Equal(t, "unknown", dlq[0].GetTags())
+		assert.Equal(t, "br", dlq[0].GetProperty(rmq.PropertyContentEncoding))
+	}
+
+	published := b.AssertPublished(t, "compress", "large")
+	assert.Equal(t, rmq.EncodingGzip, published.GetProperty(rmq.PropertyContentEncoding))
+	assert.Less(t, len(published.Body), len(large))
+	assert.Empty(t, b.AssertPublished(t, "compress", "small").GetProperty(rmq.PropertyContentEncoding))
+
+	// 消费时自动解压
+	assert.ElementsMatch(t, []string{large, "small"}, r.get())
+	assert.Equal(t, []string{"", ""}, encoding)
+}
+
+func TestBroker_Request(t *testing.T) {
+	New(t)
+	startService(t, "rmqtest-rpc-client", rmq.ClientConfig{Group: "rpc-client", Topic: "rpc", ReplyTopic: "rpc-reply"})
+	startService(t, "rmqtest-rpc-server", rmq.ClientConfig{Group: "rpc-server", Topic: "rpc"})
+	t.Cleanup(func() {
+		_ = rmq.Shutdown(context.Background())
+	})
+
+	assert.Nil(t, rmq.StartConsumer(nil, "rmqtest-rpc-server", []string{"upper"},
+		rmq.Responder("rmqtest-rpc-server", func(ctx *gin.Context, msg rmq.Message) ([]byte, error) {
+			if string(msg.GetContent()) == "fail" {
+				return nil, errors.New("bad request")
+			}
+			return []byte(strings.ToUpper(string(msg.GetContent()))), nil
+		})))
+
+	request := func(ctx context.Context, tag, body string) (rmq.Message, error) {
+		msg, err := rmq.NewMessage("rmqtest-rpc-client", []byte(body))
+		assert.Nil(t, err)
+		return rmq.Request(ctx, "rmqtest-rpc-client", msg.WithTag(tag))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	reply, err := request(ctx, "upper", "ping")
+	assert.Nil(t, err)
+	assert.Equal(t, "PING", string(reply.GetContent()))
+	assert.Equal(t, "rpc-reply", reply.GetTopic())
+
+	// 发送的是副本，调用方的消息不被修改，可以再次发送
+	msg, err := rmq.NewMessage("rmqtest-rpc-client", []byte("pong"))
+	assert.Nil(t, err)
+	reply, err = rmq.Request(ctx, "rmqtest-rpc-client", msg.WithTag("upper"))
+	assert.Nil(t, err)
+	assert.Equal(t, "PONG", string(reply.GetContent()))
+	assert.Empty(t, msg.GetProperty(rmq.PropertyCorrelationID))
+	assert.Empty(t, msg.GetProperty(rmq.PropertyReplyTo))
+
+	_, err = request(ctx, "upper", "fail")
+	assert.Equal(t, &rmq.ReplyError{Message: "bad request"}, err)
+
+	// 没有响应方处理的请求超时
+	short, cancelShort := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancelShort()
+	_, err = request(short, "lower", "ping")
+	assert.Equal(t, rmq.ErrRmqRequestTimeout, err)
+
+	// 未配置响应主题的服务不能发送请求
+	msg, err = rmq.NewMessage("rmqtest-rpc-server", []byte("ping"))
+	assert.Nil(t, err)
+	_, err = rmq.Request(ctx, "rmqtest-rpc-server", msg)
+	assert.Equal(t, rmq.ErrRmqSvcConfigInvalid, err)
+
+	// 响应消费者随生产者停止
+	assert.Nil(t, rmq.StopProducer("rmqtest-rpc-client"))
+	_, err = request(ctx, "upper", "ping")
+	assert.Equal(t, rmq.ErrRmqSvcInvalidOperation, err)
+}
@@ -0,0 +1,401 @@
+package rmqtest
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/apache/rocketmq-client-go/v2"
+	"github.com/apache/rocketmq-client-go/v2/consumer"
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/derekAHua/goLib/rmq"
+)
+
+const (
+	// defaultSuspendTime 顺序消费失败时挂起队列的默认时间，与SDK一致
+	defaultSuspendTime = time.Second
+	// defaultMaxReconsumeTimes 未指定时并发消费的最大重试次数，与SDK一致
+	defaultMaxReconsumeTimes = 16
+)
+
+// ErrSubscribeAfterStart 消费者启动后不能再修改订阅
+var ErrSubscribeAfterStart = errors.New("rmqtest: subscribe after consumer started")
+
+type consumeFunc func(context.Context, ...*primitive.MessageExt) (consumer.ConsumeResult, error)
+
+// group 消费者组，集群模式下组内消费者共享消费进度，按队列分配消息
+type group struct {
+	consumers   []*pushConsumer
+	cursor      *cursor
+	deadLetters []*primitive.MessageExt
+}
+
+type queueKey struct {
+	topic string
+	queue int
+}
+
+// cursor 消费进度，集群模式属于消费者组，广播模式属于消费者
+type cursor struct {
+	offsets   map[queueKey]int
+	busy      map[queueKey]bool
+	suspended map[queueKey]time.Time
+	// attempts 顺序消费时队列头部消息已重试的次数
+	attempts map[queueKey]int32
+	// retry 已到期的重试消息
+	retry []*primitive.MessageExt
+}
+
+func newCursor() *cursor {
+	return &cursor{
+		offsets:   make(map[queueKey]int),
+		busy:      make(map[queueKey]bool),
+		suspended: make(map[queueKey]time.Time),
+		attempts:  make(map[queueKey]int32),
+	}
+}
+
+func (b *Broker) group(name string) *group {
+	g, ok := b.groups[name]
+	if !ok {
+		g = &group{cursor: newCursor()}
+		b.groups[name] = g
+	}
+	return g
+}
+
+// NewPushConsumer 实现 rmq.Transport，创建从 Broker 消费的推模式消费者
+func (b *Broker) NewPushConsumer(conf rmq.PushConsumerConfig) (rocketmq.PushConsumer, error) {
+	if conf.BatchSize <= 0 {
+		conf.BatchSize = 1
+	}
+	return &pushConsumer{
+		b:    b,
+		conf: conf,
+		subs: make(map[string]*subscription),
+	}, nil
+}
+
+type subscription struct {
+	topic string
+	// tags 为nil时消费全部消息
+	tags map[string]bool
+	cb   consumeFunc
+}
+
+func (s *subscription) match(m *primitive.MessageExt) bool {
+	return s.tags == nil || s.tags[m.GetTags()]
+}
+
+type pushConsumer struct {
+	b    *Broker
+	conf rmq.PushConsumerConfig
+	subs map[string]*subscription
+
+	cursor  *cursor
+	running bool
+}
+
+// delivery 一次消费回调的消息，key 为nil时是重试消息
+type delivery struct {
+	sub  *subscription
+	key  *queueKey
+	msgs []*primitive.MessageExt
+	// end 消费成功后的队列位点
+	end int
+}
+
+func (c *pushConsumer) Start() error {
+	c.b.mu.Lock()
+	defer c.b.mu.Unlock()
+	if c.running {
+		return nil
+	}
+	g := c.b.group(c.conf.Group)
+	c.cursor = g.cursor
+	if c.conf.Broadcast {
+		c.cursor = newCursor()
+	}
+	g.consumers = append(g.consumers, c)
+	c.running = true
+	c.b.wg.Add(1)
+	go c.run()
+	return nil
+}
+
+// Shutdown 停止消费者，与SDK一致不等待进行中的消费回调，回调的结果不再提交，消息重新投递给组内其他消费者
+func (c *pushConsumer) Shutdown() error {
+	c.b.mu.Lock()
+	if !c.running {
+		c.b.mu.Unlock()
+		return nil
+	}
+	c.running = false
+	g := c.b.group(c.conf.Group)
+	for i, other := range g.consumers {
+		if other == c {
+			g.consumers = append(g.consumers[:i], g.consumers[i+1:]...)
+			break
+		}
+	}
+	c.b.cond.Broadcast()
+	c.b.mu.Unlock()
+	return nil
+}
+
+func (c *pushConsumer) Subscribe(topic string, selector consumer.MessageSelector, f func(context.Context, ...*primitive.MessageExt) (consumer.ConsumeResult, error)) error {
+	c.b.mu.Lock()
+	defer c.b.mu.Unlock()
+	if c.running {
+		return ErrSubscribeAfterStart
+	}
+	sub := &subscription{topic: topic, cb: f}
+	if expr := strings.TrimSpace(selector.Expression); expr != "" && expr != "*" {
+		sub.tags = make(map[string]bool)
+		for _, tag := range strings.Split(expr, "||") {
+			sub.tags[strings.TrimSpace(tag)] = true
+		}
+	}
+	c.subs[topic] = sub
+	return nil
+}
+
+func (c *pushConsumer) Unsubscribe(topic string) error {
+	c.b.mu.Lock()
+	defer c.b.mu.Unlock()
+	if c.running {
+		return ErrSubscribeAfterStart
+	}
+	delete(c.subs, topic)
+	return nil
+}
+
+func (c *pushConsumer) run() {
+	defer c.b.wg.Done()
+
+	c.b.mu.Lock()
+	defer c.b.mu.Unlock()
+	for c.running {
+		d := c.next(false)
+		if d == nil {
+			c.b.cond.Wait()
+			continue
+		}
+		c.b.inflight++
+		c.b.mu.Unlock()
+		out := c.consume(d)
+		c.b.mu.Lock()
+		if c.running {
+			c.finish(d, out)
+		} else {
+			c.abandon(d)
+		}
+		c.b.inflight--
+		c.b.cond.Broadcast()
+	}
+}
+
+// assigned 集群模式下队列平均分配给组内订阅了该主题的消费者
+func (c *pushConsumer) assigned(topic string, queue int) bool {
+	if c.conf.Broadcast {
+		return true
+	}
+	var members []*pushConsumer
+	for _, other := range c.b.group(c.conf.Group).consumers {
+		if _, ok := other.subs[topic]; ok {
+			members = append(members, other)
+		}
+	}
+	return len(members) > 0 && members[queue%len(members)] == c
+}
+
+// next 取出下一批要消费的消息，peek 为true时只检查不取出，调用方需持有锁
+func (c *pushConsumer) next(peek bool) *delivery {
+	s := c.cursor
+	for i, m := range s.retry {
+		if sub, ok := c.subs[m.Topic]; ok {
+			if !peek {
+				s.retry = append(s.retry[:i], s.retry[i+1:]...)
+			}
+			return &delivery{sub: sub, msgs: []*primitive.MessageExt{m}}
+		}
+	}
+
+	topics := make([]string, 0, len(c.subs))
+	for topic := range c.subs {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+
+	now := c.b.now()
+	for _, name := range topics {
+		t, ok := c.b.topics[name]
+		if !ok {
+			continue
+		}
+		sub := c.subs[name]
+		for q, queue := range t.queues {
+			key := queueKey{topic: name, queue: q}
+			if !c.assigned(name, q) || s.busy[key] || now.Before(s.suspended[key]) {
+				continue
+			}
+			var msgs []*primitive.MessageExt
+			end := s.offsets[key]
+			for end < len(queue) && len(msgs) < c.conf.BatchSize {
+				if sub.match(queue[end]) {
+					msgs = append(msgs, queue[end])
+				}
+				end++
+			}
+			if len(msgs) == 0 {
+				// 跳过被标签过滤掉的消息
+				if !peek {
+					s.offsets[key] = end
+				}
+				continue
+			}
+			if !peek {
+				s.busy[key] = true
+			}
+			return &delivery{sub: sub, key: &key, msgs: msgs, end: end}
+		}
+	}
+	return nil
+}
+
+// outcome 消费回调的结果
+type outcome struct {
+	success bool
+	// delayLevel 并发消费时回调指定的重试延迟等级，-1 表示直接投递死信
+	delayLevel int
+	// suspend 顺序消费时回调指定的队列挂起时间
+	suspend time.Duration
+}
+
+func (c *pushConsumer) consume(d *delivery) (out outcome) {
+	msgs := make([]*primitive.MessageExt, 0, len(d.msgs))
+	for _, m := range d.msgs {
+		cp := clone(m)
+		if d.key != nil {
+			cp.ReconsumeTimes = c.cursor.attempts[*d.key]
+		}
+		msgs = append(msgs, cp)
+	}
+
+	mq := *d.msgs[0].Queue
+	ctx := context.Background()
+	var (
+		cc = primitive.NewConsumeConcurrentlyContext()
+		oc = primitive.NewConsumeOrderlyContext()
+	)
+	if c.conf.Orderly {
+		oc.MQ = mq
+		ctx = primitive.WithOrderlyCtx(ctx, oc)
+	} else {
+		cc.MQ = mq
+		ctx = primitive.WithConcurrentlyCtx(ctx, cc)
+	}
+
+	defer func() {
+		// 与SDK不同，回调 panic 时按消费失败处理，避免测试进程退出
+		if r := recover(); r != nil {
+			out = outcome{}
+		}
+		out.delayLevel = cc.DelayLevelWhenNextConsume
+		out.suspend = time.Duration(oc.SuspendCurrentQueueTimeMillis) * time.Millisecond
+	}()
+	result, err := d.sub.cb(ctx, msgs...)
+	out.success = err == nil && result == consumer.ConsumeSuccess
+	return out
+}
+
+func (c *pushConsumer) maxReconsumeTimes() int32 {
+	if c.conf.MaxReconsumeTimes >= 0 {
+		return int32(c.conf.MaxReconsumeTimes)
+	}
+	if c.conf.Orderly {
+		return math.MaxInt32
+	}
+	return defaultMaxReconsumeTimes
+}
+
+// abandon 消费者关闭后结束的回调不提交结果，与SDK丢弃队列一致，调用方需持有锁
+func (c *pushConsumer) abandon(d *delivery) {
+	if d.key != nil {
+		delete(c.cursor.busy, *d.key)
+		return
+	}
+	c.cursor.retry = append(c.cursor.retry, d.msgs...)
+}
+
+// finish 根据消费结果推进位点、安排重试或投递死信，调用方需持有锁
+func (c *pushConsumer) finish(d *delivery, out outcome) {
+	s := c.cursor
+	if d.key != nil {
+		delete(s.busy, *d.key)
+	}
+	if out.success {
+		if d.key != nil {
+			s.offsets[*d.key] = d.end
+			delete(s.attempts, *d.key)
+		}
+		return
+	}
+
+	g := c.b.group(c.conf.Group)
+	now := c.b.now()
+	if c.conf.Orderly && d.key != nil {
+		// 顺序消费失败时挂起队列，超过最大重试次数后投递死信并继续消费
+		attempts := s.attempts[*d.key]
+		if attempts < c.maxReconsumeTimes() {
+			s.attempts[*d.key] = attempts + 1
+			suspend := out.suspend
+			if suspend <= 0 {
+				suspend = defaultSuspendTime
+			}
+			s.suspended[*d.key] = now.Add(suspend)
+			return
+		}
+		for _, m := range d.msgs {
+			g.deadLetters = append(g.deadLetters, deadLetter(m, attempts))
+		}
+		s.offsets[*d.key] = d.end
+		delete(s.attempts, *d.key)
+		return
+	}
+
+	if d.key != nil {
+		s.offsets[*d.key] = d.end
+	}
+	if c.conf.Broadcast {
+		// 广播模式不重试
+		return
+	}
+	for _, m := range d.msgs {
+		if out.delayLevel < 0 || m.ReconsumeTimes >= c.maxReconsumeTimes() {
+			g.deadLetters = append(g.deadLetters, deadLetter(m, m.ReconsumeTimes))
+			continue
+		}
+		// Broker默认的重试延迟从10秒开始逐次递增
+		lvl := rmq.DelayLevel(out.delayLevel)
+		if lvl <= 0 {
+			lvl = rmq.Seconds10 + rmq.DelayLevel(m.ReconsumeTimes)
+		}
+		if lvl > rmq.Hours2 {
+			lvl = rmq.Hours2
+		}
+		retry := clone(m)
+		retry.ReconsumeTimes = m.ReconsumeTimes + 1
+		c.b.scheduled = append(c.b.scheduled, &scheduled{at: now.Add(lvl.Duration()), msg: retry, cursor: s})
+	}
+}
+
+func deadLetter(m *primitive.MessageExt, reconsumeTimes int32) *primitive.MessageExt {
+	dlq := clone(m)
+	dlq.ReconsumeTimes = reconsumeTimes
+	dlq.WithProperty(primitive.PropertyRetryTopic, m.Topic)
+	return dlq
+}
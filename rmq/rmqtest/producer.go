@@ -0,0 +1,76 @@
+package rmqtest
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/apache/rocketmq-client-go/v2"
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/derekAHua/goLib/rmq"
+)
+
+var (
+	// ErrNotStarted 生产者或消费者尚未启动
+	ErrNotStarted = errors.New("rmqtest: client not started")
+	// ErrEmptyMessage 没有要发送的消息
+	ErrEmptyMessage = errors.New("rmqtest: no message to send")
+)
+
+// NewProducer 实现 rmq.Transport，创建发送到 Broker 的生产者
+func (b *Broker) NewProducer(conf rmq.ProducerConfig) (rocketmq.Producer, error) {
+	return &producer{b: b, conf: conf}, nil
+}
+
+type producer struct {
+	b    *Broker
+	conf rmq.ProducerConfig
+
+	mu      sync.Mutex
+	started bool
+}
+
+func (p *producer) Start() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.started = true
+	return nil
+}
+
+func (p *producer) Shutdown() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.started = false
+	return nil
+}
+
+func (p *producer) SendSync(_ context.Context, msgs ...*primitive.Message) (*primitive.SendResult, error) {
+	p.mu.Lock()
+	started := p.started
+	p.mu.Unlock()
+	if !started {
+		return nil, ErrNotStarted
+	}
+	if len(msgs) == 0 {
+		return nil, ErrEmptyMessage
+	}
+
+	p.b.mu.Lock()
+	defer p.b.mu.Unlock()
+	return p.b.send(msgs), nil
+}
+
+// SendAsync 与SDK一致，发送失败时直接返回错误，否则在其他协程中回调
+func (p *producer) SendAsync(ctx context.Context, f func(context.Context, *primitive.SendResult, error), msgs ...*primitive.Message) error {
+	res, err := p.SendSync(ctx, msgs...)
+	if err != nil {
+		return err
+	}
+	go f(ctx, res, nil)
+	return nil
+}
+
+func (p *producer) SendOneWay(ctx context.Context, msgs ...*primitive.Message) error {
+	_, err := p.SendSync(ctx, msgs...)
+	return err
+}
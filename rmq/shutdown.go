@@ -0,0 +1,88 @@
+package rmq
+
+import (
+	"context"
+
+	"github.com/derekAHua/goLib/zlog"
+	"go.uber.org/zap"
+)
+
+// Shutdown 关闭全部已注册的服务，用于进程退出前，例如:
+//
+//	http.OnShutdown(func() {
+//		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+//		defer cancel()
+//		_ = rmq.Shutdown(ctx)
+//	})
+//
+// 依次：停止全部消费者（包括 Request 的响应消费者）拉取消息并拒绝新的消费回调，等待进行中的回调结束，
+// 停止拉模式消费者，等待未完成的异步发送后关闭各生产者，最后关闭名字服务。
+// ctx 结束时不再等待，继续关闭剩余的组件并返回 ctx 的错误。关闭后服务被注销，需要重新 InitRmq
+func Shutdown(ctx context.Context) error {
+	rmqServicesMu.Lock()
+	clients := make([]*client, 0, len(rmqServices))
+	for service, client := range rmqServices {
+		clients = append(clients, client)
+		delete(rmqServices, service)
+	}
+	consumers = nil
+	rmqServicesMu.Unlock()
+
+	var firstErr error
+	record := func(c *client, stage string, err error) {
+		if err == nil {
+			return
+		}
+		wrapLogger(zlog.ErrorLogger, nil, "rmq shutdown error",
+			zap.String("service", c.service),
+			zap.String("stage", stage),
+			zap.String("error", err.Error()))
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	// 先停止全部消费者，不再接收新的消息
+	pushConsumers := make([][]*rmqPushConsumer, len(clients))
+	for i, c := range clients {
+		c.mu.Lock()
+		for _, con := range []*rmqPushConsumer{c.pushConsumer, c.replyConsumer} {
+			if con != nil {
+				pushConsumers[i] = append(pushConsumers[i], con)
+			}
+		}
+		c.pushConsumer, c.replyConsumer = nil, nil
+		c.mu.Unlock()
+		for _, con := range pushConsumers[i] {
+			record(c, "stop consumer", con.stop())
+		}
+	}
+	for i, c := range clients {
+		for _, con := range pushConsumers[i] {
+			record(c, "wait consumer", con.wait(ctx))
+		}
+	}
+
+	for _, c := range clients {
+		c.mu.Lock()
+		pull, prod, forward, tx := c.pullConsumer, c.producer, c.forwardProducer, c.transactionProducer
+		c.pullConsumer, c.producer, c.forwardProducer, c.transactionProducer = nil, nil, nil, nil
+		c.mu.Unlock()
+
+		if pull != nil {
+			record(c, "stop pull consumer", pull.stop())
+		}
+		// 消费回调结束后再关闭转发生产者，回调中仍可能投递死信
+		if forward != nil {
+			record(c, "stop forward producer", forward.stopContext(ctx))
+		}
+		if prod != nil {
+			record(c, "stop producer", prod.stopContext(ctx))
+		}
+		if tx != nil {
+			record(c, "stop transaction producer", tx.stop())
+		}
+		record(c, "stop naming handler", c.stopNamingHandler())
+	}
+	return firstErr
+}
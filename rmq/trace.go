@@ -0,0 +1,51 @@
+package rmq
+
+import (
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/derekAHua/goLib/env"
+	"github.com/derekAHua/goLib/zlog"
+	"github.com/gin-gonic/gin"
+)
+
+// 消息中用于链路追踪的用户属性
+const (
+	PropertyLogID     = "logId"
+	PropertyRequestID = "requestId"
+	PropertyApp       = "module"
+)
+
+// ContextKeyProducerApp 消费回调的 ctx 中保存生产方应用名的key
+const ContextKeyProducerApp = "_rmqProducerApp"
+
+// injectTrace 将请求的 logId/requestId 及本应用名写入消息属性。
+// ctx 为nil时（如 Message.Send）保留 WithContext 已写入的属性，未写入时生成新的 logId/requestId
+func injectTrace(ctx *gin.Context, msg *primitive.Message) {
+	if ctx == nil {
+		if msg.GetProperty(PropertyLogID) == "" {
+			msg.WithProperty(PropertyLogID, zlog.GetLogId(nil))
+		}
+		if msg.GetProperty(PropertyRequestID) == "" {
+			msg.WithProperty(PropertyRequestID, zlog.GetRequestId(nil))
+		}
+		if msg.GetProperty(PropertyApp) == "" {
+			msg.WithProperty(PropertyApp, env.GetAppName())
+		}
+		return
+	}
+	msg.WithProperty(PropertyLogID, zlog.GetLogId(ctx))
+	msg.WithProperty(PropertyRequestID, zlog.GetRequestId(ctx))
+	msg.WithProperty(PropertyApp, env.GetAppName())
+}
+
+// extractTrace 从消息属性中恢复 logId/requestId 到消费回调的 ctx
+func extractTrace(ctx *gin.Context, msg *primitive.Message) {
+	if logID := msg.GetProperty(PropertyLogID); logID != "" {
+		ctx.Set(zlog.ContextKeyLogId, logID)
+	}
+	if requestID := msg.GetProperty(PropertyRequestID); requestID != "" {
+		ctx.Set(zlog.ContextKeyRequestId, requestID)
+	}
+	if app := msg.GetProperty(PropertyApp); app != "" {
+		ctx.Set(ContextKeyProducerApp, app)
+	}
+}
@@ -0,0 +1,69 @@
+package rmq
+
+import (
+	"sync"
+
+	"github.com/apache/rocketmq-client-go/v2"
+	"github.com/apache/rocketmq-client-go/v2/consumer"
+	"github.com/apache/rocketmq-client-go/v2/producer"
+)
+
+// Transport 创建生产者及推模式消费者的底层实现，默认直接使用RocketMQ SDK。
+// 测试中可通过 SetTransport 替换为进程内的实现（见 rmqtest 包），事务生产者及拉模式消费者不受影响
+type Transport interface {
+	NewProducer(conf ProducerConfig) (rocketmq.Producer, error)
+	NewPushConsumer(conf PushConsumerConfig) (rocketmq.PushConsumer, error)
+}
+
+// ProducerConfig 创建生产者的参数，Options 为对应的SDK配置项
+type ProducerConfig struct {
+	Service string
+	Group   string
+	Options []producer.Option
+}
+
+// PushConsumerConfig 创建推模式消费者的参数，Options 为对应的SDK配置项
+type PushConsumerConfig struct {
+	Service           string
+	Group             string
+	Broadcast         bool
+	Orderly           bool
+	MaxReconsumeTimes int
+	// 每次回调的最大消息数
+	BatchSize int
+	Options   []consumer.Option
+}
+
+type sdkTransport struct{}
+
+func (sdkTransport) NewProducer(conf ProducerConfig) (rocketmq.Producer, error) {
+	return rocketmq.NewProducer(conf.Options...)
+}
+
+func (sdkTransport) NewPushConsumer(conf PushConsumerConfig) (rocketmq.PushConsumer, error) {
+	return rocketmq.NewPushConsumer(conf.Options...)
+}
+
+var (
+	transport   Transport = sdkTransport{}
+	transportMu sync.RWMutex
+)
+
+// SetTransport 替换底层实现并返回原来的实现，t 为nil时恢复为RocketMQ SDK。
+// 只影响之后启动的生产者及消费者
+func SetTransport(t Transport) Transport {
+	if t == nil {
+		t = sdkTransport{}
+	}
+	transportMu.Lock()
+	defer transportMu.Unlock()
+	prev := transport
+	transport = t
+	return prev
+}
+
+func getTransport() Transport {
+	transportMu.RLock()
+	defer transportMu.RUnlock()
+	return transport
+}
@@ -1,8 +1,10 @@
 package rmq
 
 import (
+	"context"
 	"encoding/binary"
 	"encoding/json"
+	"fmt"
 	"github.com/derekAHua/goLib/env"
 	"github.com/derekAHua/goLib/zlog"
 	"log"
@@ -78,8 +80,25 @@ func wrapLogger(actualLogger func(*gin.Context, zlog.LogName, string, ...zapcore
 	actualLogger(nil, zlog.LogNameRMQ, msg, logFields...)
 }
 
+// stdContext gin.Context 不传递取消信号，使用请求自带的 context
+func stdContext(ctx *gin.Context) context.Context {
+	if ctx != nil && ctx.Request != nil {
+		return ctx.Request.Context()
+	}
+	return context.Background()
+}
+
+// copyContext 复制 gin.Context 供异步回调使用，请求结束后原 ctx 会被 gin 回收复用
+func copyContext(ctx *gin.Context) *gin.Context {
+	if ctx == nil {
+		return nil
+	}
+	return ctx.Copy()
+}
+
 func call(g *gin.Engine, fn MessageCallback, m *primitive.MessageExt) (err error) {
 	ctx := &gin.Context{}
+	extractTrace(ctx, &m.Message)
 	defer func() {
 		if r := recover(); r != nil {
 			const size = 64 << 10
@@ -96,11 +115,16 @@ func call(g *gin.Engine, fn MessageCallback, m *primitive.MessageExt) (err error
 		ctx.Done()
 	}()
 
-	err = fn(ctx, &messageWrapper{
-		msg:      &m.Message,
-		offsetID: m.OffsetMsgId,
-		msgID:    m.MsgId,
-	})
+	msg, err := wrapMessageExt(m)
+	if err != nil {
+		// 消息体无法解压，重试也无法消费
+		wrapLogger(zlog.ErrorLogger, ctx, "reject undecodable message",
+			zap.String("topic", m.Topic),
+			zap.String("msgID", m.MsgId),
+			zap.String("error", err.Error()))
+		return DeadLetter(err)
+	}
+	err = fn(ctx, msg)
 	if err != nil {
 		wrapLogger(zlog.ErrorLogger, ctx, "failed to consume message: "+err.Error())
 	}
@@ -111,6 +135,7 @@ func call(g *gin.Engine, fn MessageCallback, m *primitive.MessageExt) (err error
 		zap.ByteString("body", m.Body),
 		zap.String("msgID", m.MsgId),
 		zap.String("offsetMsgID", m.OffsetMsgId),
+		zap.String("producer", m.GetProperty(PropertyApp)),
 		zap.String("consumeDelay", strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond)-m.BornTimestamp, 10)),
 	)
 
@@ -118,3 +143,79 @@ func call(g *gin.Engine, fn MessageCallback, m *primitive.MessageExt) (err error
 
 	return err
 }
+
+// callBatch 批量消费，ctx 的 logId/requestId 取自第一条消息。
+// 无法解压的消息由 c 单独投递到死信主题，其余消息交给 fn；c 为nil或未配置死信主题时整批投递死信
+func callBatch(g *gin.Engine, c *client, fn BatchMessageCallback, msgList []*primitive.MessageExt) (err error) {
+	ctx := &gin.Context{}
+	if len(msgList) > 0 {
+		extractTrace(ctx, &msgList[0].Message)
+	}
+	var (
+		msgs   = make([]Message, 0, len(msgList))
+		msgIDs = make([]string, 0, len(msgList))
+		// rejected 已投递死信的消息，整批重试时不再重复投递
+		rejected []*primitive.MessageExt
+	)
+	defer func() {
+		if err != nil && len(rejected) > 0 {
+			c.rememberForwarded(rejected, nil)
+		}
+	}()
+	defer func() {
+		if r := recover(); r != nil {
+			wrapLogger(zlog.ErrorLogger, ctx, fmt.Sprintf("rmq batch consume panic(%v)", r), zap.Stack("stack"))
+			err = fmt.Errorf("rmq batch consume panic: %v", r)
+		}
+	}()
+
+	for _, m := range msgList {
+		msg, decodeErr := wrapMessageExt(m)
+		if decodeErr == nil {
+			msgs = append(msgs, msg)
+			msgIDs = append(msgIDs, m.MsgId)
+			continue
+		}
+		fields := []zlog.Field{
+			zap.String("topic", m.Topic),
+			zap.String("msgID", m.MsgId),
+			zap.String("error", decodeErr.Error()),
+		}
+		if c == nil || c.ClientConfig.DeadLetterTopic == "" {
+			wrapLogger(zlog.ErrorLogger, ctx, "reject message batch with undecodable message", fields...)
+			return DeadLetter(decodeErr)
+		}
+		if !c.alreadyForwarded(m) {
+			if err = c.sendToDeadLetter(decodeErr, m); err != nil {
+				wrapLogger(zlog.ErrorLogger, ctx, "failed to send undecodable message to dead letter topic",
+					append(fields, zap.String("dlqError", err.Error()))...)
+				return err
+			}
+			wrapLogger(zlog.WarnLogger, ctx, "undecodable message sent to dead letter topic", fields...)
+		}
+		rejected = append(rejected, m)
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	start := time.Now()
+	err = fn(ctx, msgs)
+
+	fields := []zlog.Field{
+		zap.Int("size", len(msgs)),
+		zap.Strings("msgIDs", msgIDs),
+		zap.Float64("cost", float64(time.Since(start).Nanoseconds()/1e4)/100.0),
+	}
+	if len(msgList) > 0 {
+		fields = append(fields, zap.String("topic", msgList[0].Topic))
+	}
+	if err != nil {
+		// 整批消息将一起重试或投递死信
+		fields = append(fields, zap.String("error", err.Error()))
+		wrapLogger(zlog.ErrorLogger, ctx, "failed to consume message batch", fields...)
+		return err
+	}
+	wrapLogger(zlog.InfoLogger, ctx, "rmq-batch-access", fields...)
+	return nil
+}
@@ -1,9 +1,35 @@
 package http
 
-import "time"
+import (
+	"sync"
+	"time"
+)
 
 type ServerConfig struct {
 	Address      string        `yaml:"address"`
 	ReadTimeout  time.Duration `yaml:"readTimeOut"`
 	WriteTimeout time.Duration `yaml:"writeTimeOut"`
 }
+
+var (
+	shutdownHooks   []func()
+	shutdownHooksMu sync.Mutex
+)
+
+// OnShutdown 注册HTTP服务停止后执行的清理函数（如关闭rmq），按注册的逆序执行
+func OnShutdown(fn func()) {
+	shutdownHooksMu.Lock()
+	defer shutdownHooksMu.Unlock()
+	shutdownHooks = append(shutdownHooks, fn)
+}
+
+// runShutdownHooks 在 Start 返回前执行已注册的清理函数
+func runShutdownHooks() {
+	shutdownHooksMu.Lock()
+	hooks := shutdownHooks
+	shutdownHooks = nil
+	shutdownHooksMu.Unlock()
+	for i := len(hooks) - 1; i >= 0; i-- {
+		hooks[i]()
+	}
+}
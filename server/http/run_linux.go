@@ -24,7 +24,8 @@ func Start(engine *gin.Engine, conf ServerConfig) error {
 		appServer.WriteTimeout = conf.WriteTimeout
 	}
 
-	// 监听http端口
+	// 监听http端口，退出后执行清理函数
+	defer runShutdownHooks()
 	if err := appServer.ListenAndServe(); err != nil {
 		return err
 	}
@@ -5,5 +5,6 @@ import (
 )
 
 func Start(engine *gin.Engine, conf ServerConfig) error {
+	defer runShutdownHooks()
 	return engine.Run(conf.Address)
 }